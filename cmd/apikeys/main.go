@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"text/tabwriter"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		redisAddr = "localhost:6379"
+	}
+
+	ctx := context.Background()
+	switch os.Args[1] {
+	case "create":
+		create(ctx, os.Args[2:], redisAddr)
+	case "list":
+		list(ctx, os.Args[2:], redisAddr)
+	case "revoke":
+		revoke(ctx, os.Args[2:], redisAddr)
+	default:
+		printUsage()
+		os.Exit(2)
+	}
+}
+
+// create adds an API key and prints it. The key can't be shown again later.
+func create(ctx context.Context, args []string, redisAddr string) {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	name := flags.String("name", "", "Who or what the key is for")
+	admin := flags.Bool("admin", false, "Allow the key to use the admin endpoints")
+	dailyDownloads := flags.Int("daily-downloads", 0, "Download requests allowed per UTC day (0 for unlimited)")
+	dailyBytes := flags.String("daily-bytes", "0", "Size of videos that may be served per UTC day, e.g. 10GB (0 for unlimited)")
+	flags.StringVar(&redisAddr, "redis", redisAddr, "Redis server address")
+	flags.Parse(args)
+
+	if *name == "" {
+		log.Fatalf("Please name the key with -name")
+	}
+	if *dailyDownloads < 0 {
+		log.Fatalf("-daily-downloads can't be negative")
+	}
+	bytes, err := config.ParseSize(*dailyBytes)
+	if err != nil {
+		log.Fatalf("Invalid -daily-bytes: %v", err)
+	}
+
+	apiKey := &services.APIKey{
+		Name:           *name,
+		Admin:          *admin,
+		DailyDownloads: *dailyDownloads,
+		DailyBytes:     bytes,
+	}
+	key, err := newAPIKeyService(redisAddr).CreateAPIKey(ctx, apiKey)
+	if err != nil {
+		log.Fatalf("Failed to create API key: %v", err)
+	}
+
+	fmt.Printf("Created API key %s for %q\n", apiKey.ID, apiKey.Name)
+	fmt.Println("Send it in the X-API-Key header. It is only shown this once:")
+	fmt.Println(key)
+}
+
+// list prints every API key with its usage of the day
+func list(ctx context.Context, args []string, redisAddr string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	flags.StringVar(&redisAddr, "redis", redisAddr, "Redis server address")
+	flags.Parse(args)
+
+	service := newAPIKeyService(redisAddr)
+	apiKeys, err := service.ListAPIKeys(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list API keys: %v", err)
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tNAME\tADMIN\tDOWNLOADS TODAY\tBYTES TODAY\tCREATED")
+	for _, apiKey := range apiKeys {
+		usage, err := service.GetUsage(ctx, apiKey.ID)
+		if err != nil {
+			log.Fatalf("Failed to get usage of API key %s: %v", apiKey.ID, err)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%t\t%s\t%s\t%s\n",
+			apiKey.ID,
+			apiKey.Name,
+			apiKey.Admin,
+			describeQuota(int64(usage.Downloads), int64(apiKey.DailyDownloads)),
+			describeQuota(usage.Bytes, apiKey.DailyBytes),
+			apiKey.CreatedAt.Format("2006-01-02 15:04"),
+		)
+	}
+	table.Flush()
+}
+
+// revoke deletes the API keys with the given IDs
+func revoke(ctx context.Context, args []string, redisAddr string) {
+	flags := flag.NewFlagSet("revoke", flag.ExitOnError)
+	flags.StringVar(&redisAddr, "redis", redisAddr, "Redis server address")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		log.Fatalf("Please give the ID of the key to revoke")
+	}
+
+	service := newAPIKeyService(redisAddr)
+	for _, id := range flags.Args() {
+		if err := service.RevokeAPIKey(ctx, id); err != nil {
+			log.Fatalf("Failed to revoke API key %s: %v", id, err)
+		}
+		fmt.Printf("Revoked API key %s\n", id)
+	}
+}
+
+// newAPIKeyService connects to the Redis server the API keys are stored in
+func newAPIKeyService(redisAddr string) services.APIKeyServiceInterface {
+	return services.NewAPIKeyService(redis.NewClient(&redis.Options{Addr: redisAddr}))
+}
+
+// describeQuota formats the usage of a quota, e.g. "3/100" or "3" for unlimited quotas
+func describeQuota(used int64, limit int64) string {
+	if limit <= 0 {
+		return fmt.Sprintf("%d", used)
+	}
+	return fmt.Sprintf("%d/%d", used, limit)
+}
+
+func printUsage() {
+	fmt.Println("Manage the API keys of the server (REDIS_ADDR or -redis selects the Redis server)")
+	fmt.Println("Usage:")
+	fmt.Println("  apikeys create -name NAME [-admin] [-daily-downloads N] [-daily-bytes SIZE]")
+	fmt.Println("  apikeys list")
+	fmt.Println("  apikeys revoke ID...")
+}
@@ -1,17 +1,30 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"spiropoulos94/youtube-downloader/internal/config"
 	"spiropoulos94/youtube-downloader/internal/services"
+	"spiropoulos94/youtube-downloader/internal/storage"
+	"spiropoulos94/youtube-downloader/internal/validators"
+	"strings"
+	"syscall"
 )
 
 func main() {
 	// Define command line flags
-	url := flag.String("url", "", "YouTube video URL")
+	url := flag.String("url", "", "Video URL (YouTube, Vimeo or SoundCloud)")
+	audioOnly := flag.Bool("audio", false, "Extract only the audio track")
+	audioFormat := flag.String("audio-format", "", "Audio format when using -audio: mp3, m4a or opus (default mp3)")
+	audioBitrate := flag.Int("audio-bitrate", 0, "Audio bitrate in kbps when using -audio (default: best quality)")
 	outputDir := flag.String("output", "downloads", "Output directory for downloaded videos")
+	maxHeight := flag.Int("max-height", 0, "Maximum video resolution, e.g. 720 (default: best available)")
+	videoCodec := flag.String("codec", "", "Preferred video codec: h264, vp9 or av1")
+	maxFileSize := flag.Int("max-filesize", 0, "Maximum file size in MB")
 	flag.Parse()
 
 	// Validate URL
@@ -19,20 +32,67 @@ func main() {
 		fmt.Println("Please provide a YouTube URL using the -url flag")
 		fmt.Println("Usage example:")
 		fmt.Println("  ./cli -url https://www.youtube.com/watch?v=... -output downloads")
+		fmt.Println("  ./cli -url https://www.youtube.com/watch?v=... -audio -audio-format m4a")
 		return
 	}
 
-	// Create YouTube service
-	youtubeService := services.NewYouTubeService(&config.Config{
+	opts := services.DownloadOptions{
+		MaxHeight:     *maxHeight,
+		VideoCodec:    *videoCodec,
+		MaxFileSizeMB: *maxFileSize,
+		AudioFormat:   *audioFormat,
+		AudioBitrate:  *audioBitrate,
+	}
+	cfg := &config.Config{
 		OutputDir: *outputDir,
-	}, nil) // we don't need redis client for the cli, since we are not using the server and the video is instantly downloaded and accessible to the user
+	}
+
+	// Sites without video, like SoundCloud, are always downloaded in audio mode
+	media, err := validators.NewSourceRegistry(cfg).Validate(*url)
+	if *audioOnly || (err == nil && media.AudioOnly) {
+		opts.Mode = services.ModeAudio
+	}
+	if err := opts.Validate(); err != nil {
+		log.Fatalf("Invalid format options: %v", err)
+	}
+
+	// Create YouTube service
+	youtubeService := services.NewYouTubeService(cfg, nil, storage.NewLocalStore(cfg.OutputDir), nil, nil, nil) // we don't need redis client for the cli, since we are not using the server and the video is instantly downloaded and accessible to the user
 
 	// Download video
-	fmt.Printf("Downloading video from: %s\n", *url)
-	filePath, err := youtubeService.DownloadVideo(*url)
+	fmt.Printf("Downloading %s from: %s\n", describeMode(opts), *url)
+	// Stop the download (and clean up its partial files) on Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	videoData, err := youtubeService.DownloadVideo(ctx, *url, opts, printProgress)
+	fmt.Println()
 	if err != nil {
-		log.Fatalf("Failed to download video: %v", err)
+		log.Fatalf("Failed to download %s: %v", describeMode(opts), err)
+	}
+
+	fmt.Printf("Download completed! File saved to: %s\n", videoData.FilePath)
+}
+
+// printProgress redraws a single progress line in the terminal
+func printProgress(progress services.Progress) {
+	if progress.Phase != services.PhaseDownloading {
+		fmt.Printf("\r%-80s", strings.ReplaceAll(progress.Phase, "_", "-")+"...")
+		return
 	}
+	fmt.Printf("\r%-80s", fmt.Sprintf("%s: %5.1f%% of %.1f MB at %.1f MB/s, ETA %ds",
+		progress.Phase,
+		progress.Percent,
+		float64(progress.TotalBytes)/(1024*1024),
+		progress.Speed/(1024*1024),
+		progress.ETA,
+	))
+}
 
-	fmt.Printf("Download completed! Video saved to: %s\n", filePath)
+// describeMode returns a human readable name for what is being downloaded
+func describeMode(opts services.DownloadOptions) string {
+	if opts.IsAudio() {
+		return "audio"
+	}
+	return "video"
 }
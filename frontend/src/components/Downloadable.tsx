@@ -11,8 +11,16 @@ import {
   styled,
   Link,
 } from "@mui/material";
-import { DownloadableVideo, TaskStatus } from "../types";
-import { getTaskStatus, getVideoDownloadUrl } from "../utils/api";
+import {
+  DownloadableVideo,
+  TaskStatus,
+  TaskStatusResponseData,
+} from "../types";
+import {
+  getTaskStatus,
+  getVideoDownloadUrl,
+  subscribeTaskStatus,
+} from "../utils/api";
 import FileDownloadIcon from "@mui/icons-material/FileDownload";
 import DeleteIcon from "@mui/icons-material/Delete";
 import YouTubeIcon from "@mui/icons-material/YouTube";
@@ -73,61 +81,64 @@ const Downloadable: React.FC<DownloadableProps> = ({
     video.status === TaskStatus.TaskStatusPending ||
     video.status === TaskStatus.TaskStatusInProgress;
 
-  const pollTaskStatus = async () => {
-    try {
-      const response = await getTaskStatus(video.taskId);
-      const statusValue = response.status;
-      let status: TaskStatus;
+  const applyTaskStatus = (response: TaskStatusResponseData) => {
+    const statusValue = response.status;
+    let status: TaskStatus;
 
-      if (statusValue === "completed") {
-        status = TaskStatus.TaskStatusCompleted;
-        if (response.download_url) {
-          window.requestAnimationFrame(() => {
-            setDownloadUrl(response.download_url);
-          });
-        }
-      } else if (statusValue === "failed") {
-        status = TaskStatus.TaskStatusFailed;
-      } else if (statusValue === "in_progress") {
-        status = TaskStatus.TaskStatusInProgress;
-      } else {
-        status = TaskStatus.TaskStatusPending;
+    if (statusValue === "completed") {
+      status = TaskStatus.TaskStatusCompleted;
+      if (response.download_url) {
+        window.requestAnimationFrame(() => {
+          setDownloadUrl(response.download_url);
+        });
       }
+    } else if (statusValue === "failed") {
+      status = TaskStatus.TaskStatusFailed;
+    } else if (statusValue === "in_progress") {
+      status = TaskStatus.TaskStatusInProgress;
+    } else {
+      status = TaskStatus.TaskStatusPending;
+    }
+
+    const updatedVideo = {
+      ...video,
+      status,
+      error: response.error,
+      title: response.title,
+      thumbnailUrl: response.thumbnail_url,
+      duration: response.duration,
+    };
 
-      const updatedVideo = {
-        ...video,
+    if (
+      status !== video.status ||
+      updatedVideo.title !== video.title ||
+      updatedVideo.thumbnailUrl !== video.thumbnailUrl
+    ) {
+      onStatusUpdate(
+        video.taskId,
         status,
-        error: response.error,
-        title: response.title,
-        thumbnailUrl: response.thumbnail_url,
-        duration: response.duration,
-      };
+        response.error,
+        response.title,
+        response.thumbnail_url,
+        response.duration,
+        response.download_url
+      );
+    }
 
-      if (
-        status !== video.status ||
-        updatedVideo.title !== video.title ||
-        updatedVideo.thumbnailUrl !== video.thumbnailUrl
-      ) {
-        onStatusUpdate(
-          video.taskId,
-          status,
-          response.error,
-          response.title,
-          response.thumbnail_url,
-          response.duration,
-          response.download_url
-        );
+    if (
+      status === TaskStatus.TaskStatusCompleted ||
+      status === TaskStatus.TaskStatusFailed
+    ) {
+      if (pollingInterval) {
+        clearInterval(pollingInterval);
+        setPollingInterval(null);
       }
+    }
+  };
 
-      if (
-        status === TaskStatus.TaskStatusCompleted ||
-        status === TaskStatus.TaskStatusFailed
-      ) {
-        if (pollingInterval) {
-          clearInterval(pollingInterval);
-          setPollingInterval(null);
-        }
-      }
+  const pollTaskStatus = async () => {
+    try {
+      applyTaskStatus(await getTaskStatus(video.taskId));
     } catch (error) {
       if (axios.isAxiosError(error) && error.response?.status === 404) {
         if (pollingInterval) {
@@ -140,19 +151,35 @@ const Downloadable: React.FC<DownloadableProps> = ({
   };
 
   useEffect(() => {
-    pollTaskStatus();
-
     if (
-      video.status === TaskStatus.TaskStatusPending ||
-      video.status === TaskStatus.TaskStatusInProgress
+      video.status !== TaskStatus.TaskStatusPending &&
+      video.status !== TaskStatus.TaskStatusInProgress
     ) {
-      const interval = setInterval(pollTaskStatus, 2000);
+      pollTaskStatus();
+      return;
+    }
+
+    // Prefer the event stream, and poll if it isn't supported or fails
+    let interval: NodeJS.Timeout | null = null;
+    const startPolling = () => {
+      pollTaskStatus();
+      interval = setInterval(pollTaskStatus, 2000);
       setPollingInterval(interval);
+    };
 
-      return () => {
-        if (interval) clearInterval(interval);
-      };
+    const closeStream = subscribeTaskStatus(
+      video.taskId,
+      applyTaskStatus,
+      startPolling
+    );
+    if (!closeStream) {
+      startPolling();
     }
+
+    return () => {
+      if (closeStream) closeStream();
+      if (interval) clearInterval(interval);
+    };
   }, [video.taskId, video.status]); // eslint-disable-line react-hooks/exhaustive-deps
 
   const handleDownload = () => {
@@ -18,6 +18,7 @@ jest.mock("axios");
 // Mock the API functions
 jest.mock("../../utils/api", () => ({
   getTaskStatus: jest.fn(),
+  subscribeTaskStatus: jest.fn(() => null),
   getVideoDownloadUrl: jest.fn(
     () => "http://localhost:8080/api/videos/mock-task-id"
   ),
@@ -205,6 +206,51 @@ describe("Downloadable Component", () => {
     expect(mockOnStatusUpdate).toHaveBeenCalled();
   });
 
+  it("should stream task status instead of polling when supported", async () => {
+    const closeStream = jest.fn();
+    (api.subscribeTaskStatus as jest.Mock).mockImplementationOnce(
+      (taskId, onStatus) => {
+        onStatus({
+          status: "completed",
+          title: "Streamed Title",
+          download_url: "http://localhost:8080/api/videos/mock-task-id",
+        });
+        return closeStream;
+      }
+    );
+
+    const { unmount } = render(
+      <Downloadable
+        video={pendingVideo}
+        onStatusUpdate={mockOnStatusUpdate}
+        onDelete={mockOnDelete}
+      />
+    );
+
+    act(() => {
+      jest.advanceTimersByTime(2000);
+    });
+
+    expect(api.subscribeTaskStatus).toHaveBeenCalledWith(
+      "mock-task-id",
+      expect.any(Function),
+      expect.any(Function)
+    );
+    expect(api.getTaskStatus).not.toHaveBeenCalled();
+    expect(mockOnStatusUpdate).toHaveBeenCalledWith(
+      "mock-task-id",
+      TaskStatus.TaskStatusCompleted,
+      undefined,
+      "Streamed Title",
+      undefined,
+      undefined,
+      "http://localhost:8080/api/videos/mock-task-id"
+    );
+
+    unmount();
+    expect(closeStream).toHaveBeenCalled();
+  });
+
   // Skip this test for now as window.location.href setting might be handled differently
   it.skip("should trigger download when download button is clicked", async () => {
     // Mock window.location
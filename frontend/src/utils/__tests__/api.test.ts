@@ -1,5 +1,10 @@
 import axios from "axios";
-import { downloadVideo, getTaskStatus, getVideoDownloadUrl } from "../api";
+import {
+  downloadVideo,
+  getTaskStatus,
+  getVideoDownloadUrl,
+  subscribeTaskStatus,
+} from "../api";
 import { TaskStatus } from "../../types";
 
 // Mock axios
@@ -123,4 +128,78 @@ describe("API utilities", () => {
       expect(url).toBe("http://localhost:8080/api/videos/test-task-456");
     });
   });
+
+  describe("subscribeTaskStatus", () => {
+    // FakeEventSource records the stream it opened and lets tests send events
+    class FakeEventSource {
+      static last: FakeEventSource;
+      listeners: Record<string, (event: MessageEvent) => void> = {};
+      onerror: (() => void) | null = null;
+      closed = false;
+
+      constructor(public url: string) {
+        FakeEventSource.last = this;
+      }
+
+      addEventListener(type: string, listener: (event: MessageEvent) => void) {
+        this.listeners[type] = listener;
+      }
+
+      close() {
+        this.closed = true;
+      }
+
+      emit(type: string, data: unknown) {
+        this.listeners[type]({ data: JSON.stringify(data) } as MessageEvent);
+      }
+    }
+
+    afterEach(() => {
+      delete (window as any).EventSource;
+    });
+
+    it("should return null when EventSource isn't supported", () => {
+      expect(
+        subscribeTaskStatus("test-task-123", jest.fn(), jest.fn())
+      ).toBeNull();
+    });
+
+    it("should stream status events until the task is done", () => {
+      (window as any).EventSource = FakeEventSource;
+      const onStatus = jest.fn();
+      const onError = jest.fn();
+
+      const close = subscribeTaskStatus("test-task-789", onStatus, onError);
+      const source = FakeEventSource.last;
+      expect(close).not.toBeNull();
+      expect(source.url).toBe("/api/tasks/test-task-789/events");
+
+      source.emit("status", {
+        status: TaskStatus.TaskStatusCompleted,
+        download_url: "/streamed/download/url",
+      });
+      expect(onStatus).toHaveBeenCalledWith({
+        status: TaskStatus.TaskStatusCompleted,
+        download_url: "/streamed/download/url",
+      });
+      expect(getVideoDownloadUrl("test-task-789")).toBe(
+        "/streamed/download/url"
+      );
+
+      source.emit("done", {});
+      expect(source.closed).toBe(true);
+      expect(onError).not.toHaveBeenCalled();
+    });
+
+    it("should close the stream and report errors", () => {
+      (window as any).EventSource = FakeEventSource;
+      const onError = jest.fn();
+
+      subscribeTaskStatus("test-task-123", jest.fn(), onError);
+      FakeEventSource.last.onerror!();
+
+      expect(FakeEventSource.last.closed).toBe(true);
+      expect(onError).toHaveBeenCalled();
+    });
+  });
 });
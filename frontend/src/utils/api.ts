@@ -31,6 +31,35 @@ export const getTaskStatus = async (
   return response.data.data;
 };
 
+// Stream a task's status over Server-Sent Events until the task finishes.
+// Returns a function closing the stream, or null without EventSource support.
+export const subscribeTaskStatus = (
+  taskId: string,
+  onStatus: (data: TaskStatusResponseData) => void,
+  onError: () => void
+): (() => void) | null => {
+  if (typeof EventSource === "undefined") {
+    return null;
+  }
+
+  const source = new EventSource(`${API_URL}/tasks/${taskId}/events`);
+  source.addEventListener("status", (event) => {
+    const data = JSON.parse(
+      (event as MessageEvent).data
+    ) as TaskStatusResponseData;
+    // Cache the status like getTaskStatus does
+    taskStatusCache[taskId] = data;
+    onStatus(data);
+  });
+  // "done" ends the stream, closing keeps the browser from reconnecting
+  source.addEventListener("done", () => source.close());
+  source.onerror = () => {
+    source.close();
+    onError();
+  };
+  return () => source.close();
+};
+
 export const getVideoDownloadUrl = (taskId: string): string => {
   // Check if we have a cached response with a download_url
   if (taskStatusCache[taskId]?.download_url) {
@@ -1,38 +1,189 @@
 package config
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
+	"log"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Port          string
-	OutputDir     string
-	Env           string
-	RedisAddr     string
-	TaskRetention time.Duration
-	BaseURL       string
+	Port                string
+	OutputDir           string
+	Env                 string
+	RedisAddr           string
+	TaskRetention       time.Duration
+	CleanupInterval     time.Duration // How often videos not requested within TaskRetention are deleted
+	BaseURL             string
+	DownloadTimeout     time.Duration  // Default time a download task may run before it is killed
+	MaxDownloadTimeout  time.Duration  // Largest timeout a download request may ask for
+	MaxPlaylistItems    int            // Playlists are cut off after this many videos
+	SubscriptionSync    time.Duration  // How often subscriptions are checked for new uploads
+	InfoCacheTTL        time.Duration  // How long video info previews are cached
+	DownloadLockTTL     time.Duration  // Lease of a worker's download lock, renewed while the download runs
+	FileLeaseTTL        time.Duration  // Lease keeping cleanup from deleting a file being served or downloaded, renewed until done
+	Sources             []string       // Built-in sites URLs are accepted from, all of them if empty
+	CustomSources       []CustomSource // Extra sites defined by the operator
+	StorageBackend      string         // Where finished downloads are kept: local or s3
+	S3Endpoint          string         // Host and port of the S3-compatible object store
+	S3Bucket            string
+	S3Region            string
+	S3AccessKey         string // Credentials are only read from the environment, so they don't show up in the process list
+	S3SecretKey         string
+	S3UseSSL            bool
+	S3PresignExpiry     time.Duration        // Lifetime of the presigned URLs videos are redirected to, 0 streams them through the server
+	MaxStorageSize      int64                // Bytes stored videos may take before the least recently requested are evicted, 0 for no limit
+	StorageLowWater     int64                // Eviction stops once stored videos take this many bytes, 90% of MaxStorageSize if 0
+	StorageCheck        time.Duration        // How often storage usage is checked against MaxStorageSize
+	AuthEnabled         bool                 // Require an API key on every API route but health checks and share links
+	RateLimits          map[string]RateLimit // Request limits of each rate limited route group, by name
+	TrustProxy          bool                 // Take client IPs from X-Forwarded-For, when behind a reverse proxy
+	WorkerConcurrency   int                  // Tasks each worker process runs at the same time
+	DownloadsPerMinute  int                  // Downloads all workers together may start per minute, 0 for no limit
+	OutboundConcurrency int                  // Downloads all workers together may run at the same time, 0 for no limit
+	OutboundBandwidth   int64                // Bytes per second all running downloads may take together, 0 for no limit
+	OutboundLeaseTTL    time.Duration        // Lease of a running download on its outbound slot
+	SleepInterval       time.Duration        // yt-dlp waits between this and twice as long before each download
+	SleepRequests       time.Duration        // yt-dlp waits this long between the requests of a download
+	OutboundBackoff     time.Duration        // How long downloads are paused after a site rejects one for too many requests
+	OutboundMaxBackoff  time.Duration        // Longest pause, which doubles while rejections continue
+	Monitoring          string               // How the monitoring dashboard is mounted: full, read-only or off
+	MonitoringUser      string               // Basic auth user name of the monitoring dashboard
+	MonitoringPassword  string               // Basic auth password of the monitoring dashboard, only read from the environment
+	MonitoringNetworks  []netip.Prefix       // Networks the monitoring dashboard may be opened from, any if empty
 }
 
-func Load() *Config {
+// Modes of the monitoring dashboard, as used in the MONITORING setting
+const (
+	MonitoringFull     = "full"
+	MonitoringReadOnly = "read-only"
+	MonitoringOff      = "off"
+)
+
+// RateLimit allows a client Requests requests per Window on a route group, in bursts of up to
+// Requests requests
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// CustomSource is a site defined by the operator, e.g. internal conference recordings.
+// Its URLs are downloaded with yt-dlp's matching or generic extractor.
+type CustomSource struct {
+	Name  string   `json:"name"`           // Identifies the site in cache keys and logs
+	Hosts []string `json:"hosts"`          // Hosts the site's URLs have, matched exactly
+	Args  []string `json:"args,omitempty"` // Extra yt-dlp options, e.g. ["--cookies", "/etc/cookies.txt"]
+}
+
+func Load() (*Config, error) {
 	// Define command line flags
 	port := flag.String("port", getEnvOrDefault("PORT", "8080"), "Server port")
 	outputDir := flag.String("output", getEnvOrDefault("OUTPUT_DIR", "downloads"), "Output directory for downloaded videos")
 	env := flag.String("env", getEnvOrDefault("ENV", "development"), "Environment (development/production)")
 	redisAddr := flag.String("redis", getEnvOrDefault("REDIS_ADDR", "localhost:6379"), "Redis server address")
 	taskRetention := flag.Duration("task-retention", getTaskRetentionFromEnv(), "Task retention period in hours")
+	cleanupInterval := flag.Duration("cleanup-interval", getDurationFromEnv("CLEANUP_INTERVAL", time.Hour), "How often videos not requested within the retention period are deleted")
 	baseURL := flag.String("base-url", getEnvOrDefault("BASE_URL", ""), "Base URL for generating absolute URLs")
+	downloadTimeout := flag.Duration("download-timeout", getDurationFromEnv("DOWNLOAD_TIMEOUT", time.Hour), "Default time a download may run before it is killed")
+	maxDownloadTimeout := flag.Duration("max-download-timeout", getDurationFromEnv("MAX_DOWNLOAD_TIMEOUT", 6*time.Hour), "Largest download timeout a request may ask for")
+	maxPlaylistItems := flag.Int("max-playlist-items", getIntFromEnv("MAX_PLAYLIST_ITEMS", 200), "Maximum number of videos downloaded from a playlist")
+	subscriptionSync := flag.Duration("subscription-sync", getDurationFromEnv("SUBSCRIPTION_SYNC_INTERVAL", time.Hour), "How often subscriptions are checked for new uploads")
+	infoCacheTTL := flag.Duration("info-cache-ttl", getDurationFromEnv("INFO_CACHE_TTL", 10*time.Minute), "How long video info previews are cached")
+	downloadLockTTL := flag.Duration("download-lock-ttl", getDurationFromEnv("DOWNLOAD_LOCK_TTL", 30*time.Second), "Lease of a worker's lock on a video it downloads")
+	fileLeaseTTL := flag.Duration("file-lease-ttl", getDurationFromEnv("FILE_LEASE_TTL", 30*time.Second), "Lease keeping cleanup from deleting a file being served or downloaded")
+	sources := flag.String("sources", getEnvOrDefault("SOURCES", "youtube"), "Comma separated sites URLs are accepted from (youtube, vimeo, soundcloud)")
+	customSources := flag.String("custom-sources", getEnvOrDefault("CUSTOM_SOURCES", ""), "JSON list of extra sites: [{\"name\": ..., \"hosts\": [...], \"args\": [...]}]")
+	storageBackend := flag.String("storage", getEnvOrDefault("STORAGE_BACKEND", "local"), "Where finished downloads are kept (local, s3)")
+	s3Endpoint := flag.String("s3-endpoint", getEnvOrDefault("S3_ENDPOINT", ""), "Host and port of the S3-compatible object store")
+	s3Bucket := flag.String("s3-bucket", getEnvOrDefault("S3_BUCKET", ""), "Bucket finished downloads are uploaded to")
+	s3Region := flag.String("s3-region", getEnvOrDefault("S3_REGION", ""), "Region of the bucket")
+	s3UseSSL := flag.Bool("s3-use-ssl", getBoolFromEnv("S3_USE_SSL", true), "Connect to the object store over HTTPS")
+	s3PresignExpiry := flag.Duration("s3-presign-expiry", getDurationFromEnv("S3_PRESIGN_EXPIRY", 0), "Redirect video downloads to presigned URLs valid this long, 0 to stream them through the server")
+	maxStorageSize := flag.String("max-storage-size", getEnvOrDefault("MAX_STORAGE_SIZE", "0"), "Size stored videos may take before the least recently requested are evicted, e.g. 50GB (0 for no limit)")
+	storageLowWater := flag.String("storage-low-watermark", getEnvOrDefault("STORAGE_LOW_WATERMARK", "0"), "Size eviction brings stored videos down to (defaults to 90% of the maximum)")
+	storageCheck := flag.Duration("storage-check-interval", getDurationFromEnv("STORAGE_CHECK_INTERVAL", time.Minute), "How often storage usage is checked against the maximum")
+	authEnabled := flag.Bool("auth", getBoolFromEnv("AUTH_ENABLED", false), "Require an API key on the API (keys are managed with the apikeys command)")
+	rateLimits := flag.String("rate-limits", getEnvOrDefault("RATE_LIMITS", "download=30/1m"), "Comma separated request limits per client and route group, e.g. download=30/1m,info=120/1m (none to disable)")
+	trustProxy := flag.Bool("trust-proxy", getBoolFromEnv("TRUST_PROXY", false), "Take client IPs from the X-Forwarded-For header set by a reverse proxy")
+	workerConcurrency := flag.Int("worker-concurrency", getIntFromEnv("WORKER_CONCURRENCY", 10), "Tasks each worker process runs at the same time")
+	downloadsPerMinute := flag.Int("downloads-per-minute", getIntFromEnv("OUTBOUND_DOWNLOADS_PER_MINUTE", 0), "Downloads all workers together may start per minute (0 for no limit)")
+	outboundSlots := flag.Int("outbound-concurrency", getIntFromEnv("OUTBOUND_CONCURRENCY", 0), "Downloads all workers together may run at the same time (0 for no limit)")
+	outboundBandwidth := flag.String("outbound-bandwidth", getEnvOrDefault("OUTBOUND_BANDWIDTH", "0"), "Bandwidth per second all downloads may take together, e.g. 20MB (0 for no limit)")
+	sleepInterval := flag.Duration("sleep-interval", getDurationFromEnv("OUTBOUND_SLEEP_INTERVAL", 0), "yt-dlp waits between this and twice as long before each download")
+	sleepRequests := flag.Duration("sleep-requests", getDurationFromEnv("OUTBOUND_SLEEP_REQUESTS", 0), "yt-dlp waits this long between the requests of a download")
+	outboundLeaseTTL := flag.Duration("outbound-lease-ttl", getDurationFromEnv("OUTBOUND_LEASE_TTL", 30*time.Second), "Lease of a running download on its outbound slot")
+	outboundBackoff := flag.Duration("outbound-backoff", getDurationFromEnv("OUTBOUND_BACKOFF", time.Minute), "How long downloads are paused after a site answers with too many requests")
+	outboundMaxBackoff := flag.Duration("outbound-max-backoff", getDurationFromEnv("OUTBOUND_MAX_BACKOFF", 30*time.Minute), "Longest pause of the downloads, which doubles while sites keep rejecting them")
+	monitoring := flag.String("monitoring", getEnvOrDefault("MONITORING", ""), "How the monitoring dashboard is mounted (full, read-only, off), full if it is protected and read-only otherwise by default")
+	monitoringUser := flag.String("monitoring-user", getEnvOrDefault("MONITORING_USER", "admin"), "Basic auth user name of the monitoring dashboard, along with MONITORING_PASSWORD")
+	monitoringNetworks := flag.String("monitoring-networks", getEnvOrDefault("MONITORING_ALLOWED_NETWORKS", ""), "Comma separated IPs and CIDR networks the monitoring dashboard may be opened from (any if empty)")
 	flag.Parse()
 
-	return &Config{
-		Port:          *port,
-		OutputDir:     *outputDir,
-		Env:           *env,
-		RedisAddr:     *redisAddr,
-		TaskRetention: *taskRetention,
-		BaseURL:       *baseURL,
+	bandwidth, err := parseSizeSetting("OUTBOUND_BANDWIDTH", *outboundBandwidth)
+	if err != nil {
+		return nil, err
+	}
+	maxStorage, err := parseSizeSetting("MAX_STORAGE_SIZE", *maxStorageSize)
+	if err != nil {
+		return nil, err
+	}
+	lowWater, err := parseSizeSetting("STORAGE_LOW_WATERMARK", *storageLowWater)
+	if err != nil {
+		return nil, err
 	}
+	monitoringPassword := os.Getenv("MONITORING_PASSWORD")
+	networks, networksValid := parseNetworks("MONITORING_ALLOWED_NETWORKS", *monitoringNetworks)
+	monitoringProtected := len(networks) > 0 || monitoringPassword != "" || *authEnabled
+	return &Config{
+		Port:                *port,
+		OutputDir:           *outputDir,
+		Env:                 *env,
+		RedisAddr:           *redisAddr,
+		TaskRetention:       *taskRetention,
+		CleanupInterval:     durationAtLeast("CLEANUP_INTERVAL", *cleanupInterval, time.Second, time.Hour),
+		BaseURL:             *baseURL,
+		DownloadTimeout:     *downloadTimeout,
+		MaxDownloadTimeout:  *maxDownloadTimeout,
+		MaxPlaylistItems:    *maxPlaylistItems,
+		SubscriptionSync:    durationAtLeast("SUBSCRIPTION_SYNC_INTERVAL", *subscriptionSync, time.Second, time.Hour),
+		InfoCacheTTL:        durationAtLeast("INFO_CACHE_TTL", *infoCacheTTL, time.Second, 10*time.Minute),
+		DownloadLockTTL:     durationAtLeast("DOWNLOAD_LOCK_TTL", *downloadLockTTL, time.Second, 30*time.Second),
+		FileLeaseTTL:        durationAtLeast("FILE_LEASE_TTL", *fileLeaseTTL, time.Second, 30*time.Second),
+		Sources:             splitList(*sources),
+		CustomSources:       parseCustomSources(*customSources),
+		StorageBackend:      *storageBackend,
+		S3Endpoint:          *s3Endpoint,
+		S3Bucket:            *s3Bucket,
+		S3Region:            *s3Region,
+		S3AccessKey:         os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:         os.Getenv("S3_SECRET_KEY"),
+		S3UseSSL:            *s3UseSSL,
+		S3PresignExpiry:     *s3PresignExpiry,
+		MaxStorageSize:      maxStorage,
+		StorageLowWater:     lowWater,
+		StorageCheck:        durationAtLeast("STORAGE_CHECK_INTERVAL", *storageCheck, time.Second, time.Minute),
+		AuthEnabled:         *authEnabled,
+		RateLimits:          parseRateLimits(*rateLimits),
+		TrustProxy:          *trustProxy,
+		WorkerConcurrency:   *workerConcurrency,
+		DownloadsPerMinute:  *downloadsPerMinute,
+		OutboundConcurrency: outboundConcurrency(*outboundSlots, bandwidth, *workerConcurrency),
+		OutboundBandwidth:   bandwidth,
+		OutboundLeaseTTL:    durationAtLeast("OUTBOUND_LEASE_TTL", *outboundLeaseTTL, time.Second, 30*time.Second),
+		SleepInterval:       *sleepInterval,
+		SleepRequests:       *sleepRequests,
+		OutboundBackoff:     *outboundBackoff,
+		OutboundMaxBackoff:  *outboundMaxBackoff,
+		Monitoring:          monitoringMode(*monitoring, monitoringProtected, networksValid),
+		MonitoringUser:      *monitoringUser,
+		MonitoringPassword:  monitoringPassword,
+		MonitoringNetworks:  networks,
+	}, nil
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -43,13 +194,194 @@ func getEnvOrDefault(key, defaultValue string) string {
 }
 
 func getTaskRetentionFromEnv() time.Duration {
-	retentionStr := os.Getenv("TASK_RETENTION")
-	if retentionStr != "" {
-		// Try to parse as hours
-		if retention, err := time.ParseDuration(retentionStr); err == nil {
-			return retention
+	// Default: 24 hours
+	return getDurationFromEnv("TASK_RETENTION", 24*time.Hour)
+}
+
+func getDurationFromEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
 		}
 	}
-	// Default: 24 hours
-	return 24 * time.Hour
+	return defaultValue
+}
+
+func getIntFromEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if number, err := strconv.Atoi(value); err == nil {
+			return number
+		}
+	}
+	return defaultValue
+}
+
+func getBoolFromEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+// sizeUnits are the multipliers of the units sizes can be given in
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+// ParseSize parses a size in bytes with an optional unit, e.g. "500MB" or "50 GB".
+// Units are powers of 1024.
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	number := strings.TrimRight(value, "KMGTB ")
+	multiplier, ok := sizeUnits[strings.TrimSpace(strings.TrimPrefix(value, number))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in %q (use B, KB, MB, GB or TB)", value)
+	}
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(size * float64(multiplier)), nil
+}
+
+// parseSizeSetting parses the size setting of key. An invalid size is an error rather than
+// no limit, so a typo can't silently lift a limit
+func parseSizeSetting(key string, value string) (int64, error) {
+	size, err := ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return size, nil
+}
+
+// durationAtLeast returns the duration setting of key, or defaultValue if it is shorter than min.
+// Intervals and lease renewals, which run at a fraction of the TTL, are timed by tickers, and
+// tickers can't run at a zero or negative interval. Redis keys given a zero or negative TTL
+// never expire.
+func durationAtLeast(key string, value time.Duration, min time.Duration, defaultValue time.Duration) time.Duration {
+	if value < min {
+		log.Printf("Warning: Ignoring invalid %s %s: use at least %s, defaulting to %s", key, value, min, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// outboundConcurrency returns the OUTBOUND_CONCURRENCY setting. OUTBOUND_BANDWIDTH is split into
+// one share per running download, so a bandwidth limit needs a concurrency limit, and without
+// one it defaults to WORKER_CONCURRENCY, which is right for a single worker.
+func outboundConcurrency(concurrency int, bandwidth int64, workerConcurrency int) int {
+	if concurrency > 0 || bandwidth <= 0 {
+		return max(concurrency, 0)
+	}
+	log.Printf("Warning: OUTBOUND_BANDWIDTH needs OUTBOUND_CONCURRENCY, defaulting to WORKER_CONCURRENCY (%d)", workerConcurrency)
+	return max(workerConcurrency, 1)
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseCustomSources parses the JSON definition of the custom sources.
+// An invalid definition is ignored, so the server still starts with the built-in sources.
+func parseCustomSources(value string) []CustomSource {
+	if value == "" {
+		return nil
+	}
+	var sources []CustomSource
+	if err := json.Unmarshal([]byte(value), &sources); err != nil {
+		log.Printf("Warning: Ignoring invalid CUSTOM_SOURCES: %v", err)
+		return nil
+	}
+	return sources
+}
+
+// parseRateLimits parses rate limits like "download=30/1m,info=120/1m". Invalid limits are
+// ignored, and "none" disables rate limiting.
+func parseRateLimits(value string) map[string]RateLimit {
+	limits := make(map[string]RateLimit)
+	if strings.TrimSpace(value) == "none" {
+		return limits
+	}
+
+	for _, item := range splitList(value) {
+		name, definition, _ := strings.Cut(item, "=")
+		requests, window, _ := strings.Cut(definition, "/")
+		count, err := strconv.Atoi(strings.TrimSpace(requests))
+		if err != nil || count <= 0 {
+			log.Printf("Warning: Ignoring invalid rate limit %q: use e.g. download=30/1m", item)
+			continue
+		}
+		duration, err := time.ParseDuration(strings.TrimSpace(window))
+		if err != nil || duration <= 0 {
+			log.Printf("Warning: Ignoring invalid rate limit %q: use e.g. download=30/1m", item)
+			continue
+		}
+		limits[strings.TrimSpace(name)] = RateLimit{Requests: count, Window: duration}
+	}
+	return limits
+}
+
+// parseMonitoringMode checks the mode of the monitoring dashboard. An invalid mode turns the
+// dashboard off rather than exposing more of it than intended.
+func parseMonitoringMode(value string) string {
+	switch value {
+	case MonitoringFull, MonitoringReadOnly, MonitoringOff:
+		return value
+	}
+	log.Printf("Warning: Invalid MONITORING value %q (use %s, %s or %s), turning the dashboard off", value, MonitoringFull, MonitoringReadOnly, MonitoringOff)
+	return MonitoringOff
+}
+
+// monitoringMode returns the mode of the monitoring dashboard. Without a MONITORING setting, the
+// full dashboard is only mounted when it is protected, and a read-only one otherwise. Invalid
+// MONITORING_ALLOWED_NETWORKS turn the dashboard off rather than open it to every network.
+func monitoringMode(value string, protected bool, networksValid bool) string {
+	if !networksValid {
+		log.Println("Warning: Invalid MONITORING_ALLOWED_NETWORKS, turning the dashboard off")
+		return MonitoringOff
+	}
+	if value == "" {
+		if protected {
+			return MonitoringFull
+		}
+		log.Println("Warning: The monitoring dashboard is not protected, mounting it read-only (set MONITORING=full to allow its actions)")
+		return MonitoringReadOnly
+	}
+	return parseMonitoringMode(value)
+}
+
+// parseNetworks parses the comma separated IPs and CIDR networks of the setting key. It reports
+// whether every entry is valid, since a list missing some would allow other networks than meant,
+// or all of them when it ends up empty.
+func parseNetworks(key string, value string) ([]netip.Prefix, bool) {
+	var networks []netip.Prefix
+	valid := true
+	for _, item := range splitList(value) {
+		if network, err := netip.ParsePrefix(item); err == nil {
+			networks = append(networks, network.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			log.Printf("Warning: Invalid %s entry %q: use an IP or a CIDR network like 10.0.0.0/8", key, item)
+			valid = false
+			continue
+		}
+		networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return networks, valid
 }
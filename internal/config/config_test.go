@@ -1,7 +1,10 @@
 package config
 
 import (
+	"net/netip"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -93,6 +96,132 @@ func TestGetTaskRetentionFromEnv(t *testing.T) {
 	}
 }
 
+// TestGetDurationFromEnv tests the getDurationFromEnv helper function
+func TestGetDurationFromEnv(t *testing.T) {
+	originalTimeout := os.Getenv("DOWNLOAD_TIMEOUT")
+	defer os.Setenv("DOWNLOAD_TIMEOUT", originalTimeout)
+
+	tests := []struct {
+		name     string
+		envValue string
+		expected time.Duration
+	}{
+		{name: "Valid duration", envValue: "90m", expected: 90 * time.Minute},
+		{name: "Invalid format", envValue: "forever", expected: time.Hour},
+		{name: "Empty value", envValue: "", expected: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("DOWNLOAD_TIMEOUT", tt.envValue)
+			result := getDurationFromEnv("DOWNLOAD_TIMEOUT", time.Hour)
+			if result != tt.expected {
+				t.Errorf("getDurationFromEnv() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestGetIntFromEnv tests the getIntFromEnv helper function
+func TestGetIntFromEnv(t *testing.T) {
+	originalItems := os.Getenv("MAX_PLAYLIST_ITEMS")
+	defer os.Setenv("MAX_PLAYLIST_ITEMS", originalItems)
+
+	tests := []struct {
+		name     string
+		envValue string
+		expected int
+	}{
+		{name: "Valid number", envValue: "50", expected: 50},
+		{name: "Invalid format", envValue: "many", expected: 200},
+		{name: "Empty value", envValue: "", expected: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("MAX_PLAYLIST_ITEMS", tt.envValue)
+			result := getIntFromEnv("MAX_PLAYLIST_ITEMS", 200)
+			if result != tt.expected {
+				t.Errorf("getIntFromEnv() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestGetBoolFromEnv tests the getBoolFromEnv helper function
+func TestGetBoolFromEnv(t *testing.T) {
+	originalSSL := os.Getenv("S3_USE_SSL")
+	defer os.Setenv("S3_USE_SSL", originalSSL)
+
+	tests := []struct {
+		name     string
+		envValue string
+		expected bool
+	}{
+		{name: "False", envValue: "false", expected: false},
+		{name: "Numeric", envValue: "0", expected: false},
+		{name: "Invalid format", envValue: "nope", expected: true},
+		{name: "Empty value", envValue: "", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("S3_USE_SSL", tt.envValue)
+			result := getBoolFromEnv("S3_USE_SSL", true)
+			if result != tt.expected {
+				t.Errorf("getBoolFromEnv() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestSplitList tests the splitList helper function
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []string
+	}{
+		{value: "youtube", expected: []string{"youtube"}},
+		{value: " youtube, vimeo ,,soundcloud", expected: []string{"youtube", "vimeo", "soundcloud"}},
+		{value: "", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if result := splitList(tt.value); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("splitList(%q) = %v, want %v", tt.value, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestParseCustomSources tests the parseCustomSources helper function
+func TestParseCustomSources(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected []CustomSource
+	}{
+		{
+			name:  "Valid definition",
+			value: `[{"name": "conference", "hosts": ["recordings.example.com"], "args": ["--cookies", "/etc/cookies.txt"]}]`,
+			expected: []CustomSource{
+				{Name: "conference", Hosts: []string{"recordings.example.com"}, Args: []string{"--cookies", "/etc/cookies.txt"}},
+			},
+		},
+		{name: "Invalid JSON", value: `[{"name": `, expected: nil},
+		{name: "Empty value", value: "", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := parseCustomSources(tt.value); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("parseCustomSources() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
 // TestConfigFields tests that the Config struct contains the expected fields
 func TestConfigFields(t *testing.T) {
 	// Create a config with known values
@@ -163,3 +292,185 @@ func TestEnvironmentVariableOverrides(t *testing.T) {
 		}
 	})
 }
+
+// TestParseSize tests the ParseSize helper function
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int64
+		wantErr  bool
+	}{
+		{value: "0", expected: 0},
+		{value: "1024", expected: 1024},
+		{value: "500MB", expected: 500 << 20},
+		{value: "50 GB", expected: 50 << 30},
+		{value: "1.5tb", expected: 3 << 39},
+		{value: "10KB", expected: 10 << 10},
+		{value: "GB", wantErr: true},
+		{value: "5XB", wantErr: true},
+		{value: "-1GB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			result, err := ParseSize(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if result != tt.expected {
+				t.Errorf("ParseSize(%q) = %v, want %v", tt.value, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestParseSizeSetting tests that an invalid size setting is an error naming the setting
+func TestParseSizeSetting(t *testing.T) {
+	size, err := parseSizeSetting("MAX_STORAGE_SIZE", "50GB")
+	if err != nil || size != 50<<30 {
+		t.Fatalf("parseSizeSetting(50GB) = %v, %v, want %v", size, err, int64(50<<30))
+	}
+
+	_, err = parseSizeSetting("MAX_STORAGE_SIZE", "50GiB")
+	if err == nil || !strings.Contains(err.Error(), "MAX_STORAGE_SIZE") {
+		t.Errorf("parseSizeSetting(50GiB) error = %v, want an error naming MAX_STORAGE_SIZE", err)
+	}
+}
+
+// TestDurationAtLeast tests the durationAtLeast helper function
+func TestDurationAtLeast(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    time.Duration
+		expected time.Duration
+	}{
+		{name: "Longer", value: 10 * time.Second, expected: 10 * time.Second},
+		{name: "Minimum", value: time.Second, expected: time.Second},
+		{name: "Shorter", value: 2 * time.Nanosecond, expected: 30 * time.Second},
+		{name: "Zero", value: 0, expected: 30 * time.Second},
+		{name: "Negative", value: -time.Minute, expected: 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := durationAtLeast("DOWNLOAD_LOCK_TTL", tt.value, time.Second, 30*time.Second)
+			if result != tt.expected {
+				t.Errorf("durationAtLeast(%v) = %v, want %v", tt.value, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestOutboundConcurrency tests the outboundConcurrency helper function
+func TestOutboundConcurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		bandwidth   int64
+		expected    int
+	}{
+		{name: "Set", concurrency: 4, bandwidth: 1 << 20, expected: 4},
+		{name: "No limits", concurrency: 0, bandwidth: 0, expected: 0},
+		{name: "Negative", concurrency: -1, bandwidth: 0, expected: 0},
+		{name: "Bandwidth without concurrency", concurrency: 0, bandwidth: 1 << 20, expected: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := outboundConcurrency(tt.concurrency, tt.bandwidth, 10)
+			if result != tt.expected {
+				t.Errorf("outboundConcurrency(%d, %d) = %d, want %d", tt.concurrency, tt.bandwidth, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestParseRateLimits tests the parseRateLimits helper function
+func TestParseRateLimits(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected map[string]RateLimit
+	}{
+		{value: "download=30/1m", expected: map[string]RateLimit{"download": {Requests: 30, Window: time.Minute}}},
+		{
+			value: " download = 30/1m, info=120/30s ",
+			expected: map[string]RateLimit{
+				"download": {Requests: 30, Window: time.Minute},
+				"info":     {Requests: 120, Window: 30 * time.Second},
+			},
+		},
+		{value: "download=many/1m,info=10,videos=0/1m,shares=5/1m", expected: map[string]RateLimit{"shares": {Requests: 5, Window: time.Minute}}},
+		{value: "none", expected: map[string]RateLimit{}},
+		{value: "", expected: map[string]RateLimit{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if result := parseRateLimits(tt.value); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("parseRateLimits(%q) = %v, want %v", tt.value, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestParseMonitoringMode tests the parseMonitoringMode helper function
+func TestParseMonitoringMode(t *testing.T) {
+	tests := map[string]string{
+		"full":      MonitoringFull,
+		"read-only": MonitoringReadOnly,
+		"off":       MonitoringOff,
+		"readonly":  MonitoringOff,
+		"":          MonitoringOff,
+	}
+	for value, expected := range tests {
+		if result := parseMonitoringMode(value); result != expected {
+			t.Errorf("parseMonitoringMode(%q) = %q, want %q", value, result, expected)
+		}
+	}
+}
+
+// TestParseNetworks tests the parseNetworks helper function
+func TestParseNetworks(t *testing.T) {
+	networks, valid := parseNetworks("MONITORING_ALLOWED_NETWORKS", "10.0.0.0/8, 192.168.1.7, 10.1.2.3/16, not-an-ip, ::1")
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.7/32"),
+		netip.MustParsePrefix("10.1.0.0/16"),
+		netip.MustParsePrefix("::1/128"),
+	}
+	if !reflect.DeepEqual(networks, expected) {
+		t.Errorf("parseNetworks() = %v, want %v", networks, expected)
+	}
+	if valid {
+		t.Error("parseNetworks() reported an invalid entry as valid")
+	}
+	if networks, valid := parseNetworks("MONITORING_ALLOWED_NETWORKS", ""); len(networks) != 0 || !valid {
+		t.Errorf("parseNetworks(\"\") = %v, %t, want none", networks, valid)
+	}
+}
+
+// TestMonitoringMode tests the monitoringMode helper function
+func TestMonitoringMode(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		protected     bool
+		networksValid bool
+		expected      string
+	}{
+		{name: "Protected default", value: "", protected: true, networksValid: true, expected: MonitoringFull},
+		{name: "Unprotected default", value: "", protected: false, networksValid: true, expected: MonitoringReadOnly},
+		{name: "Explicit full", value: "full", protected: false, networksValid: true, expected: MonitoringFull},
+		{name: "Invalid networks", value: "full", protected: true, networksValid: false, expected: MonitoringOff},
+		{name: "Invalid mode", value: "readonly", protected: true, networksValid: true, expected: MonitoringOff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := monitoringMode(tt.value, tt.protected, tt.networksValid)
+			if result != tt.expected {
+				t.Errorf("monitoringMode(%q, %t, %t) = %q, want %q", tt.value, tt.protected, tt.networksValid, result, tt.expected)
+			}
+		})
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"spiropoulos94/youtube-downloader/internal/config"
 	"spiropoulos94/youtube-downloader/internal/handlers"
+	"spiropoulos94/youtube-downloader/internal/middleware"
 	"spiropoulos94/youtube-downloader/internal/router"
 	"spiropoulos94/youtube-downloader/internal/services"
+	"spiropoulos94/youtube-downloader/internal/storage"
 	"spiropoulos94/youtube-downloader/internal/validators"
 	"spiropoulos94/youtube-downloader/internal/workers"
 
@@ -18,6 +20,7 @@ type Container struct {
 	config        *config.Config
 	services      *services.Services
 	handlers      *handlers.Handlers
+	middlewares   *middleware.Middlewares
 	router        *router.Router
 	server        *http.Server
 	workerManager *workers.Manager
@@ -26,8 +29,18 @@ type Container struct {
 
 // InitContainer Initializes the container with configuration and Builds it
 func InitContainer() (*Container, error) {
-	cfg := config.Load()
-	container := NewContainer(cfg)
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect to the storage backend, creating its bucket if needed
+	store, err := storage.New(context.Background(), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up %s storage: %v", cfg.StorageBackend, err)
+	}
+
+	container := NewContainer(cfg, store)
 
 	// Check Redis connectivity
 	if err := container.redis.Ping(context.Background()).Err(); err != nil {
@@ -41,37 +54,68 @@ func InitContainer() (*Container, error) {
 }
 
 // NewContainer creates a new container with the given configuration and dependencies
-func NewContainer(config *config.Config) *Container {
+func NewContainer(config *config.Config, store storage.StoreInterface) *Container {
 	// Create Redis client for services that might still need direct access
 	redis := redis.NewClient(&redis.Options{
 		Addr: config.RedisAddr,
 	})
 
 	// Create core services
-	youtubeService := services.NewYouTubeService(config, redis)
-	cleanupService := services.NewCleanupService(config, redis)
+	mediaIndex := services.NewMediaIndex(redis)
+	fileLeases := services.NewFileLeases(redis, config.FileLeaseTTL)
+	rateLimiter := services.NewRateLimiter(redis)
+	outboundLimiter := services.NewOutboundLimiter(config, redis, rateLimiter)
+	youtubeService := services.NewYouTubeService(config, redis, store, mediaIndex, fileLeases, outboundLimiter)
+	cleanupService := services.NewCleanupService(config, redis, store, mediaIndex, fileLeases)
 	frontendService := services.NewFrontendService()
+	taskService := services.NewTaskService(redis)
+	subscriptionService := services.NewSubscriptionService(redis)
+	shareService := services.NewShareService(redis)
+	apiKeyService := services.NewAPIKeyService(redis)
 
 	// Create worker manager with dependencies
-	workerManager := workers.NewManager(config, youtubeService)
+	workerManager := workers.NewManager(config, youtubeService, taskService, subscriptionService, apiKeyService)
 
 	// Create validators
-	urlValidator := validators.NewYouTubeURLValidator()
+	urlValidator := validators.NewSourceRegistry(config)
 
 	// Create handlers with direct dependencies
 	youtubeHandler := handlers.NewYouTubeHandler(
 		config,
 		youtubeService,
+		taskService,
 		workerManager.GetClient(),
 		workerManager.GetInspector(),
 		urlValidator,
+		store,
+		shareService,
+		apiKeyService,
 	)
+	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService, workerManager.GetClient())
+	adminHandler := handlers.NewAdminHandler(youtubeService, cleanupService, mediaIndex)
 	frontendHandler := handlers.NewFrontendHandler(frontendService)
 
 	return &Container{
-		config:        config,
-		services:      &services.Services{YouTube: youtubeService, Cleanup: cleanupService, Frontend: frontendService},
-		handlers:      &handlers.Handlers{YouTube: youtubeHandler, Frontend: frontendHandler},
+		config: config,
+		services: &services.Services{
+			YouTube:      youtubeService,
+			Cleanup:      cleanupService,
+			Frontend:     frontendService,
+			Task:         taskService,
+			Subscription: subscriptionService,
+			MediaIndex:   mediaIndex,
+			FileLeases:   fileLeases,
+			Share:        shareService,
+			APIKey:       apiKeyService,
+			RateLimiter:  rateLimiter,
+			Outbound:     outboundLimiter,
+		},
+		handlers: &handlers.Handlers{YouTube: youtubeHandler, Subscription: subscriptionHandler, Admin: adminHandler, Frontend: frontendHandler},
+		middlewares: &middleware.Middlewares{
+			Auth:       middleware.NewAuthMiddleware(config, apiKeyService),
+			RateLimit:  middleware.NewRateLimitMiddleware(config, rateLimiter),
+			Monitoring: middleware.NewMonitoringMiddleware(config, apiKeyService),
+		},
 		workerManager: workerManager,
 		redis:         redis,
 	}
@@ -80,7 +124,7 @@ func NewContainer(config *config.Config) *Container {
 // Build builds the container for the HTTP server and workers
 func (c *Container) Build() error {
 	// Initialize router
-	c.router = router.BuildRouter(c.handlers, c.workerManager)
+	c.router = router.BuildRouter(c.config, c.handlers, c.middlewares, c.workerManager)
 
 	// Initialize server
 	c.server = &http.Server{
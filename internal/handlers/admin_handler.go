@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminHandler implements AdminHandlerInterface
+type AdminHandler struct {
+	youtubeService services.YouTubeServiceInterface
+	cleanupService services.CleanupServiceInterface
+	index          services.MediaIndexInterface
+}
+
+// NewAdminHandler creates a new instance of AdminHandler
+func NewAdminHandler(
+	youtubeService services.YouTubeServiceInterface,
+	cleanupService services.CleanupServiceInterface,
+	index services.MediaIndexInterface,
+) AdminHandlerInterface {
+	return &AdminHandler{
+		youtubeService: youtubeService,
+		cleanupService: cleanupService,
+		index:          index,
+	}
+}
+
+// PinResponse is the response of the video pinning endpoints
+type PinResponse struct {
+	URLHash  string `json:"url_hash"`
+	FilePath string `json:"file_path"`
+	Pinned   bool   `json:"pinned"`
+}
+
+// PurgeResponse is the response of the video purge endpoint
+type PurgeResponse struct {
+	URLHash  string `json:"url_hash"`
+	FilePath string `json:"file_path"`
+}
+
+// RunCleanup runs a cleanup pass now. With ?dry_run=true nothing is deleted, and the response
+// lists the files the pass would delete.
+func (h *AdminHandler) RunCleanup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			httputils.SendError(w, httputils.NewError(http.StatusBadRequest, "Invalid dry_run value"))
+			return
+		}
+	}
+
+	report, err := h.cleanupService.RunCleanup(r.Context(), dryRun)
+	if err != nil {
+		log.Printf("Failed to run cleanup: DryRun=%t, Error=%v", dryRun, err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+
+	log.Printf("Cleanup run by an admin: DryRun=%t, Files=%d, Freed=%d bytes", dryRun, len(report.Files), report.FreedBytes)
+	httputils.SendJSON(w, http.StatusOK, report)
+}
+
+// ListVideos lists the stored videos of the media index, most recently downloaded first. With
+// ?video_id= only the files of that video are listed, one per downloaded format.
+func (h *AdminHandler) ListVideos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	entries, err := h.index.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list videos: %v", err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+
+	if videoID := r.URL.Query().Get("video_id"); videoID != "" {
+		entries = slices.DeleteFunc(entries, func(entry *services.MediaEntry) bool {
+			return !isVideo(entry, videoID)
+		})
+	}
+	slices.SortFunc(entries, func(a, b *services.MediaEntry) int {
+		return b.IndexedAt.Compare(a.IndexedAt)
+	})
+	httputils.SendJSON(w, http.StatusOK, entries)
+}
+
+// isVideo reports whether an entry is a download of a video ID. Video keys are the bare ID for
+// YouTube and the ID prefixed with its source otherwise, e.g. vimeo:76979871.
+func isVideo(entry *services.MediaEntry, videoID string) bool {
+	return entry.VideoKey == videoID || strings.HasSuffix(entry.VideoKey, ":"+videoID)
+}
+
+// PinVideo exempts the file of a video hash from eviction and expiry (PUT), or makes it subject
+// to them again (DELETE)
+func (h *AdminHandler) PinVideo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	urlHash := chi.URLParam(r, "url_hash")
+	if urlHash == "" {
+		httputils.SendError(w, httputils.ErrMissingVideoHash)
+		return
+	}
+
+	pinned := r.Method == http.MethodPut
+	entry, err := h.youtubeService.SetPinned(r.Context(), urlHash, pinned)
+	if errors.Is(err, services.ErrFileNotIndexed) {
+		httputils.SendError(w, httputils.ErrVideoNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to pin video: Hash=%s, Error=%v", urlHash, err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+
+	log.Printf("Video pinned=%t: Hash=%s, File=%s", pinned, urlHash, entry.FilePath)
+	httputils.SendJSON(w, http.StatusOK, PinResponse{URLHash: urlHash, FilePath: entry.FilePath, Pinned: pinned})
+}
+
+// PurgeVideo deletes the file of a video hash along with its Redis keys, even if it is pinned.
+// Files that are being served or downloaded are not deleted.
+func (h *AdminHandler) PurgeVideo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	urlHash := chi.URLParam(r, "url_hash")
+	if urlHash == "" {
+		httputils.SendError(w, httputils.ErrMissingVideoHash)
+		return
+	}
+
+	entry, err := h.index.Get(r.Context(), urlHash)
+	if err != nil {
+		log.Printf("Failed to look up video: Hash=%s, Error=%v", urlHash, err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+	if entry == nil {
+		httputils.SendError(w, httputils.ErrVideoNotFound)
+		return
+	}
+
+	err = h.cleanupService.PurgeFile(r.Context(), entry.FilePath)
+	if errors.Is(err, services.ErrFileHeld) {
+		httputils.SendError(w, httputils.NewError(http.StatusConflict, "Video is being served or downloaded, try again later"))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to purge video: Hash=%s, Error=%v", urlHash, err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+
+	log.Printf("Video purged: Hash=%s, File=%s", urlHash, entry.FilePath)
+	httputils.SendJSON(w, http.StatusOK, PurgeResponse{URLHash: urlHash, FilePath: entry.FilePath})
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockCleanupService is a CleanupServiceInterface recording the runs it is asked for
+type mockCleanupService struct {
+	mock.Mock
+}
+
+func (m *mockCleanupService) Start() {}
+
+func (m *mockCleanupService) Stop() {}
+
+func (m *mockCleanupService) RunCleanup(ctx context.Context, dryRun bool) (*services.CleanupReport, error) {
+	args := m.Called(dryRun)
+	return args.Get(0).(*services.CleanupReport), args.Error(1)
+}
+
+func (m *mockCleanupService) PurgeFile(ctx context.Context, filePath string) error {
+	return m.Called(filePath).Error(0)
+}
+
+func TestRunCleanup(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		dryRun     bool
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "Run", method: http.MethodPost, wantStatus: http.StatusOK, wantBody: `"dry_run":false`},
+		{name: "Dry run", method: http.MethodPost, query: "?dry_run=true", dryRun: true, wantStatus: http.StatusOK, wantBody: `"freed_bytes":1024`},
+		{name: "Invalid dry run", method: http.MethodPost, query: "?dry_run=maybe", wantStatus: http.StatusBadRequest, wantBody: "Invalid dry_run value"},
+		{name: "Method not allowed", method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed, wantBody: "Method not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanupService := new(mockCleanupService)
+			files := []services.CleanedFile{{FilePath: "downloads/Old Video_0123456789abcdef.mp4", Size: 1024, Reason: "not requested for 24h0m0s"}}
+			cleanupService.On("RunCleanup", tt.dryRun).Return(&services.CleanupReport{DryRun: tt.dryRun, Files: files, FreedBytes: 1024}, nil)
+			handler := &AdminHandler{cleanupService: cleanupService}
+
+			req := httptest.NewRequest(tt.method, "/api/admin/cleanup"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.RunCleanup(w, req)
+
+			resp := w.Result()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Contains(t, string(body), tt.wantBody)
+			if tt.wantStatus == http.StatusOK {
+				cleanupService.AssertCalled(t, "RunCleanup", tt.dryRun)
+			} else {
+				cleanupService.AssertNotCalled(t, "RunCleanup", mock.Anything)
+			}
+		})
+	}
+}
+
+// memoryVideos is a MediaIndexInterface serving entries from memory
+type memoryVideos struct {
+	services.MediaIndexInterface
+	entries []*services.MediaEntry
+}
+
+func (i *memoryVideos) Get(ctx context.Context, urlHash string) (*services.MediaEntry, error) {
+	for _, entry := range i.entries {
+		if entry.URLHash == urlHash {
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+func (i *memoryVideos) List(ctx context.Context) ([]*services.MediaEntry, error) {
+	return slices.Clone(i.entries), nil
+}
+
+func TestListVideos(t *testing.T) {
+	now := time.Now()
+	index := &memoryVideos{entries: []*services.MediaEntry{
+		{URLHash: "0000000000000001", VideoKey: "dQw4w9WgXcQ", IndexedAt: now.Add(-time.Hour)},
+		{URLHash: "0000000000000002", VideoKey: "vimeo:76979871", IndexedAt: now},
+		{URLHash: "0000000000000003", VideoKey: "dQw4w9WgXcQ", Format: "audio", IndexedAt: now.Add(-time.Minute)},
+	}}
+	handler := &AdminHandler{index: index}
+
+	list := func(query string) []string {
+		w := httptest.NewRecorder()
+		handler.ListVideos(w, httptest.NewRequest(http.MethodGet, "/api/admin/videos"+query, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data []services.MediaEntry `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		var hashes []string
+		for _, entry := range response.Data {
+			hashes = append(hashes, entry.URLHash)
+		}
+		return hashes
+	}
+
+	assert.Equal(t, []string{"0000000000000002", "0000000000000003", "0000000000000001"}, list(""))
+	assert.Equal(t, []string{"0000000000000003", "0000000000000001"}, list("?video_id=dQw4w9WgXcQ"))
+	assert.Equal(t, []string{"0000000000000002"}, list("?video_id=76979871"))
+	assert.Empty(t, list("?video_id=unknown"))
+}
+
+func TestPurgeVideo(t *testing.T) {
+	// The video is found through the media index, without the task that downloaded it
+	index := &memoryVideos{entries: []*services.MediaEntry{
+		{URLHash: "0123456789abcdef", FilePath: "/downloads/Test Video_0123456789abcdef.mp4"},
+	}}
+	cleanupService := new(mockCleanupService)
+	cleanupService.On("PurgeFile", "/downloads/Test Video_0123456789abcdef.mp4").Return(nil)
+	handler := &AdminHandler{cleanupService: cleanupService, index: index}
+
+	purge := func(urlHash string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/admin/videos/"+urlHash, nil)
+		req = withURLParams(req, map[string]string{"url_hash": urlHash})
+		w := httptest.NewRecorder()
+		handler.PurgeVideo(w, req)
+		return w
+	}
+
+	w := purge("0123456789abcdef")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"file_path":"/downloads/Test Video_0123456789abcdef.mp4"`)
+	cleanupService.AssertCalled(t, "PurgeFile", "/downloads/Test Video_0123456789abcdef.mp4")
+
+	w = purge("fedcba9876543210")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "Video not found")
+}
+
+func TestPinVideoValidation(t *testing.T) {
+	// Create a handler with nil dependencies
+	handler := &AdminHandler{}
+
+	tests := []struct {
+		name       string
+		method     string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "Method not allowed", method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed, wantError: "Method not allowed"},
+		{name: "Missing video hash", method: http.MethodPut, wantStatus: http.StatusBadRequest, wantError: "Missing video hash"},
+		{name: "Missing video hash on unpin", method: http.MethodDelete, wantStatus: http.StatusBadRequest, wantError: "Missing video hash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/admin/videos//pin", nil)
+			w := httptest.NewRecorder()
+
+			handler.PinVideo(w, req)
+
+			resp := w.Result()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Contains(t, string(body), tt.wantError)
+		})
+	}
+}
+
+func TestPurgeVideoValidation(t *testing.T) {
+	// Create a handler with nil dependencies
+	handler := &AdminHandler{}
+
+	tests := []struct {
+		name       string
+		method     string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "Method not allowed", method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed, wantError: "Method not allowed"},
+		{name: "Missing video hash", method: http.MethodDelete, wantStatus: http.StatusBadRequest, wantError: "Missing video hash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/admin/videos/", nil)
+			w := httptest.NewRecorder()
+
+			handler.PurgeVideo(w, req)
+
+			resp := w.Result()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Contains(t, string(body), tt.wantError)
+		})
+	}
+}
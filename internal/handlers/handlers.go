@@ -1,6 +1,8 @@
 package handlers
 
 type Handlers struct {
-	YouTube  YouTubeHandlerInterface
-	Frontend FrontendHandlerInterface
+	YouTube      YouTubeHandlerInterface
+	Subscription SubscriptionHandlerInterface
+	Admin        AdminHandlerInterface
+	Frontend     FrontendHandlerInterface
 }
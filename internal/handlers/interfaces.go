@@ -7,8 +7,36 @@ import (
 // YouTubeHandlerInterface defines the contract for YouTube-related HTTP handlers
 type YouTubeHandlerInterface interface {
 	DownloadVideo(w http.ResponseWriter, r *http.Request)
+	GetVideoInfo(w http.ResponseWriter, r *http.Request)
 	GetTaskStatus(w http.ResponseWriter, r *http.Request)
+	CancelTask(w http.ResponseWriter, r *http.Request)
 	ServeVideo(w http.ResponseWriter, r *http.Request)
+	StreamTaskEvents(w http.ResponseWriter, r *http.Request)
+	StreamMultiTaskEvents(w http.ResponseWriter, r *http.Request)
+	GetPlaylistStatus(w http.ResponseWriter, r *http.Request)
+	DownloadPlaylistZip(w http.ResponseWriter, r *http.Request)
+	CreateShare(w http.ResponseWriter, r *http.Request)
+	ListShares(w http.ResponseWriter, r *http.Request)
+	RevokeShare(w http.ResponseWriter, r *http.Request)
+	ServeShare(w http.ResponseWriter, r *http.Request)
+}
+
+// SubscriptionHandlerInterface defines the contract for the subscription HTTP handlers
+type SubscriptionHandlerInterface interface {
+	CreateSubscription(w http.ResponseWriter, r *http.Request)
+	ListSubscriptions(w http.ResponseWriter, r *http.Request)
+	GetSubscription(w http.ResponseWriter, r *http.Request)
+	UpdateSubscription(w http.ResponseWriter, r *http.Request)
+	DeleteSubscription(w http.ResponseWriter, r *http.Request)
+	SyncSubscription(w http.ResponseWriter, r *http.Request)
+}
+
+// AdminHandlerInterface defines the contract for the admin HTTP handlers managing stored videos
+type AdminHandlerInterface interface {
+	RunCleanup(w http.ResponseWriter, r *http.Request)
+	ListVideos(w http.ResponseWriter, r *http.Request)
+	PinVideo(w http.ResponseWriter, r *http.Request)
+	PurgeVideo(w http.ResponseWriter, r *http.Request)
 }
 
 // FrontendHandlerInterface defines the contract for frontend-related HTTP handlers
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/storage"
+	"spiropoulos94/youtube-downloader/internal/tasks"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hibiken/asynq"
+)
+
+// PlaylistStatusResponse is the aggregate state of a playlist and the tasks downloading its videos
+type PlaylistStatusResponse struct {
+	Status    tasks.TaskStatus     `json:"status"`
+	Title     string               `json:"title,omitempty"`
+	Error     string               `json:"error,omitempty"`
+	Total     int                  `json:"total"`     // Number of videos in the playlist
+	Completed int                  `json:"completed"` // Videos downloaded successfully
+	Failed    int                  `json:"failed"`
+	Cancelled int                  `json:"cancelled"`
+	Percent   float64              `json:"percent"` // Overall progress, finished videos count as 100%
+	ZipURL    string               `json:"zip_url,omitempty"`
+	Items     []TaskStatusResponse `json:"items"`
+	Skipped   []tasks.PlaylistItem `json:"skipped,omitempty"` // Videos not downloaded because the API key used up its daily quota
+}
+
+// enqueuePlaylist enqueues a task that expands the playlist into one download task per video
+func (h *YouTubeHandler) enqueuePlaylist(w http.ResponseWriter, r *http.Request, req DownloadRequest, timeout time.Duration) {
+	task, err := tasks.NewPlaylistDownloadTask(req.URL, req.DownloadOptions, timeout, submittedBy(r.Context()))
+	if err != nil {
+		httputils.SendError(w, httputils.NewError(http.StatusInternalServerError, "Failed to create task"))
+		return
+	}
+
+	info, err := h.asynqClient.Enqueue(task, asynq.Retention(h.config.TaskRetention))
+	if err != nil {
+		httputils.SendError(w, httputils.NewError(http.StatusInternalServerError, "Failed to enqueue task"))
+		return
+	}
+
+	log.Printf("Playlist task enqueued: ID=%s, URL=%s, Format=%q, Timeout: %s, Retention: %s", info.ID, req.URL, req.DownloadOptions.CacheKey(), timeout, h.config.TaskRetention)
+	httputils.SendJSON(w, http.StatusAccepted, DownloadResponse{TaskID: info.ID, Playlist: true})
+}
+
+// GetPlaylistStatus reports the progress of a playlist download across all of its videos
+func (h *YouTubeHandler) GetPlaylistStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	taskID := chi.URLParam(r, "task_id")
+	if taskID == "" {
+		httputils.SendError(w, httputils.ErrMissingTaskID)
+		return
+	}
+
+	playlist, err := h.getOwnedPlaylistPayload(r.Context(), taskID)
+	if err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	response := PlaylistStatusResponse{
+		Status:  playlist.Status,
+		Title:   playlist.Title,
+		Error:   playlist.Error,
+		Total:   len(playlist.Items),
+		Items:   make([]TaskStatusResponse, 0, len(playlist.Items)),
+		Skipped: playlist.Skipped,
+	}
+
+	var progressSum float64
+	for _, item := range playlist.Items {
+		itemResponse := h.playlistItemStatus(r, item)
+		response.Items = append(response.Items, itemResponse)
+
+		switch itemResponse.Status {
+		case tasks.TaskStatusCompleted:
+			response.Completed++
+		case tasks.TaskStatusFailed:
+			response.Failed++
+		case tasks.TaskStatusCancelled:
+			response.Cancelled++
+		}
+
+		if itemResponse.Status.IsTerminal() {
+			progressSum += 100
+		} else if itemResponse.Progress != nil {
+			progressSum += itemResponse.Progress.Percent
+		}
+	}
+
+	// Once the playlist has been expanded, its status follows the videos
+	if playlist.Status == tasks.TaskStatusCompleted {
+		response.Status = aggregatePlaylistStatus(response)
+	}
+	if response.Total > 0 {
+		response.Percent = progressSum / float64(response.Total)
+	}
+	if response.Completed > 0 {
+		response.ZipURL = h.absoluteURL(r, fmt.Sprintf("/api/playlists/%s/zip", taskID))
+	}
+
+	httputils.SendJSON(w, http.StatusOK, response)
+}
+
+// aggregatePlaylistStatus derives the status of an expanded playlist from the counts of its videos:
+// it is processing until every video finished, and failed only if none was downloaded
+func aggregatePlaylistStatus(response PlaylistStatusResponse) tasks.TaskStatus {
+	if response.Completed+response.Failed+response.Cancelled < response.Total {
+		return tasks.TaskStatusProcessing
+	}
+	if response.Completed == 0 && response.Total > 0 {
+		return tasks.TaskStatusFailed
+	}
+	return tasks.TaskStatusCompleted
+}
+
+// DownloadPlaylistZip streams a ZIP archive of every video of the playlist downloaded so far
+func (h *YouTubeHandler) DownloadPlaylistZip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	taskID := chi.URLParam(r, "task_id")
+	if taskID == "" {
+		httputils.SendError(w, httputils.ErrMissingTaskID)
+		return
+	}
+
+	playlist, err := h.getOwnedPlaylistPayload(r.Context(), taskID)
+	if err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	if err := h.checkByteQuota(r.Context()); err != nil {
+		sendQuotaError(w, err)
+		return
+	}
+
+	// Collect the finished files before writing anything, so an empty playlist still gets a JSON error
+	type zipEntry struct {
+		name string
+		path string
+	}
+	var entries []zipEntry
+	for i, item := range playlist.Items {
+		payload, err := h.getTaskPayload(r.Context(), item.TaskID)
+		if err != nil || payload.Status != tasks.TaskStatusCompleted || payload.FilePath == "" {
+			continue
+		}
+		filePath, err := h.resolveFilePath(r.Context(), payload)
+		if err != nil {
+			log.Printf("Skipping missing playlist file: ID=%s, File=%s, Error=%v", item.TaskID, payload.FilePath, err)
+			continue
+		}
+		// Prefix the playlist position so the archive keeps the playlist order
+		name := fmt.Sprintf("%03d - %s", i+1, h.youtubeService.GetOriginalFilename(filePath, false))
+		entries = append(entries, zipEntry{name: name, path: filePath})
+	}
+
+	if len(entries) == 0 {
+		httputils.SendError(w, httputils.NewError(http.StatusBadRequest, "No videos of this playlist have been downloaded yet"))
+		return
+	}
+
+	archiveName := playlist.Title
+	if archiveName == "" {
+		archiveName = "playlist"
+	}
+	archiveName = strings.ReplaceAll(archiveName, `"`, `\"`) + ".zip"
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, archiveName))
+	w.Header().Set("Content-Type", "application/zip")
+
+	log.Printf("Serving playlist archive: ID=%s, Files=%d", taskID, len(entries))
+
+	// Count the archive against the API key's byte quota
+	counter := httputils.NewCleanupResponseWriter(w, func(status int, written int64) {
+		h.recordServedBytes(context.WithoutCancel(r.Context()), written)
+	})
+	defer counter.Close()
+
+	archive := zip.NewWriter(counter)
+	for _, entry := range entries {
+		if err := h.addStoredFileToZip(r.Context(), archive, entry.name, entry.path); err != nil {
+			// The response has already started, so all we can do is stop
+			log.Printf("Failed to add file to playlist archive: ID=%s, File=%s, Error=%v", taskID, entry.path, err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("Failed to finish playlist archive: ID=%s, Error=%v", taskID, err)
+	}
+}
+
+// addStoredFileToZip copies a stored file into the archive
+func (h *YouTubeHandler) addStoredFileToZip(ctx context.Context, archive *zip.Writer, name string, path string) error {
+	// Keep the cleanup service from deleting the file while it is added
+	release, err := h.youtubeService.HoldFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	file, fileInfo, err := h.store.Open(ctx, storage.Key(path))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return addFileToZip(archive, name, file, fileInfo.ModTime)
+}
+
+// addFileToZip copies a file into the archive without compressing it, since media files
+// are already compressed
+func addFileToZip(archive *zip.Writer, name string, file io.Reader, modified time.Time) error {
+	writer, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+// getOwnedPlaylistPayload returns the latest state of a playlist task the request's API key may
+// manage, and reports other playlists as not found
+func (h *YouTubeHandler) getOwnedPlaylistPayload(ctx context.Context, taskID string) (*tasks.PlaylistDownloadPayload, error) {
+	info, err := h.asynqInspector.GetTaskInfo("default", taskID)
+	if err != nil || info.Type != tasks.TypePlaylistDownload {
+		log.Printf("Playlist task not found: ID=%s", taskID)
+		return nil, httputils.ErrNotFound
+	}
+	return h.ownedPlaylist(ctx, taskID, info)
+}
+
+// ownedPlaylist reads the state of a playlist task from its task info, and reports playlists
+// the request's API key may not manage as not found
+func (h *YouTubeHandler) ownedPlaylist(ctx context.Context, taskID string, info *asynq.TaskInfo) (*tasks.PlaylistDownloadPayload, error) {
+	data := info.Result
+	if len(data) == 0 {
+		data = info.Payload
+	}
+
+	var payload tasks.PlaylistDownloadPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("Failed to parse playlist result: ID=%s, Error=%v", taskID, err)
+		return nil, httputils.ErrInternalServer
+	}
+	if !h.canManageTask(ctx, taskID, payload.APIKeyID) {
+		log.Printf("Playlist of another API key: ID=%s, Key=%s", taskID, submittedBy(ctx))
+		return nil, httputils.ErrNotFound
+	}
+	return &payload, nil
+}
+
+// playlistItemStatus returns the status of the task downloading a playlist video.
+// Items whose task can't be read anymore are reported as failed.
+func (h *YouTubeHandler) playlistItemStatus(r *http.Request, item tasks.PlaylistItem) TaskStatusResponse {
+	payload, err := h.getTaskPayload(r.Context(), item.TaskID)
+	if err != nil {
+		return TaskStatusResponse{
+			TaskID: item.TaskID,
+			Status: tasks.TaskStatusFailed,
+			Error:  err.Error(),
+			Title:  item.Title,
+		}
+	}
+
+	response := h.newTaskStatusResponse(r, item.TaskID, payload)
+	response.TaskID = item.TaskID
+	if response.Title == "" {
+		// The title is only known from the listing until the download starts
+		response.Title = item.Title
+	}
+	return response
+}
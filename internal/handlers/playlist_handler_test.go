@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"spiropoulos94/youtube-downloader/internal/storage"
+	"spiropoulos94/youtube-downloader/internal/tasks"
+	"testing"
+
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaylistHandlersValidation(t *testing.T) {
+	// Create a handler with nil dependencies
+	handler := &YouTubeHandler{}
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		method     string
+		wantStatus int
+	}{
+		{name: "status method not allowed", handler: handler.GetPlaylistStatus, method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed},
+		{name: "status missing ID", handler: handler.GetPlaylistStatus, method: http.MethodGet, wantStatus: http.StatusBadRequest},
+		{name: "zip method not allowed", handler: handler.DownloadPlaylistZip, method: http.MethodDelete, wantStatus: http.StatusMethodNotAllowed},
+		{name: "zip missing ID", handler: handler.DownloadPlaylistZip, method: http.MethodGet, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/playlists/", nil)
+			w := httptest.NewRecorder()
+
+			tt.handler(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+// Playlists of another API key are reported as not found, by both the status and ZIP handlers
+func TestOwnedPlaylist(t *testing.T) {
+	payload, err := json.Marshal(tasks.PlaylistDownloadPayload{URL: "https://www.youtube.com/playlist?list=PL1", APIKeyID: "owner"})
+	require.NoError(t, err)
+	info := &asynq.TaskInfo{Type: tasks.TypePlaylistDownload, Payload: payload}
+	handler := &YouTubeHandler{
+		taskLookup: newTaskLookup(nil, &transferTaskService{callers: map[string]bool{"attached": true}}, nil, nil),
+	}
+
+	tests := []struct {
+		name    string
+		apiKey  *services.APIKey
+		wantErr error
+	}{
+		{"Authentication disabled", nil, nil},
+		{"Owner", &services.APIKey{ID: "owner"}, nil},
+		{"Attached caller", &services.APIKey{ID: "attached"}, nil},
+		{"Admin", &services.APIKey{ID: "admin", Admin: true}, nil},
+		{"Other key", &services.APIKey{ID: "other"}, httputils.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.apiKey != nil {
+				ctx = services.WithAPIKey(ctx, tt.apiKey)
+			}
+			playlist, err := handler.ownedPlaylist(ctx, "playlist", info)
+			assert.Equal(t, tt.wantErr, err)
+			if tt.wantErr == nil {
+				assert.Equal(t, "owner", playlist.APIKeyID)
+			}
+		})
+	}
+}
+
+func TestAggregatePlaylistStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		response PlaylistStatusResponse
+		want     tasks.TaskStatus
+	}{
+		{name: "videos still running", response: PlaylistStatusResponse{Total: 3, Completed: 1, Failed: 1}, want: tasks.TaskStatusProcessing},
+		{name: "all done with failures", response: PlaylistStatusResponse{Total: 3, Completed: 2, Failed: 1}, want: tasks.TaskStatusCompleted},
+		{name: "nothing downloaded", response: PlaylistStatusResponse{Total: 2, Failed: 1, Cancelled: 1}, want: tasks.TaskStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, aggregatePlaylistStatus(tt.response))
+		})
+	}
+}
+
+func TestAddStoredFileToZip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "video_0123456789abcdef.mp4")
+	require.NoError(t, os.WriteFile(path, []byte("test video content"), 0644))
+	store := storage.NewLocalStore(dir)
+	handler := &YouTubeHandler{taskLookup: taskLookup{
+		youtubeService: services.NewYouTubeService(&config.Config{OutputDir: dir}, nil, store, nil, nil, nil),
+		store:          store,
+	}}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	require.NoError(t, handler.addStoredFileToZip(context.Background(), archive, "001 - video.mp4", path))
+	require.NoError(t, archive.Close())
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, reader.File, 1)
+	assert.Equal(t, "001 - video.mp4", reader.File[0].Name)
+	assert.Equal(t, zip.Store, reader.File[0].Method)
+
+	file, err := reader.File[0].Open()
+	require.NoError(t, err)
+	defer file.Close()
+	content, _ := io.ReadAll(file)
+	assert.Equal(t, "test video content", string(content))
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"strconv"
+	"time"
+)
+
+// claimDownloadQuota counts a download request against the daily quotas of the request's API key.
+// Requests without a key, while authentication is disabled, have no quotas.
+func (h *YouTubeHandler) claimDownloadQuota(ctx context.Context) error {
+	apiKey := services.APIKeyFromContext(ctx)
+	if apiKey == nil {
+		return nil
+	}
+	return h.apiKeyService.ClaimDownload(ctx, apiKey)
+}
+
+// refundDownloadQuota takes back a download request counted by claimDownloadQuota that couldn't be enqueued
+func (h *YouTubeHandler) refundDownloadQuota(ctx context.Context) {
+	apiKey := services.APIKeyFromContext(ctx)
+	if apiKey == nil {
+		return
+	}
+	if err := h.apiKeyService.RefundDownload(ctx, apiKey.ID); err != nil {
+		log.Printf("Failed to refund download: Key=%s, Error=%v", apiKey.ID, err)
+	}
+}
+
+// checkDownloadQuota returns an error once the request's API key used up one of its daily quotas,
+// without counting the request
+func (h *YouTubeHandler) checkDownloadQuota(ctx context.Context) error {
+	apiKey := services.APIKeyFromContext(ctx)
+	if apiKey == nil {
+		return nil
+	}
+	return h.apiKeyService.CheckDownload(ctx, apiKey)
+}
+
+// checkByteQuota returns an error once the request's API key used up its daily byte quota
+func (h *YouTubeHandler) checkByteQuota(ctx context.Context) error {
+	apiKey := services.APIKeyFromContext(ctx)
+	if apiKey == nil {
+		return nil
+	}
+	return h.apiKeyService.CheckBytes(ctx, apiKey)
+}
+
+// recordServedBytes adds bytes of video sent to the request's API key's usage of the day
+func (h *YouTubeHandler) recordServedBytes(ctx context.Context, bytes int64) {
+	apiKey := services.APIKeyFromContext(ctx)
+	if apiKey == nil || bytes <= 0 {
+		return
+	}
+	if err := h.apiKeyService.RecordBytes(ctx, apiKey.ID, bytes); err != nil {
+		log.Printf("Failed to record served bytes: Key=%s, Error=%v", apiKey.ID, err)
+	}
+}
+
+// submittedBy returns the ID of the API key a request was sent with, recorded on the tasks it creates
+func submittedBy(ctx context.Context) string {
+	if apiKey := services.APIKeyFromContext(ctx); apiKey != nil {
+		return apiKey.ID
+	}
+	return ""
+}
+
+// sendQuotaError rejects a request whose API key is over quota with 429 and a Retry-After header
+// telling when the quota resets. Other errors are internal server errors.
+func sendQuotaError(w http.ResponseWriter, err error) {
+	var quotaErr *services.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		log.Printf("Failed to check API key quota: Error=%v", err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+
+	retryAfter := int(math.Ceil(time.Until(quotaErr.ResetAt).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	httputils.SendError(w, httputils.NewCodedError(http.StatusTooManyRequests, "quota_exceeded", "API key "+quotaErr.Error()))
+}
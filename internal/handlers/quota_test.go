@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"spiropoulos94/youtube-downloader/internal/validators"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// byteQuotas is an APIKeyServiceInterface tracking the bytes served to keys in memory
+type byteQuotas struct {
+	services.APIKeyServiceInterface
+	keys   map[string]*services.APIKey
+	served map[string]int64
+}
+
+func (q *byteQuotas) GetAPIKey(ctx context.Context, id string) (*services.APIKey, error) {
+	if apiKey, ok := q.keys[id]; ok {
+		return apiKey, nil
+	}
+	return nil, services.ErrAPIKeyNotFound
+}
+
+func (q *byteQuotas) CheckBytes(ctx context.Context, apiKey *services.APIKey) error {
+	if apiKey.DailyBytes > 0 && q.served[apiKey.ID] >= apiKey.DailyBytes {
+		return &services.QuotaExceededError{Quota: "bytes", Limit: apiKey.DailyBytes, ResetAt: time.Now().Add(time.Hour)}
+	}
+	return nil
+}
+
+func (q *byteQuotas) RecordBytes(ctx context.Context, id string, bytes int64) error {
+	q.served[id] += bytes
+	return nil
+}
+
+// Served videos count against the byte quota of the request's API key
+func TestServeVideoByteQuota(t *testing.T) {
+	quotas := &byteQuotas{served: map[string]int64{}}
+	handler := newShareTestHandler(t, t.TempDir(), memoryShares{}, services.DownloadOptions{})
+	handler.apiKeyService = quotas
+	handler.taskService.(*transferTaskService).callers = map[string]bool{"key": true}
+	apiKey := &services.APIKey{ID: "key", DailyBytes: 15}
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/videos/task", nil)
+		req = withURLParams(req, map[string]string{"task_id": "task"})
+		req = req.WithContext(services.WithAPIKey(req.Context(), apiKey))
+		w := httptest.NewRecorder()
+		handler.ServeVideo(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve().Code)
+	assert.Equal(t, int64(10), quotas.served["key"])
+
+	// The download crossing the quota still completes
+	assert.Equal(t, http.StatusOK, serve().Code)
+	assert.Equal(t, int64(20), quotas.served["key"])
+
+	w := serve()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	var response httputils.Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "quota_exceeded", response.Code)
+	assert.Contains(t, response.Error, "daily quota")
+}
+
+// exhaustedQuotas is an APIKeyServiceInterface whose keys used up their download quota,
+// counting the downloads claimed anyway
+type exhaustedQuotas struct {
+	services.APIKeyServiceInterface
+	claimed int
+}
+
+func (q *exhaustedQuotas) ClaimDownload(ctx context.Context, apiKey *services.APIKey) error {
+	q.claimed++
+	return &services.QuotaExceededError{Quota: "downloads", Limit: 1, ResetAt: time.Now().Add(time.Hour)}
+}
+
+func (q *exhaustedQuotas) CheckDownload(ctx context.Context, apiKey *services.APIKey) error {
+	return &services.QuotaExceededError{Quota: "downloads", Limit: 1, ResetAt: time.Now().Add(time.Hour)}
+}
+
+// Playlist requests are charged per video once expanded, and invalid ones aren't charged at all
+func TestDownloadPlaylistQuota(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"Over quota", `{"url": "https://www.youtube.com/playlist?list=PL123"}`, http.StatusTooManyRequests},
+		{"Ephemeral playlist", `{"url": "https://www.youtube.com/playlist?list=PL123", "ephemeral": true}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotas := &exhaustedQuotas{}
+			handler := &YouTubeHandler{
+				config:        &config.Config{DownloadTimeout: time.Hour, MaxDownloadTimeout: time.Hour},
+				urlValidator:  validators.NewSourceRegistry(&config.Config{Sources: []string{validators.SourceYouTube}}),
+				apiKeyService: quotas,
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/download", bytes.NewBufferString(tt.body))
+			req = req.WithContext(services.WithAPIKey(req.Context(), &services.APIKey{ID: "key", DailyDownloads: 1}))
+			w := httptest.NewRecorder()
+			handler.DownloadVideo(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Zero(t, quotas.claimed)
+		})
+	}
+}
+
+func TestSendQuotaError(t *testing.T) {
+	w := httptest.NewRecorder()
+	sendQuotaError(w, &services.QuotaExceededError{Quota: "downloads", Limit: 5, ResetAt: time.Now().Add(90 * time.Second)})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "90", w.Header().Get("Retry-After"))
+
+	w = httptest.NewRecorder()
+	sendQuotaError(w, assert.AnError)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+}
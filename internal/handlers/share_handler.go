@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"spiropoulos94/youtube-downloader/internal/tasks"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ShareRequest is the body of POST /api/tasks/{task_id}/shares. Every field is optional:
+// expires_in uses Go's duration format, e.g. "2h", and max_downloads zero means unlimited.
+type ShareRequest struct {
+	ExpiresIn    string `json:"expires_in,omitempty"`
+	Password     string `json:"password,omitempty"`
+	MaxDownloads int    `json:"max_downloads,omitempty"`
+}
+
+// shareTokenPrefixLength is the length of the token prefix share links are listed with
+const shareTokenPrefixLength = 8
+
+// ShareResponse describes a share link, without its password. The token and URL are only
+// returned when the link is created, listings identify links by a prefix of their token.
+type ShareResponse struct {
+	Token             string     `json:"token,omitempty"`
+	TokenPrefix       string     `json:"token_prefix"`
+	TaskID            string     `json:"task_id"`
+	ShareURL          string     `json:"share_url,omitempty"`
+	PasswordProtected bool       `json:"password_protected"`
+	MaxDownloads      int        `json:"max_downloads,omitempty"`
+	Downloads         int        `json:"downloads"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// CreateShare creates a share link for a video task
+func (h *YouTubeHandler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	taskID := chi.URLParam(r, "task_id")
+	if taskID == "" {
+		httputils.SendError(w, httputils.ErrMissingTaskID)
+		return
+	}
+
+	var req ShareRequest
+	if err := httputils.ParseJSON(r, &req); err != nil {
+		httputils.SendError(w, httputils.ErrBadRequest)
+		return
+	}
+
+	link, err := h.createShare(r, taskID, req)
+	if err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	httputils.SendJSON(w, http.StatusCreated, h.newShareResponse(r, link))
+}
+
+// ListShares lists the share links of a video task
+func (h *YouTubeHandler) ListShares(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	taskID := chi.URLParam(r, "task_id")
+	if taskID == "" {
+		httputils.SendError(w, httputils.ErrMissingTaskID)
+		return
+	}
+
+	payload, err := h.getOwnedTaskPayload(r.Context(), taskID)
+	if err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	links, err := h.shareService.ListShares(r.Context(), taskID)
+	if err != nil {
+		log.Printf("Failed to list share links: ID=%s, Error=%v", taskID, err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+
+	responses := make([]ShareResponse, 0, len(links))
+	for _, link := range links {
+		if !canManageShare(r.Context(), link, payload) {
+			continue
+		}
+		response := h.newShareResponse(r, link)
+		response.Token, response.ShareURL = "", ""
+		responses = append(responses, response)
+	}
+	httputils.SendJSON(w, http.StatusOK, responses)
+}
+
+// RevokeShare deletes a share link of a video task, given its token or the token prefix it is
+// listed with. Links can be revoked by the API key that created them, the task's owner and admins.
+func (h *YouTubeHandler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	taskID := chi.URLParam(r, "task_id")
+	token := chi.URLParam(r, "token")
+	if taskID == "" {
+		httputils.SendError(w, httputils.ErrMissingTaskID)
+		return
+	}
+	if token == "" {
+		httputils.SendError(w, httputils.NewError(http.StatusBadRequest, "Missing share token"))
+		return
+	}
+
+	payload, err := h.getOwnedTaskPayload(r.Context(), taskID)
+	if err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	link, err := h.findShare(r.Context(), taskID, token)
+	if err == nil && !canManageShare(r.Context(), link, payload) {
+		err = services.ErrShareNotFound
+	}
+	if err == nil {
+		err = h.shareService.RevokeShare(r.Context(), taskID, link.Token)
+	}
+	if errors.Is(err, services.ErrShareNotFound) {
+		httputils.SendError(w, httputils.NewError(http.StatusNotFound, "Share link not found"))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revoke share link: ID=%s, Error=%v", taskID, err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+
+	log.Printf("Revoked share link: ID=%s", taskID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeShare serves the file of the task a share link points to. Links with a password take it
+// as the password of HTTP basic auth, with any user name, or in the X-Share-Password header.
+// Every request that can fetch the whole file counts as a download, range requests resuming one
+// don't.
+func (h *YouTubeHandler) ServeShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		httputils.SendError(w, httputils.NewError(http.StatusBadRequest, "Missing share token"))
+		return
+	}
+
+	link, err := h.shareService.GetShare(r.Context(), token)
+	if errors.Is(err, services.ErrShareNotFound) {
+		httputils.SendError(w, httputils.NewError(http.StatusNotFound, "Share link not found"))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get share link: Error=%v", err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+
+	if link.Expired(time.Now()) {
+		httputils.SendError(w, httputils.NewError(http.StatusGone, "Share link has expired"))
+		return
+	}
+	// Resuming a download is allowed on a used up link, as long as one was started
+	resuming := resumesDownload(r.Header.Get("Range"))
+	if (!resuming && link.Exhausted()) || (resuming && link.Downloads == 0) {
+		httputils.SendError(w, httputils.NewError(http.StatusGone, "Share link download limit reached"))
+		return
+	}
+	if !link.CheckPassword(sharePassword(r)) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Shared video"`)
+		httputils.SendError(w, httputils.NewError(http.StatusUnauthorized, "Share link requires a password"))
+		return
+	}
+
+	payload, filePath, err := h.completedFile(r.Context(), link.TaskID)
+	if err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	// Shared downloads count against the byte quota of the key that created the link, or of the
+	// task's owner for links created before keys were recorded on them
+	ownerID := link.APIKeyID
+	if ownerID == "" {
+		ownerID = payload.APIKeyID
+	}
+	if ownerID != "" {
+		owner, err := h.apiKeyService.GetAPIKey(r.Context(), ownerID)
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			// Links stop working along with the key that created them
+			httputils.SendError(w, httputils.NewError(http.StatusNotFound, "Share link not found"))
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get share link owner: ID=%s, Error=%v", link.TaskID, err)
+			httputils.SendError(w, httputils.ErrInternalServer)
+			return
+		}
+		r = r.WithContext(services.WithAPIKey(r.Context(), owner))
+	}
+	if err := h.checkByteQuota(r.Context()); err != nil {
+		sendQuotaError(w, err)
+		return
+	}
+
+	// Only count downloads once the file is ready to be served
+	claim := func() error {
+		if resuming {
+			return nil
+		}
+		claimed, err := h.shareService.ClaimDownload(r.Context(), link)
+		if err != nil {
+			log.Printf("Failed to count share download: ID=%s, Error=%v", link.TaskID, err)
+			return httputils.ErrInternalServer
+		}
+		if !claimed {
+			return httputils.NewError(http.StatusGone, "Share link download limit reached")
+		}
+		link.Downloads++
+		log.Printf("Serving shared file: ID=%s, Downloads=%d", link.TaskID, link.Downloads)
+		return nil
+	}
+	h.serveFile(w, r, link.TaskID, payload, filePath, claim)
+}
+
+// resumesDownload reports whether a request with the given Range header resumes a started
+// download of a file: a single range that doesn't start at the beginning of the file. Requests
+// for the start of the file, suffix ranges ("bytes=-500"), several ranges and malformed headers
+// can fetch the whole file, so they count as new downloads.
+func resumesDownload(rangeHeader string) bool {
+	spec, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return false
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start <= 0 {
+		return false
+	}
+	if last == "" {
+		return true
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	return err == nil && end >= start
+}
+
+// findShare returns the share link of a task with the given token, or the given token prefix
+func (h *YouTubeHandler) findShare(ctx context.Context, taskID string, token string) (*services.ShareLink, error) {
+	if len(token) == shareTokenPrefixLength {
+		links, err := h.shareService.ListShares(ctx, taskID)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			if strings.HasPrefix(link.Token, token) {
+				return link, nil
+			}
+		}
+		return nil, services.ErrShareNotFound
+	}
+
+	link, err := h.shareService.GetShare(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if link.TaskID != taskID {
+		return nil, services.ErrShareNotFound
+	}
+	return link, nil
+}
+
+// canManageShare reports whether the request's API key may see and revoke a share link of a task:
+// the key that created it, the task's owner and admin keys may. Anyone may without authentication.
+func canManageShare(ctx context.Context, link *services.ShareLink, payload *tasks.VideoDownloadPayload) bool {
+	apiKey := services.APIKeyFromContext(ctx)
+	return apiKey == nil || apiKey.Admin || apiKey.ID == link.APIKeyID || apiKey.ID == payload.APIKeyID
+}
+
+// createShare validates a share request and creates its link for a video task
+func (h *YouTubeHandler) createShare(r *http.Request, taskID string, req ShareRequest) (*services.ShareLink, error) {
+	link := &services.ShareLink{TaskID: taskID, MaxDownloads: req.MaxDownloads, APIKeyID: submittedBy(r.Context())}
+	if req.ExpiresIn != "" {
+		expiresIn, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || expiresIn <= 0 {
+			return nil, httputils.NewError(http.StatusBadRequest, fmt.Sprintf("Invalid expires_in %q: use a positive duration like \"2h\"", req.ExpiresIn))
+		}
+		// Links aren't kept longer than the tasks they point to
+		if expiresIn > h.config.TaskRetention {
+			return nil, httputils.NewError(http.StatusBadRequest, fmt.Sprintf("expires_in can't be longer than the task retention (%s)", h.config.TaskRetention))
+		}
+		expiresAt := time.Now().Add(expiresIn).UTC()
+		link.ExpiresAt = &expiresAt
+	}
+	if req.MaxDownloads < 0 {
+		return nil, httputils.NewError(http.StatusBadRequest, "max_downloads can't be negative")
+	}
+
+	payload, err := h.getOwnedTaskPayload(r.Context(), taskID)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Options.EphemeralID != "" {
+		return nil, httputils.NewError(http.StatusBadRequest, "Ephemeral downloads can't be shared")
+	}
+
+	if err := h.shareService.CreateShare(r.Context(), link, req.Password, h.config.TaskRetention); err != nil {
+		log.Printf("Failed to create share link: ID=%s, Error=%v", taskID, err)
+		return nil, httputils.ErrInternalServer
+	}
+
+	log.Printf("Created share link: ID=%s, ExpiresIn=%s, MaxDownloads=%d, Password=%t", taskID, req.ExpiresIn, req.MaxDownloads, req.Password != "")
+	return link, nil
+}
+
+// shareRequestFromQuery reads the options of a share link minted along with a task's status.
+// Passwords aren't accepted in URLs, so these links never have one.
+func shareRequestFromQuery(r *http.Request) (ShareRequest, error) {
+	query := r.URL.Query()
+	req := ShareRequest{ExpiresIn: query.Get("expires_in")}
+	if value := query.Get("max_downloads"); value != "" {
+		maxDownloads, err := strconv.Atoi(value)
+		if err != nil {
+			return req, httputils.NewError(http.StatusBadRequest, "Invalid max_downloads value")
+		}
+		req.MaxDownloads = maxDownloads
+	}
+	return req, nil
+}
+
+// newShareResponse describes a share link to its owner
+func (h *YouTubeHandler) newShareResponse(r *http.Request, link *services.ShareLink) ShareResponse {
+	return ShareResponse{
+		Token:             link.Token,
+		TokenPrefix:       link.Token[:min(len(link.Token), shareTokenPrefixLength)],
+		TaskID:            link.TaskID,
+		ShareURL:          h.absoluteURL(r, "/api/shares/"+link.Token),
+		PasswordProtected: link.HasPassword(),
+		MaxDownloads:      link.MaxDownloads,
+		Downloads:         link.Downloads,
+		ExpiresAt:         link.ExpiresAt,
+		CreatedAt:         link.CreatedAt,
+	}
+}
+
+// sharePassword returns the password a request gives for a share link
+func sharePassword(r *http.Request) string {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return r.Header.Get("X-Share-Password")
+}
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"spiropoulos94/youtube-downloader/internal/storage"
+	"spiropoulos94/youtube-downloader/internal/tasks"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memoryShares is a ShareServiceInterface keeping its links in memory
+type memoryShares map[string]services.ShareLink
+
+func (s memoryShares) CreateShare(ctx context.Context, link *services.ShareLink, password string, maxTTL time.Duration) error {
+	link.Token = "token"
+	link.CreatedAt = time.Now()
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			return err
+		}
+		link.PasswordHash = string(hash)
+	}
+	s[link.Token] = *link
+	return nil
+}
+
+func (s memoryShares) GetShare(ctx context.Context, token string) (*services.ShareLink, error) {
+	link, ok := s[token]
+	if !ok {
+		return nil, services.ErrShareNotFound
+	}
+	return &link, nil
+}
+
+func (s memoryShares) ListShares(ctx context.Context, taskID string) ([]*services.ShareLink, error) {
+	var links []*services.ShareLink
+	for _, link := range s {
+		if link.TaskID == taskID {
+			link := link
+			links = append(links, &link)
+		}
+	}
+	return links, nil
+}
+
+func (s memoryShares) RevokeShare(ctx context.Context, taskID string, token string) error {
+	if link, ok := s[token]; !ok || link.TaskID != taskID {
+		return services.ErrShareNotFound
+	}
+	delete(s, token)
+	return nil
+}
+
+func (s memoryShares) ClaimDownload(ctx context.Context, link *services.ShareLink) (bool, error) {
+	stored := s[link.Token]
+	if stored.Exhausted() {
+		return false, nil
+	}
+	stored.Downloads++
+	s[link.Token] = stored
+	return true, nil
+}
+
+// newShareTestHandler creates a handler serving a completed task with a file in dir
+func newShareTestHandler(t *testing.T, dir string, shares memoryShares, options services.DownloadOptions) *YouTubeHandler {
+	filePath := filepath.Join(dir, "Test Video_0123456789abcdef.mp4")
+	require.NoError(t, os.WriteFile(filePath, []byte("0123456789"), 0644))
+
+	state, err := json.Marshal(tasks.VideoDownloadPayload{Status: tasks.TaskStatusCompleted, FilePath: filePath, Options: options})
+	require.NoError(t, err)
+
+	store := storage.NewLocalStore(dir)
+	return &YouTubeHandler{
+		config: &config.Config{OutputDir: dir, TaskRetention: 24 * time.Hour, BaseURL: "https://example.com"},
+		taskLookup: newTaskLookup(
+			services.NewYouTubeService(&config.Config{OutputDir: dir}, nil, store, nil, nil, nil),
+			&transferTaskService{state: state},
+			nil,
+			store,
+		),
+		shareService: shares,
+	}
+}
+
+// withURLParams adds chi URL parameters to a request
+func withURLParams(req *http.Request, params map[string]string) *http.Request {
+	rctx := chi.NewRouteContext()
+	for key, value := range params {
+		rctx.URLParams.Add(key, value)
+	}
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestCreateShareValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		options  services.DownloadOptions
+		wantCode int
+		wantErr  string
+	}{
+		{name: "Defaults", body: `{}`, wantCode: http.StatusCreated},
+		{name: "All options", body: `{"expires_in": "2h", "password": "secret", "max_downloads": 3}`, wantCode: http.StatusCreated},
+		{name: "Invalid expiry", body: `{"expires_in": "soon"}`, wantCode: http.StatusBadRequest, wantErr: `Invalid expires_in "soon"`},
+		{name: "Expiry after the task retention", body: `{"expires_in": "48h"}`, wantCode: http.StatusBadRequest, wantErr: "task retention"},
+		{name: "Negative download limit", body: `{"max_downloads": -1}`, wantCode: http.StatusBadRequest, wantErr: "max_downloads"},
+		{name: "Ephemeral download", body: `{}`, options: services.DownloadOptions{EphemeralID: "task"}, wantCode: http.StatusBadRequest, wantErr: "Ephemeral"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares := memoryShares{}
+			handler := newShareTestHandler(t, t.TempDir(), shares, tt.options)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/tasks/task/shares", strings.NewReader(tt.body))
+			req = withURLParams(req, map[string]string{"task_id": "task"})
+			w := httptest.NewRecorder()
+			handler.CreateShare(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantErr != "" {
+				var response httputils.Response
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+				assert.Contains(t, response.Error, tt.wantErr)
+				assert.Empty(t, shares)
+				return
+			}
+
+			var response struct {
+				Data ShareResponse `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "https://example.com/api/shares/token", response.Data.ShareURL)
+			assert.NotContains(t, w.Body.String(), "secret")
+		})
+	}
+}
+
+func TestServeShare(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+
+	serve := func(handler *YouTubeHandler, token string, setup func(req *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/shares/"+token, nil)
+		if setup != nil {
+			setup(req)
+		}
+		req = withURLParams(req, map[string]string{"token": token})
+		w := httptest.NewRecorder()
+		handler.ServeShare(w, req)
+		return w
+	}
+
+	t.Run("Unknown link", func(t *testing.T) {
+		handler := newShareTestHandler(t, t.TempDir(), memoryShares{}, services.DownloadOptions{})
+		assert.Equal(t, http.StatusNotFound, serve(handler, "missing", nil).Code)
+	})
+
+	t.Run("Expired link", func(t *testing.T) {
+		shares := memoryShares{"token": {Token: "token", TaskID: "task", ExpiresAt: &past}}
+		handler := newShareTestHandler(t, t.TempDir(), shares, services.DownloadOptions{})
+		assert.Equal(t, http.StatusGone, serve(handler, "token", nil).Code)
+	})
+
+	t.Run("Download limit", func(t *testing.T) {
+		shares := memoryShares{"token": {Token: "token", TaskID: "task", MaxDownloads: 2}}
+		handler := newShareTestHandler(t, t.TempDir(), shares, services.DownloadOptions{})
+
+		assert.Equal(t, http.StatusOK, serve(handler, "token", nil).Code)
+		assert.Equal(t, http.StatusOK, serve(handler, "token", nil).Code)
+		assert.Equal(t, http.StatusGone, serve(handler, "token", nil).Code)
+		assert.Equal(t, 2, shares["token"].Downloads)
+	})
+
+	t.Run("Resumed downloads", func(t *testing.T) {
+		shares := memoryShares{"token": {Token: "token", TaskID: "task", MaxDownloads: 1}}
+		handler := newShareTestHandler(t, t.TempDir(), shares, services.DownloadOptions{})
+		withRange := func(value string) func(req *http.Request) {
+			return func(req *http.Request) { req.Header.Set("Range", value) }
+		}
+
+		// Nothing to resume before a download was started
+		assert.Equal(t, http.StatusGone, serve(handler, "token", withRange("bytes=5-")).Code)
+
+		assert.Equal(t, http.StatusPartialContent, serve(handler, "token", withRange("bytes=0-4")).Code)
+		w := serve(handler, "token", withRange("bytes=5-"))
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "56789", w.Body.String())
+		assert.Equal(t, 1, shares["token"].Downloads)
+
+		// Ranges that can fetch the whole file count as new downloads
+		assert.Equal(t, http.StatusGone, serve(handler, "token", nil).Code)
+		assert.Equal(t, http.StatusGone, serve(handler, "token", withRange("bytes=-10")).Code)
+		assert.Equal(t, http.StatusGone, serve(handler, "token", withRange("bytes=1-,0-0")).Code)
+	})
+
+	t.Run("Failed serve", func(t *testing.T) {
+		shares := memoryShares{"token": {Token: "token", TaskID: "task", MaxDownloads: 1}}
+		handler := newShareTestHandler(t, t.TempDir(), shares, services.DownloadOptions{})
+		handler.store = unopenableStore{handler.store}
+
+		// A file that can't be opened doesn't use up a download
+		assert.Equal(t, http.StatusInternalServerError, serve(handler, "token", nil).Code)
+		assert.Equal(t, 0, shares["token"].Downloads)
+	})
+
+	t.Run("Password", func(t *testing.T) {
+		shares := memoryShares{}
+		handler := newShareTestHandler(t, t.TempDir(), shares, services.DownloadOptions{})
+		require.NoError(t, shares.CreateShare(context.Background(), &services.ShareLink{TaskID: "task"}, "secret", time.Hour))
+
+		w := serve(handler, "token", nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Basic")
+
+		w = serve(handler, "token", func(req *http.Request) { req.SetBasicAuth("", "wrong") })
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = serve(handler, "token", func(req *http.Request) { req.SetBasicAuth("anyone", "secret") })
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0123456789", w.Body.String())
+
+		w = serve(handler, "token", func(req *http.Request) { req.Header.Set("X-Share-Password", "secret") })
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// Refused requests aren't downloads
+		assert.Equal(t, 2, shares["token"].Downloads)
+	})
+
+	t.Run("Byte quota of the link's creator", func(t *testing.T) {
+		shares := memoryShares{
+			"token":   {Token: "token", TaskID: "task", APIKeyID: "key"},
+			"revoked": {Token: "revoked", TaskID: "task", APIKeyID: "gone"},
+		}
+		handler := newShareTestHandler(t, t.TempDir(), shares, services.DownloadOptions{})
+		quotas := &byteQuotas{keys: map[string]*services.APIKey{"key": {ID: "key", DailyBytes: 10}}, served: map[string]int64{}}
+		handler.apiKeyService = quotas
+
+		assert.Equal(t, http.StatusOK, serve(handler, "token", nil).Code)
+		assert.Equal(t, int64(10), quotas.served["key"])
+		assert.Equal(t, http.StatusTooManyRequests, serve(handler, "token", nil).Code)
+		assert.Equal(t, 1, shares["token"].Downloads)
+
+		assert.Equal(t, http.StatusNotFound, serve(handler, "revoked", nil).Code)
+	})
+}
+
+// unopenableStore is a store whose files can be found but not opened
+type unopenableStore struct {
+	storage.StoreInterface
+}
+
+func (s unopenableStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, *storage.ObjectInfo, error) {
+	return nil, nil, errors.New("permission denied")
+}
+
+func TestResumesDownload(t *testing.T) {
+	assert.True(t, resumesDownload("bytes=1024-"))
+	assert.True(t, resumesDownload("bytes=1024-2047"))
+	assert.False(t, resumesDownload(""))
+	assert.False(t, resumesDownload("bytes=0-"))
+	assert.False(t, resumesDownload("bytes=0-1023"))
+	assert.False(t, resumesDownload("bytes=-500"))
+	assert.False(t, resumesDownload("bytes=1-,0-0"))
+	assert.False(t, resumesDownload("bytes=1024-10"))
+	assert.False(t, resumesDownload("bytes=abc"))
+	assert.False(t, resumesDownload("items=1024-"))
+}
+
+func TestRevokeShare(t *testing.T) {
+	shares := memoryShares{"token": {Token: "token", TaskID: "task"}}
+	handler := newShareTestHandler(t, t.TempDir(), shares, services.DownloadOptions{})
+
+	revoke := func(taskID string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/api/tasks/"+taskID+"/shares/token", nil)
+		req = withURLParams(req, map[string]string{"task_id": taskID, "token": "token"})
+		w := httptest.NewRecorder()
+		handler.RevokeShare(w, req)
+		return w.Code
+	}
+
+	// Only the task the link belongs to can revoke it
+	assert.Equal(t, http.StatusNotFound, revoke("other"))
+	assert.Equal(t, http.StatusNoContent, revoke("task"))
+	assert.Empty(t, shares)
+	assert.Equal(t, http.StatusNotFound, revoke("task"))
+}
+
+// Listed links only show a prefix of their token, and each key only sees and revokes its own links
+func TestListAndRevokeSharesByKey(t *testing.T) {
+	aliceToken := "abcdefgh" + strings.Repeat("a", 24)
+	bobToken := "zyxwvuts" + strings.Repeat("b", 24)
+	shares := memoryShares{
+		aliceToken: {Token: aliceToken, TaskID: "task", APIKeyID: "alice"},
+		bobToken:   {Token: bobToken, TaskID: "task", APIKeyID: "bob"},
+	}
+	handler := newShareTestHandler(t, t.TempDir(), shares, services.DownloadOptions{})
+	handler.taskService.(*transferTaskService).callers = map[string]bool{"alice": true, "bob": true}
+
+	list := func(apiKey *services.APIKey) []ShareResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/tasks/task/shares", nil)
+		req = req.WithContext(services.WithAPIKey(req.Context(), apiKey))
+		req = withURLParams(req, map[string]string{"task_id": "task"})
+		w := httptest.NewRecorder()
+		handler.ListShares(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data []ShareResponse `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+	revoke := func(apiKey *services.APIKey, token string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/api/tasks/task/shares/"+token, nil)
+		req = req.WithContext(services.WithAPIKey(req.Context(), apiKey))
+		req = withURLParams(req, map[string]string{"task_id": "task", "token": token})
+		w := httptest.NewRecorder()
+		handler.RevokeShare(w, req)
+		return w.Code
+	}
+
+	alice, bob := &services.APIKey{ID: "alice"}, &services.APIKey{ID: "bob"}
+	links := list(alice)
+	require.Len(t, links, 1)
+	assert.Equal(t, "abcdefgh", links[0].TokenPrefix)
+	assert.Empty(t, links[0].Token)
+	assert.Empty(t, links[0].ShareURL)
+	assert.Len(t, list(&services.APIKey{ID: "admin", Admin: true}), 2)
+
+	assert.Equal(t, http.StatusNotFound, revoke(alice, "zyxwvuts"))
+	assert.Equal(t, http.StatusNoContent, revoke(bob, "zyxwvuts"))
+	assert.Equal(t, http.StatusNoContent, revoke(alice, aliceToken))
+	assert.Empty(t, shares)
+}
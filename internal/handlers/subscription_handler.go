@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"spiropoulos94/youtube-downloader/internal/tasks"
+	"spiropoulos94/youtube-downloader/internal/validators"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hibiken/asynq"
+)
+
+// SubscriptionHandler implements SubscriptionHandlerInterface
+type SubscriptionHandler struct {
+	subscriptionService services.SubscriptionServiceInterface
+	asynqClient         *asynq.Client
+}
+
+// NewSubscriptionHandler creates a new instance of SubscriptionHandler
+func NewSubscriptionHandler(
+	subscriptionService services.SubscriptionServiceInterface,
+	asynqClient *asynq.Client,
+) SubscriptionHandlerInterface {
+	return &SubscriptionHandler{
+		subscriptionService: subscriptionService,
+		asynqClient:         asynqClient,
+	}
+}
+
+// SubscriptionRequest is the body of POST /api/subscriptions and PUT /api/subscriptions/{id}.
+// The URL of an existing subscription can't be changed, since its download archive belongs to it.
+type SubscriptionRequest struct {
+	URL     string                       `json:"url"`
+	Filters services.SubscriptionFilters `json:"filters"`
+	services.DownloadOptions
+}
+
+// validate checks the format and filters of the request
+func (req SubscriptionRequest) validate() error {
+	if err := req.DownloadOptions.Validate(); err != nil {
+		return httputils.NewError(http.StatusBadRequest, err.Error())
+	}
+	if err := req.Filters.Validate(); err != nil {
+		return httputils.NewError(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+// CreateSubscription subscribes to a channel or playlist
+func (h *SubscriptionHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	var req SubscriptionRequest
+	if err := httputils.ParseJSON(r, &req); err != nil {
+		httputils.SendError(w, httputils.ErrBadRequest)
+		return
+	}
+
+	var url string
+	switch {
+	case validators.IsChannelURL(req.URL):
+		url = validators.ChannelUploadsURL(req.URL)
+	case validators.IsPlaylistURL(req.URL):
+		url = req.URL
+	default:
+		httputils.SendError(w, httputils.NewError(http.StatusBadRequest, "URL must be a YouTube channel or playlist"))
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	subscription := &services.Subscription{
+		URL:      url,
+		Options:  req.DownloadOptions,
+		Filters:  req.Filters,
+		APIKeyID: submittedBy(r.Context()),
+	}
+	if err := h.subscriptionService.CreateSubscription(r.Context(), subscription); err != nil {
+		log.Printf("Failed to create subscription: URL=%s, Error=%v", url, err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+
+	// Check for uploads right away instead of waiting for the next scheduled sync
+	h.enqueueSync(subscription.ID)
+
+	log.Printf("Subscription created: ID=%s, URL=%s", subscription.ID, subscription.URL)
+	httputils.SendJSON(w, http.StatusCreated, subscription)
+}
+
+// ListSubscriptions returns every subscription
+func (h *SubscriptionHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	subscriptions, err := h.subscriptionService.ListSubscriptions(r.Context())
+	if err != nil {
+		log.Printf("Failed to list subscriptions: %v", err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+
+	httputils.SendJSON(w, http.StatusOK, subscriptions)
+}
+
+// GetSubscription returns a subscription and the result of its last sync
+func (h *SubscriptionHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	subscription, err := h.getSubscription(r)
+	if err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	httputils.SendJSON(w, http.StatusOK, subscription)
+}
+
+// UpdateSubscription replaces the format and filters of a subscription
+func (h *SubscriptionHandler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	subscription, err := h.getSubscription(r)
+	if err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	var req SubscriptionRequest
+	if err := httputils.ParseJSON(r, &req); err != nil {
+		httputils.SendError(w, httputils.ErrBadRequest)
+		return
+	}
+	if req.URL != "" && req.URL != subscription.URL {
+		httputils.SendError(w, httputils.NewError(http.StatusBadRequest, "The URL of a subscription can't be changed"))
+		return
+	}
+	if err := req.validate(); err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	subscription.Options = req.DownloadOptions
+	subscription.Filters = req.Filters
+	err = h.subscriptionService.UpdateSubscription(r.Context(), subscription)
+	if err == services.ErrSubscriptionNotFound {
+		httputils.SendError(w, httputils.ErrNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update subscription: ID=%s, Error=%v", subscription.ID, err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+
+	log.Printf("Subscription updated: ID=%s", subscription.ID)
+	httputils.SendJSON(w, http.StatusOK, subscription)
+}
+
+// DeleteSubscription unsubscribes, forgetting the subscription's download archive.
+// Downloads that were already enqueued are not affected.
+func (h *SubscriptionHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	id := chi.URLParam(r, "subscription_id")
+	if id == "" {
+		httputils.SendError(w, errMissingSubscriptionID)
+		return
+	}
+
+	err := h.subscriptionService.DeleteSubscription(r.Context(), id)
+	if err == services.ErrSubscriptionNotFound {
+		httputils.SendError(w, httputils.ErrNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete subscription: ID=%s, Error=%v", id, err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+
+	log.Printf("Subscription deleted: ID=%s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SyncSubscription checks a subscription for new uploads now, without waiting for the next scheduled sync
+func (h *SubscriptionHandler) SyncSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	subscription, err := h.getSubscription(r)
+	if err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	if err := h.enqueueSync(subscription.ID); err != nil {
+		httputils.SendError(w, httputils.NewError(http.StatusInternalServerError, "Failed to enqueue sync"))
+		return
+	}
+
+	httputils.SendJSON(w, http.StatusAccepted, subscription)
+}
+
+// errMissingSubscriptionID is returned when a request has no subscription ID
+var errMissingSubscriptionID = httputils.NewError(http.StatusBadRequest, "Missing subscription ID")
+
+// getSubscription returns the subscription named in the request's URL
+func (h *SubscriptionHandler) getSubscription(r *http.Request) (*services.Subscription, error) {
+	id := chi.URLParam(r, "subscription_id")
+	if id == "" {
+		return nil, errMissingSubscriptionID
+	}
+
+	subscription, err := h.subscriptionService.GetSubscription(r.Context(), id)
+	if err == services.ErrSubscriptionNotFound {
+		return nil, httputils.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("Failed to get subscription: ID=%s, Error=%v", id, err)
+		return nil, httputils.ErrInternalServer
+	}
+	return subscription, nil
+}
+
+// enqueueSync enqueues a sync of the subscription
+func (h *SubscriptionHandler) enqueueSync(id string) error {
+	task, err := tasks.NewSubscriptionSyncTask(id)
+	if err == nil {
+		_, err = h.asynqClient.Enqueue(task)
+	}
+	if err != nil {
+		log.Printf("Failed to enqueue subscription sync: ID=%s, Error=%v", id, err)
+	}
+	return err
+}
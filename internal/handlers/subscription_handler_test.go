@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionHandlersMethodNotAllowed(t *testing.T) {
+	// Create a handler with nil dependencies
+	handler := &SubscriptionHandler{}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+	}{
+		{name: "create", handler: handler.CreateSubscription, method: http.MethodGet},
+		{name: "list", handler: handler.ListSubscriptions, method: http.MethodPost},
+		{name: "get", handler: handler.GetSubscription, method: http.MethodPost},
+		{name: "update", handler: handler.UpdateSubscription, method: http.MethodPost},
+		{name: "delete", handler: handler.DeleteSubscription, method: http.MethodGet},
+		{name: "sync", handler: handler.SyncSubscription, method: http.MethodGet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/subscriptions", nil)
+			w := httptest.NewRecorder()
+
+			tt.handler(w, req)
+
+			assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		})
+	}
+}
+
+func TestSubscriptionHandlersMissingID(t *testing.T) {
+	// Create a handler with nil dependencies
+	handler := &SubscriptionHandler{}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+	}{
+		{name: "get", handler: handler.GetSubscription, method: http.MethodGet},
+		{name: "update", handler: handler.UpdateSubscription, method: http.MethodPut},
+		{name: "delete", handler: handler.DeleteSubscription, method: http.MethodDelete},
+		{name: "sync", handler: handler.SyncSubscription, method: http.MethodPost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/subscriptions/", nil)
+			w := httptest.NewRecorder()
+
+			tt.handler(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "Missing subscription ID")
+		})
+	}
+}
+
+func TestCreateSubscriptionValidation(t *testing.T) {
+	// Invalid requests are rejected before the nil service is used
+	handler := &SubscriptionHandler{}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantBody string
+	}{
+		{name: "invalid JSON", body: `{"url":`, wantBody: "Bad request"},
+		{name: "single video", body: `{"url": "https://www.youtube.com/watch?v=dQw4w9WgXcQ"}`, wantBody: "URL must be a YouTube channel or playlist"},
+		{name: "invalid filter", body: `{"url": "https://www.youtube.com/@example", "filters": {"title_regex": "("}}`, wantBody: "invalid title_regex"},
+		{name: "invalid format", body: `{"url": "https://www.youtube.com/@example", "video_codec": "mpeg2"}`, wantBody: "unsupported video codec"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/subscriptions", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.CreateSubscription(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
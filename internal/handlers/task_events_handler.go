@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/tasks"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// maxStreamedTasks limits how many tasks a single event stream can watch
+	maxStreamedTasks = 100
+
+	// eventStreamHeartbeat is how often a comment is sent to keep idle connections open
+	eventStreamHeartbeat = 15 * time.Second
+)
+
+// StreamTaskEvents streams the status and progress of a task as Server-Sent Events
+func (h *YouTubeHandler) StreamTaskEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	taskID := chi.URLParam(r, "task_id")
+	if taskID == "" {
+		httputils.SendError(w, httputils.ErrMissingTaskID)
+		return
+	}
+
+	h.streamTaskEvents(w, r, []string{taskID})
+}
+
+// StreamMultiTaskEvents streams the status and progress of several tasks, given as
+// a comma separated "ids" query parameter, as Server-Sent Events
+func (h *YouTubeHandler) StreamMultiTaskEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	taskIDs := parseTaskIDs(r.URL.Query().Get("ids"))
+	if len(taskIDs) == 0 {
+		httputils.SendError(w, httputils.ErrMissingTaskID)
+		return
+	}
+	if len(taskIDs) > maxStreamedTasks {
+		httputils.SendError(w, httputils.NewError(http.StatusBadRequest, fmt.Sprintf("Cannot stream more than %d tasks", maxStreamedTasks)))
+		return
+	}
+
+	h.streamTaskEvents(w, r, taskIDs)
+}
+
+// streamTaskEvents sends the current state of every task, then forwards the updates
+// published by the workers until all tasks reach a terminal state or the client disconnects
+func (h *YouTubeHandler) streamTaskEvents(w http.ResponseWriter, r *http.Request, taskIDs []string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httputils.SendError(w, httputils.NewError(http.StatusInternalServerError, "Streaming not supported"))
+		return
+	}
+
+	// Fail before subscribing if a task doesn't exist or belongs to another API key
+	for _, taskID := range taskIDs {
+		if _, err := h.getOwnedTaskPayload(r.Context(), taskID); err != nil {
+			httputils.SendError(w, err)
+			return
+		}
+	}
+
+	// Subscribe before reading the current state so no update in between is lost
+	subscription, err := h.taskService.SubscribeTaskEvents(r.Context(), taskIDs)
+	if err != nil {
+		log.Printf("Failed to subscribe to task events: %v", err)
+		httputils.SendError(w, httputils.ErrServiceUnavailable)
+		return
+	}
+	defer subscription.Close()
+
+	// Read the current state of every task, failing before the stream starts if one is gone
+	initial := make([]TaskStatusResponse, 0, len(taskIDs))
+	for _, taskID := range taskIDs {
+		payload, err := h.getTaskPayload(r.Context(), taskID)
+		if err != nil {
+			httputils.SendError(w, err)
+			return
+		}
+		response := h.newTaskStatusResponse(r, taskID, payload)
+		response.TaskID = taskID
+		initial = append(initial, response)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable response buffering in nginx
+	w.WriteHeader(http.StatusOK)
+
+	// Tasks that can still change state
+	watching := make(map[string]bool, len(taskIDs))
+	for _, response := range initial {
+		writeEvent(w, "status", response)
+		if !response.Status.IsTerminal() {
+			watching[response.TaskID] = true
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for len(watching) > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+			if !watching[event.TaskID] {
+				continue
+			}
+
+			var payload tasks.VideoDownloadPayload
+			if err := json.Unmarshal(event.Data, &payload); err != nil {
+				log.Printf("Failed to parse task event: ID=%s, Error=%v", event.TaskID, err)
+				continue
+			}
+			response := h.newTaskStatusResponse(r, event.TaskID, &payload)
+			response.TaskID = event.TaskID
+
+			writeEvent(w, "status", response)
+			flusher.Flush()
+
+			if payload.Status.IsTerminal() {
+				delete(watching, event.TaskID)
+			}
+		}
+	}
+
+	// Tell the client the stream is over so it doesn't reconnect
+	fmt.Fprint(w, "event: done\ndata: {}\n\n")
+	flusher.Flush()
+}
+
+// writeEvent writes a single Server-Sent Event with a JSON payload
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", event, err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encoded)
+}
+
+// parseTaskIDs splits a comma separated list of task IDs, dropping blanks and duplicates
+func parseTaskIDs(ids string) []string {
+	var taskIDs []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(ids, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		taskIDs = append(taskIDs, id)
+	}
+	return taskIDs
+}
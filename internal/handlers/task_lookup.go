@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"spiropoulos94/youtube-downloader/internal/storage"
+	"spiropoulos94/youtube-downloader/internal/tasks"
+
+	"github.com/hibiken/asynq"
+)
+
+// taskLookup finds the state and files of video download tasks, for the handlers that serve
+// and manage them
+type taskLookup struct {
+	youtubeService services.YouTubeServiceInterface
+	taskService    services.TaskServiceInterface
+	asynqInspector *asynq.Inspector
+	store          storage.StoreInterface
+}
+
+// newTaskLookup creates a taskLookup reading tasks from Redis and files from the store
+func newTaskLookup(
+	youtubeService services.YouTubeServiceInterface,
+	taskService services.TaskServiceInterface,
+	asynqInspector *asynq.Inspector,
+	store storage.StoreInterface,
+) taskLookup {
+	return taskLookup{
+		youtubeService: youtubeService,
+		taskService:    taskService,
+		asynqInspector: asynqInspector,
+		store:          store,
+	}
+}
+
+// getTaskPayload returns the latest state of a task.
+// Cancelled and timed out tasks are read from their final state record, and tasks that
+// haven't started yet have no result, so their original payload is returned.
+func (l *taskLookup) getTaskPayload(ctx context.Context, taskID string) (*tasks.VideoDownloadPayload, error) {
+	data, err := l.taskService.GetFinalTaskState(ctx, taskID)
+	if err != nil {
+		log.Printf("Failed to read final task state: ID=%s, Error=%v", taskID, err)
+		return nil, httputils.ErrInternalServer
+	}
+
+	if data == nil {
+		info, err := l.asynqInspector.GetTaskInfo("default", taskID)
+		if err != nil {
+			log.Printf("Task not found: ID=%s", taskID)
+			return nil, httputils.ErrNotFound
+		}
+
+		if info.Type == tasks.TypePlaylistDownload {
+			return nil, httputils.NewError(http.StatusBadRequest, fmt.Sprintf("Task is a playlist, use /api/playlists/%s", taskID))
+		}
+
+		data = info.Result
+		if len(data) == 0 {
+			data = info.Payload
+		}
+	}
+
+	var payload tasks.VideoDownloadPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("Failed to parse task result: ID=%s, Error=%v", taskID, err)
+		return nil, httputils.ErrInternalServer
+	}
+	return &payload, nil
+}
+
+// getOwnedTaskPayload returns the latest state of a task the request's API key may manage, and
+// reports other tasks as not found, so their IDs can't be probed
+func (l *taskLookup) getOwnedTaskPayload(ctx context.Context, taskID string) (*tasks.VideoDownloadPayload, error) {
+	payload, err := l.getTaskPayload(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if !l.canManageTask(ctx, taskID, payload.APIKeyID) {
+		log.Printf("Task of another API key: ID=%s, Key=%s", taskID, submittedBy(ctx))
+		return nil, httputils.ErrNotFound
+	}
+	return payload, nil
+}
+
+// canManageTask reports whether the request's API key may manage a task submitted by ownerID:
+// its owner, the keys that attached to it and admin keys may. Anyone may without authentication.
+func (l *taskLookup) canManageTask(ctx context.Context, taskID string, ownerID string) bool {
+	apiKey := services.APIKeyFromContext(ctx)
+	if apiKey == nil || apiKey.Admin || apiKey.ID == ownerID {
+		return true
+	}
+	isCaller, err := l.taskService.IsCaller(ctx, taskID, apiKey.ID)
+	if err != nil {
+		log.Printf("Failed to check task caller: ID=%s, Error=%v", taskID, err)
+		return false
+	}
+	return isCaller
+}
+
+// resolveFilePath returns the current path of a completed task's file. Files downloaded before
+// cache keys were based on video IDs are renamed when they are migrated, so if the recorded
+// path is gone the file is looked up by the video and format of the task.
+func (l *taskLookup) resolveFilePath(ctx context.Context, payload *tasks.VideoDownloadPayload) (string, error) {
+	if _, err := l.store.Stat(ctx, storage.Key(payload.FilePath)); !errors.Is(err, storage.ErrNotFound) {
+		return payload.FilePath, err
+	}
+
+	filePath, err := l.youtubeService.FindDownloadedFile(ctx, payload.URL, payload.Options)
+	if err != nil {
+		return "", err
+	}
+	if filePath == "" {
+		return "", storage.ErrNotFound
+	}
+	return filePath, nil
+}
+
+// completedFile returns the state of a completed task along with the current path of its file, or
+// an HTTP error if the task isn't completed or its file is gone
+func (l *taskLookup) completedFile(ctx context.Context, taskID string) (*tasks.VideoDownloadPayload, string, error) {
+	payload, err := l.getTaskPayload(ctx, taskID)
+	if err != nil {
+		return nil, "", err
+	}
+	return l.fileOf(ctx, taskID, payload)
+}
+
+// ownedCompletedFile is completedFile for a task the request's API key may manage, reporting
+// other tasks as not found
+func (l *taskLookup) ownedCompletedFile(ctx context.Context, taskID string) (*tasks.VideoDownloadPayload, string, error) {
+	payload, err := l.getOwnedTaskPayload(ctx, taskID)
+	if err != nil {
+		return nil, "", err
+	}
+	return l.fileOf(ctx, taskID, payload)
+}
+
+// fileOf returns the state of a task along with the current path of its file, or an HTTP error
+// if the task isn't completed or its file is gone
+func (l *taskLookup) fileOf(ctx context.Context, taskID string, payload *tasks.VideoDownloadPayload) (*tasks.VideoDownloadPayload, string, error) {
+	if payload.Status != tasks.TaskStatusCompleted || payload.FilePath == "" {
+		log.Printf("Video not ready: ID=%s, Status=%s", taskID, payload.Status)
+		return nil, "", httputils.NewError(http.StatusBadRequest, "Video download not completed")
+	}
+
+	filePath, err := l.resolveFilePath(ctx, payload)
+	if errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Video file is gone: ID=%s, File=%s", taskID, payload.FilePath)
+		return nil, "", httputils.NewError(http.StatusNotFound, "Video file is no longer available")
+	}
+	if err != nil {
+		log.Printf("Failed to find video file: ID=%s, Error=%v", taskID, err)
+		return nil, "", httputils.ErrInternalServer
+	}
+	return payload, filePath, nil
+}
@@ -1,63 +1,89 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"spiropoulos94/youtube-downloader/internal/config"
 	"spiropoulos94/youtube-downloader/internal/httputils"
 	"spiropoulos94/youtube-downloader/internal/services"
+	"spiropoulos94/youtube-downloader/internal/storage"
 	"spiropoulos94/youtube-downloader/internal/tasks"
 	"spiropoulos94/youtube-downloader/internal/validators"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
 )
 
 // YouTubeHandler implements YouTubeHandlerInterface
 type YouTubeHandler struct {
-	config         *config.Config
-	youtubeService services.YouTubeServiceInterface
-	asynqClient    *asynq.Client
-	asynqInspector *asynq.Inspector
-	urlValidator   validators.URLValidatorInterface
+	taskLookup
+	config        *config.Config
+	asynqClient   *asynq.Client
+	enqueuer      *tasks.VideoEnqueuer
+	urlValidator  validators.URLValidatorInterface
+	shareService  services.ShareServiceInterface
+	apiKeyService services.APIKeyServiceInterface
 }
 
 // NewYouTubeHandler creates a new instance of YouTubeHandler
 func NewYouTubeHandler(
 	config *config.Config,
 	youtubeService services.YouTubeServiceInterface,
+	taskService services.TaskServiceInterface,
 	asynqClient *asynq.Client,
 	asynqInspector *asynq.Inspector,
 	urlValidator validators.URLValidatorInterface,
+	store storage.StoreInterface,
+	shareService services.ShareServiceInterface,
+	apiKeyService services.APIKeyServiceInterface,
 ) YouTubeHandlerInterface {
 	return &YouTubeHandler{
-		config:         config,
-		youtubeService: youtubeService,
-		asynqClient:    asynqClient,
-		asynqInspector: asynqInspector,
-		urlValidator:   urlValidator,
+		taskLookup:    newTaskLookup(youtubeService, taskService, asynqInspector, store),
+		config:        config,
+		asynqClient:   asynqClient,
+		enqueuer:      tasks.NewVideoEnqueuer(config, youtubeService, taskService, apiKeyService, asynqClient, asynqInspector),
+		urlValidator:  urlValidator,
+		shareService:  shareService,
+		apiKeyService: apiKeyService,
 	}
 }
 
+// DownloadRequest is the body of POST /api/download.
+// The embedded format options (mode, max_height, video_codec, max_filesize_mb,
+// audio_format, audio_bitrate), the timeout and ephemeral are optional.
 type DownloadRequest struct {
-	URL string `json:"url"`
+	URL       string `json:"url"`
+	Timeout   string `json:"timeout,omitempty"`   // Go duration, e.g. "30m"
+	Ephemeral bool   `json:"ephemeral,omitempty"` // Delete the file once the client received it, never sharing it with other requests
+	services.DownloadOptions
 }
 
 type DownloadResponse struct {
-	TaskID string `json:"task_id"`
+	TaskID   string `json:"task_id"`
+	Playlist bool   `json:"playlist,omitempty"` // The task expands a playlist, see GET /api/playlists/{task_id}
+	Attached bool   `json:"attached"`           // The video was already being downloaded by the returned task
 }
 
 type TaskStatusResponse struct {
-	Status       tasks.TaskStatus `json:"status"`
-	FilePath     string           `json:"file_path,omitempty"`
-	DownloadURL  string           `json:"download_url,omitempty"`
-	Error        string           `json:"error,omitempty"`
-	Title        string           `json:"title,omitempty"`
-	ThumbnailURL string           `json:"thumbnail_url,omitempty"`
-	Duration     string           `json:"duration,omitempty"`
+	TaskID       string             `json:"task_id,omitempty"` // Only set in event streams and playlist items
+	Status       tasks.TaskStatus   `json:"status"`
+	Ephemeral    bool               `json:"ephemeral,omitempty"`  // The file is deleted once it was downloaded
+	APIKeyID     string             `json:"api_key_id,omitempty"` // API key that submitted the task
+	FilePath     string             `json:"file_path,omitempty"`
+	DownloadURL  string             `json:"download_url,omitempty"`
+	ShareURL     string             `json:"share_url,omitempty"` // Replaces the download URL when a share link was requested
+	Error        string             `json:"error,omitempty"`
+	Title        string             `json:"title,omitempty"`
+	ThumbnailURL string             `json:"thumbnail_url,omitempty"`
+	Duration     string             `json:"duration,omitempty"`
+	Progress     *services.Progress `json:"progress,omitempty"`
+	Detached     bool               `json:"detached,omitempty"` // The caller stopped waiting for a download others still wait for
 }
 
 func (h *YouTubeHandler) DownloadVideo(w http.ResponseWriter, r *http.Request) {
@@ -72,29 +98,154 @@ func (h *YouTubeHandler) DownloadVideo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate YouTube URL using the validator
-	if err := h.urlValidator.Validate(req.URL); err != nil {
+	// Validate the URL against the enabled sources
+	media, err := h.urlValidator.Validate(req.URL)
+	if err != nil {
+		httputils.SendError(w, urlValidationError(err))
+		return
+	}
+
+	// Sites without video are downloaded in audio mode
+	if media.AudioOnly {
+		if req.Mode == services.ModeVideo {
+			httputils.SendError(w, httputils.NewError(http.StatusBadRequest, fmt.Sprintf("%s only hosts audio, use mode %q", media.Source, services.ModeAudio)))
+			return
+		}
+		req.Mode = services.ModeAudio
+	}
+
+	// Validate the requested format
+	if err := req.DownloadOptions.Validate(); err != nil {
+		httputils.SendError(w, httputils.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	timeout, err := h.parseTimeout(req.Timeout)
+	if err != nil {
 		httputils.SendError(w, httputils.NewError(http.StatusBadRequest, err.Error()))
 		return
 	}
 
-	task, err := tasks.NewVideoDownloadTask(req.URL)
+	if media.PlaylistID != "" {
+		if req.Ephemeral {
+			httputils.SendError(w, httputils.NewError(http.StatusBadRequest, "Playlists can't be downloaded ephemerally"))
+			return
+		}
+		// Every video of the playlist is charged once it is enqueued, only check there is quota left
+		if err := h.checkDownloadQuota(r.Context()); err != nil {
+			sendQuotaError(w, err)
+			return
+		}
+		h.enqueuePlaylist(w, r, req, timeout)
+		return
+	}
+
+	if req.Ephemeral {
+		h.enqueueEphemeral(w, r, req, timeout)
+		return
+	}
+
+	// New downloads count against the daily quotas of the request's API key, attaching to one doesn't
+	enqueued, err := h.enqueuer.Enqueue(r.Context(), uuid.NewString(), req.URL, req.DownloadOptions, timeout, services.APIKeyFromContext(r.Context()))
+	var quotaErr *services.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		sendQuotaError(w, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to enqueue download: URL=%s, Error=%v", req.URL, err)
+		httputils.SendError(w, httputils.NewError(http.StatusInternalServerError, "Failed to enqueue task"))
+		return
+	}
+	httputils.SendJSON(w, http.StatusAccepted, DownloadResponse{TaskID: enqueued.TaskID, Attached: enqueued.Attached})
+}
+
+// enqueueEphemeral enqueues a download whose file is deleted once its client received it. The file
+// is cached under the task's own ID, so it is never shared with, or served to, other requests.
+func (h *YouTubeHandler) enqueueEphemeral(w http.ResponseWriter, r *http.Request, req DownloadRequest, timeout time.Duration) {
+	taskID := uuid.NewString()
+	req.DownloadOptions.EphemeralID = taskID
+
+	task, err := tasks.NewVideoDownloadTask(req.URL, req.DownloadOptions, timeout, submittedBy(r.Context()))
 	if err != nil {
 		httputils.SendError(w, httputils.NewError(http.StatusInternalServerError, "Failed to create task"))
 		return
 	}
 
-	// keep task in queue using the configured retention time
-	info, err := h.asynqClient.Enqueue(task, asynq.Retention(h.config.TaskRetention))
+	// Count the request against the daily quotas of its API key
+	if err := h.claimDownloadQuota(r.Context()); err != nil {
+		sendQuotaError(w, err)
+		return
+	}
+
+	info, err := h.asynqClient.Enqueue(task, asynq.TaskID(taskID), asynq.Retention(h.config.TaskRetention))
 	if err != nil {
+		h.refundDownloadQuota(r.Context())
 		httputils.SendError(w, httputils.NewError(http.StatusInternalServerError, "Failed to enqueue task"))
 		return
 	}
 
-	log.Printf("Task enqueued: ID=%s, URL=%s, Retention: %s", info.ID, req.URL, h.config.TaskRetention)
+	log.Printf("Ephemeral task enqueued: ID=%s, URL=%s, Timeout: %s", info.ID, req.URL, timeout)
 	httputils.SendJSON(w, http.StatusAccepted, DownloadResponse{TaskID: info.ID})
 }
 
+// urlValidationError turns a rejected URL into a bad request carrying the validation error code
+func urlValidationError(err error) error {
+	var validationErr *validators.ValidationError
+	if errors.As(err, &validationErr) {
+		return httputils.NewCodedError(http.StatusBadRequest, string(validationErr.Code), validationErr.Message)
+	}
+	return httputils.NewError(http.StatusBadRequest, err.Error())
+}
+
+// parseTimeout returns the requested download timeout, or the configured default if none was given
+func (h *YouTubeHandler) parseTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return h.config.DownloadTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: use a duration like \"30m\" or \"1h30m\"", value)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("timeout must be positive")
+	}
+	if timeout > h.config.MaxDownloadTimeout {
+		return 0, fmt.Errorf("timeout cannot be longer than %s", h.config.MaxDownloadTimeout)
+	}
+	return timeout, nil
+}
+
+// GetVideoInfo previews a video before it is downloaded: its metadata, available formats
+// and whether it is already downloaded
+func (h *YouTubeHandler) GetVideoInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	url := r.URL.Query().Get("url")
+	media, err := h.urlValidator.Validate(url)
+	if err != nil {
+		httputils.SendError(w, urlValidationError(err))
+		return
+	}
+	if media.PlaylistID != "" {
+		httputils.SendError(w, httputils.NewError(http.StatusBadRequest, "Info is only available for single videos"))
+		return
+	}
+
+	info, err := h.youtubeService.GetVideoInfo(r.Context(), url)
+	if err != nil {
+		log.Printf("Failed to get video info: URL=%s, Error=%v", url, err)
+		httputils.SendError(w, httputils.NewError(http.StatusBadGateway, "Failed to fetch video info"))
+		return
+	}
+
+	httputils.SendJSON(w, http.StatusOK, info)
+}
+
 func (h *YouTubeHandler) GetTaskStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		httputils.SendError(w, httputils.ErrMethodNotAllowed)
@@ -107,6 +258,58 @@ func (h *YouTubeHandler) GetTaskStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	payload, err := h.getOwnedTaskPayload(r.Context(), taskID)
+	if err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	response := h.newTaskStatusResponse(r, taskID, payload)
+
+	// Hand out a share link instead of the task's own download URL
+	if r.URL.Query().Get("share") == "true" && response.DownloadURL != "" {
+		req, err := shareRequestFromQuery(r)
+		if err != nil {
+			httputils.SendError(w, err)
+			return
+		}
+		link, err := h.createShare(r, taskID, req)
+		if err != nil {
+			httputils.SendError(w, err)
+			return
+		}
+		response.DownloadURL = ""
+		response.ShareURL = h.newShareResponse(r, link).ShareURL
+	}
+
+	httputils.SendJSON(w, http.StatusOK, response)
+}
+
+// CancelTask removes a queued task from the queue or stops a running download
+func (h *YouTubeHandler) CancelTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		httputils.SendError(w, httputils.ErrMethodNotAllowed)
+		return
+	}
+
+	taskID := chi.URLParam(r, "task_id")
+	if taskID == "" {
+		httputils.SendError(w, httputils.ErrMissingTaskID)
+		return
+	}
+
+	payload, err := h.getOwnedTaskPayload(r.Context(), taskID)
+	if err != nil {
+		httputils.SendError(w, err)
+		return
+	}
+
+	// Cancelling twice is a no-op
+	if payload.Status == tasks.TaskStatusCancelled {
+		httputils.SendJSON(w, http.StatusOK, h.newTaskStatusResponse(r, taskID, payload))
+		return
+	}
+
 	info, err := h.asynqInspector.GetTaskInfo("default", taskID)
 	if err != nil {
 		log.Printf("Task not found: ID=%s", taskID)
@@ -114,39 +317,95 @@ func (h *YouTubeHandler) GetTaskStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var payload tasks.VideoDownloadPayload
-	if err := json.Unmarshal(info.Result, &payload); err != nil {
-		log.Printf("Failed to parse task result: ID=%s, Error=%v", taskID, err)
+	if info.State == asynq.TaskStateCompleted || info.State == asynq.TaskStateArchived {
+		httputils.SendError(w, httputils.NewError(http.StatusConflict, "Task has already finished"))
+		return
+	}
+
+	// A download shared by several requests keeps running until every one of them cancelled it.
+	// Callers that never requested the task, e.g. admins, cancel it for everyone.
+	attached, remaining, err := h.taskService.DetachCaller(r.Context(), taskID, submittedBy(r.Context()))
+	if err != nil {
+		log.Printf("Failed to detach caller: ID=%s, Error=%v", taskID, err)
+		httputils.SendError(w, httputils.ErrInternalServer)
+		return
+	}
+	if attached && remaining > 0 {
+		log.Printf("Caller detached from task: ID=%s, Remaining=%d", taskID, remaining)
+		response := h.newTaskStatusResponse(r, taskID, payload)
+		response.Detached = true
+		httputils.SendJSON(w, http.StatusOK, response)
+		return
+	}
+
+	// Record the cancelled state first: running tasks can't write their result once cancelled,
+	// and deleted tasks have no result at all
+	payload.Status = tasks.TaskStatusCancelled
+	payload.Progress = nil
+	data, _ := json.Marshal(payload)
+	if err := h.taskService.SaveFinalTaskState(r.Context(), taskID, data, h.config.TaskRetention); err != nil {
+		log.Printf("Failed to mark task as cancelled: ID=%s, Error=%v", taskID, err)
 		httputils.SendError(w, httputils.ErrInternalServer)
 		return
 	}
 
+	if info.State == asynq.TaskStateActive {
+		err = h.asynqInspector.CancelProcessing(taskID)
+	} else if err = h.asynqInspector.DeleteTask("default", taskID); err != nil {
+		// The task may have started since we looked at it
+		err = h.asynqInspector.CancelProcessing(taskID)
+	}
+	if err != nil {
+		log.Printf("Failed to cancel task: ID=%s, Error=%v", taskID, err)
+		httputils.SendError(w, httputils.NewError(http.StatusInternalServerError, "Failed to cancel task"))
+		return
+	}
+
+	// Let event streams know the task is over
+	if err := h.taskService.PublishTaskEvent(r.Context(), taskID, data); err != nil {
+		log.Printf("Failed to publish cancellation: ID=%s, Error=%v", taskID, err)
+	}
+	h.enqueuer.ReleaseInFlight(r.Context(), h.youtubeService.GetURLHash(payload.URL, payload.Options), taskID)
+
+	log.Printf("Task cancelled: ID=%s, State=%s", taskID, info.State)
+	httputils.SendJSON(w, http.StatusOK, h.newTaskStatusResponse(r, taskID, payload))
+}
+
+// newTaskStatusResponse builds the status response of a task from its latest state
+func (h *YouTubeHandler) newTaskStatusResponse(r *http.Request, taskID string, payload *tasks.VideoDownloadPayload) TaskStatusResponse {
 	response := TaskStatusResponse{
 		Status:       payload.Status,
+		Ephemeral:    payload.Options.EphemeralID != "",
+		APIKeyID:     payload.APIKeyID,
 		FilePath:     payload.FilePath,
 		Error:        payload.Error,
 		Title:        payload.Title,
 		ThumbnailURL: payload.ThumbnailURL,
 		Duration:     payload.Duration,
+		Progress:     payload.Progress,
 	}
 
 	// Add download URL if the task is completed and we have a file path
 	if payload.Status == tasks.TaskStatusCompleted && payload.FilePath != "" {
-		// Use the configured BaseURL if available
-		if h.config.BaseURL != "" {
-			response.DownloadURL = fmt.Sprintf("%s/api/videos/%s", h.config.BaseURL, taskID)
-		} else {
-			// Fallback: Construct the download URL using the host from the request
-			scheme := "http"
-			if r.TLS != nil {
-				scheme = "https"
-			}
-			host := r.Host
-			response.DownloadURL = fmt.Sprintf("%s://%s/api/videos/%s", scheme, host, taskID)
-		}
+		response.DownloadURL = h.absoluteURL(r, "/api/videos/"+taskID)
 	}
 
-	httputils.SendJSON(w, http.StatusOK, response)
+	return response
+}
+
+// absoluteURL turns an API path into an absolute URL
+func (h *YouTubeHandler) absoluteURL(r *http.Request, path string) string {
+	// Use the configured BaseURL if available
+	if h.config.BaseURL != "" {
+		return h.config.BaseURL + path
+	}
+
+	// Fallback: Construct the URL using the host from the request
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, path)
 }
 
 func (h *YouTubeHandler) ServeVideo(w http.ResponseWriter, r *http.Request) {
@@ -161,53 +420,149 @@ func (h *YouTubeHandler) ServeVideo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	info, err := h.asynqInspector.GetTaskInfo("default", taskID)
+	payload, filePath, err := h.ownedCompletedFile(r.Context(), taskID)
 	if err != nil {
-		log.Printf("Task not found: ID=%s", taskID)
-		httputils.SendError(w, httputils.ErrNotFound)
+		httputils.SendError(w, err)
 		return
 	}
 
-	var payload tasks.VideoDownloadPayload
-	if err := json.Unmarshal(info.Result, &payload); err != nil {
-		log.Printf("Failed to parse task result: ID=%s, Error=%v", taskID, err)
-		httputils.SendError(w, httputils.ErrInternalServer)
+	h.serveFile(w, r, taskID, payload, filePath, nil)
+}
+
+// serveFile sends the file of a completed task, redirecting to the store when it can hand the
+// file to the client directly. claim, if not nil, is called once the file is ready to be sent,
+// and the HTTP error it returns is sent instead.
+func (h *YouTubeHandler) serveFile(w http.ResponseWriter, r *http.Request, taskID string, payload *tasks.VideoDownloadPayload, filePath string, claim func() error) {
+	if claim == nil {
+		claim = func() error { return nil }
+	}
+	if err := h.checkByteQuota(r.Context()); err != nil {
+		sendQuotaError(w, err)
 		return
 	}
 
-	if payload.Status != tasks.TaskStatusCompleted || payload.FilePath == "" {
-		log.Printf("Video not ready: ID=%s, Status=%s", taskID, payload.Status)
-		httputils.SendError(w, httputils.NewError(http.StatusBadRequest, "Video download not completed"))
+	// Extract the original filename from the path and escape it for Content-Disposition header
+	downloadFileName := h.youtubeService.GetOriginalFilename(filePath, true)
+	contentDisposition := fmt.Sprintf(`attachment; filename="%s"`, downloadFileName)
+
+	// Object stores can hand the file to the client directly, except ephemeral files, which are
+	// deleted once the server saw the client receive them
+	ephemeral := payload.Options.EphemeralID != ""
+	if !ephemeral {
+		presignedURL, err := h.store.PresignedURL(r.Context(), storage.Key(filePath), contentDisposition)
+		if err == nil {
+			// Keep the file while the URL is valid, the client downloads it from the store directly
+			if err := h.youtubeService.HoldFileFor(r.Context(), filePath, h.config.S3PresignExpiry); err != nil {
+				log.Printf("Failed to hold file: ID=%s, Error=%v", taskID, err)
+				httputils.SendError(w, httputils.ErrInternalServer)
+				return
+			}
+			if err := claim(); err != nil {
+				httputils.SendError(w, err)
+				return
+			}
+			// The whole file counts as served, since the store's transfer can't be followed
+			if fileInfo, err := h.store.Stat(r.Context(), storage.Key(filePath)); err == nil {
+				h.recordServedBytes(r.Context(), fileInfo.Size)
+			}
+			log.Printf("Redirecting to stored file: ID=%s, File=%s", taskID, filePath)
+			http.Redirect(w, r, presignedURL, http.StatusFound)
+			return
+		}
+		if !errors.Is(err, storage.ErrNoPresignedURL) {
+			log.Printf("Warning: Failed to presign file, streaming it instead: ID=%s, Error=%v", taskID, err)
+		}
+	}
+
+	// Keep the cleanup service from deleting the file while it is streamed
+	release, err := h.youtubeService.HoldFile(r.Context(), filePath)
+	if err != nil {
+		log.Printf("Failed to hold file: ID=%s, Error=%v", taskID, err)
+		httputils.SendError(w, httputils.ErrInternalServer)
 		return
 	}
+	defer release()
 
 	// Open the file before setting headers
-	file, err := os.Open(payload.FilePath)
+	file, fileInfo, err := h.store.Open(r.Context(), storage.Key(filePath))
 	if err != nil {
 		log.Printf("Failed to open file: ID=%s, Error=%v", taskID, err)
 		httputils.SendError(w, httputils.ErrInternalServer)
 		return
 	}
 	defer file.Close()
-
-	// Get file info for content length
-	fileInfo, err := file.Stat()
-	if err != nil {
-		log.Printf("Failed to get file info: ID=%s, Error=%v", taskID, err)
-		httputils.SendError(w, httputils.ErrInternalServer)
+	if err := claim(); err != nil {
+		httputils.SendError(w, err)
 		return
 	}
 
-	// Extract the original filename from the path and escape it for Content-Disposition header
-	downloadFileName := h.youtubeService.GetOriginalFilename(payload.FilePath, true)
-
 	// Set headers with the original title for the download
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, downloadFileName))
-	w.Header().Set("Content-Type", "video/mp4")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
+	w.Header().Set("Content-Disposition", contentDisposition)
+	w.Header().Set("Content-Type", h.youtubeService.GetContentType(filePath))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size))
+
+	log.Printf("Serving file: ID=%s, File=%s, Title=%s", taskID, filePath, downloadFileName)
 
-	log.Printf("Serving video: ID=%s, File=%s, Title=%s", taskID, payload.FilePath, downloadFileName)
+	// Serve the file, counting what was sent against the API key's byte quota. Ephemeral files are
+	// deleted once the client received all of them, possibly over several range requests resuming
+	// aborted transfers.
+	transfer := httputils.NewCleanupResponseWriter(w, func(status int, written int64) {
+		ctx := context.WithoutCancel(r.Context())
+		h.recordServedBytes(ctx, written)
+		if ephemeral {
+			start := transferStart(status, w.Header())
+			h.finishEphemeralTransfer(ctx, taskID, filePath, fileInfo.Size, start, written, release)
+		}
+	})
+	http.ServeContent(transfer, r, fileInfo.Key, fileInfo.ModTime, file)
+	file.Close()
+	transfer.Close()
+}
+
+// finishEphemeralTransfer records what a transfer of an ephemeral file delivered, and deletes the
+// file and its Redis keys once the client received all of it. A negative start means the
+// response didn't send a single part of the file.
+func (h *YouTubeHandler) finishEphemeralTransfer(ctx context.Context, taskID string, filePath string, size int64, start int64, written int64, release func()) {
+	if start < 0 || written == 0 {
+		return
+	}
+
+	received, err := h.taskService.RecordTransfer(ctx, taskID, start, written, h.config.TaskRetention)
+	if err != nil {
+		log.Printf("Failed to record ephemeral transfer: ID=%s, Error=%v", taskID, err)
+		return
+	}
+	if received < size {
+		log.Printf("Ephemeral file not fully received yet: ID=%s, Received=%d/%d bytes", taskID, received, size)
+		return
+	}
+
+	// This transfer's own lease would keep the file
+	release()
+	err = h.youtubeService.DeleteFile(ctx, filePath)
+	if errors.Is(err, services.ErrFileHeld) {
+		// The transfer holding it deletes it when it is done
+		log.Printf("Ephemeral file received but still in use: ID=%s, File=%s", taskID, filePath)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete ephemeral file: ID=%s, Error=%v", taskID, err)
+		return
+	}
+	log.Printf("Deleted ephemeral file after it was received: ID=%s, File=%s", taskID, filePath)
+}
 
-	// Serve the file
-	http.ServeContent(w, r, fileInfo.Name(), fileInfo.ModTime(), file)
+// transferStart returns the offset of the file a response started sending at, or -1 if it didn't
+// send a single part of the file (errors, not modified responses and multipart ranges)
+func transferStart(status int, header http.Header) int64 {
+	switch status {
+	case http.StatusOK:
+		return 0
+	case http.StatusPartialContent:
+		var start, end, size int64
+		if _, err := fmt.Sscanf(header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err == nil {
+			return start
+		}
+	}
+	return -1
 }
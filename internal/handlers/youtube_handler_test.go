@@ -2,15 +2,27 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"spiropoulos94/youtube-downloader/internal/storage"
+	"spiropoulos94/youtube-downloader/internal/tasks"
+	"spiropoulos94/youtube-downloader/internal/validators"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // This test file focuses on testing basic handler functionality
@@ -61,6 +73,38 @@ func TestDownloadVideoInvalidJSON(t *testing.T) {
 	assert.Contains(t, string(body), "Bad request")
 }
 
+func TestGetVideoInfoValidation(t *testing.T) {
+	// Invalid requests are rejected before the nil service is used
+	handler := &YouTubeHandler{urlValidator: validators.NewSourceRegistry(&config.Config{Sources: []string{validators.SourceYouTube}})}
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "method not allowed", method: http.MethodPost, url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", wantStatus: http.StatusMethodNotAllowed, wantBody: "Method not allowed"},
+		{name: "missing url", method: http.MethodGet, url: "", wantStatus: http.StatusBadRequest, wantBody: "URL cannot be empty"},
+		{name: "not a YouTube url", method: http.MethodGet, url: "https://vimeo.com/12345", wantStatus: http.StatusBadRequest, wantBody: "not a URL of a supported site (youtube)"},
+		{name: "look-alike host", method: http.MethodGet, url: "https://youtube.com.evil.example/watch?v=dQw4w9WgXcQ", wantStatus: http.StatusBadRequest, wantBody: `"code":"unsupported_host"`},
+		{name: "invalid video ID", method: http.MethodGet, url: "https://youtu.be/tooShort", wantStatus: http.StatusBadRequest, wantBody: `"code":"invalid_video_id"`},
+		{name: "playlist", method: http.MethodGet, url: "https://www.youtube.com/playlist?list=PL123", wantStatus: http.StatusBadRequest, wantBody: "only available for single videos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/info?url="+url.QueryEscape(tt.url), nil)
+			w := httptest.NewRecorder()
+
+			handler.GetVideoInfo(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
 func TestGetTaskStatusMethodNotAllowed(t *testing.T) {
 	// Create a handler with nil dependencies
 	handler := &YouTubeHandler{}
@@ -110,6 +154,77 @@ func TestGetTaskStatusWithTaskID(t *testing.T) {
 	t.Skip("Skipping test that requires a non-nil asynq inspector")
 }
 
+// Tasks of other API keys are reported as not found
+func TestGetTaskStatusOwnership(t *testing.T) {
+	state, err := json.Marshal(tasks.VideoDownloadPayload{Status: tasks.TaskStatusPending, APIKeyID: "owner"})
+	require.NoError(t, err)
+	handler := &YouTubeHandler{
+		config:     &config.Config{},
+		taskLookup: newTaskLookup(nil, &transferTaskService{state: state, callers: map[string]bool{"attached": true}}, nil, nil),
+	}
+
+	tests := []struct {
+		name       string
+		apiKey     *services.APIKey
+		wantStatus int
+	}{
+		{"Authentication disabled", nil, http.StatusOK},
+		{"Owner", &services.APIKey{ID: "owner"}, http.StatusOK},
+		{"Attached caller", &services.APIKey{ID: "attached"}, http.StatusOK},
+		{"Admin", &services.APIKey{ID: "admin", Admin: true}, http.StatusOK},
+		{"Other key", &services.APIKey{ID: "other"}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/tasks/task", nil)
+			if tt.apiKey != nil {
+				req = req.WithContext(services.WithAPIKey(req.Context(), tt.apiKey))
+			}
+			req = withURLParams(req, map[string]string{"task_id": "task"})
+			w := httptest.NewRecorder()
+			handler.GetTaskStatus(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+// Videos and event streams of another API key's task are reported as not found
+func TestTaskRoutesOwnership(t *testing.T) {
+	state, err := json.Marshal(tasks.VideoDownloadPayload{Status: tasks.TaskStatusCompleted, FilePath: "video.mp4", APIKeyID: "owner"})
+	require.NoError(t, err)
+	handler := &YouTubeHandler{
+		config:     &config.Config{},
+		taskLookup: newTaskLookup(nil, &transferTaskService{state: state}, nil, nil),
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		params  map[string]string
+		handler http.HandlerFunc
+	}{
+		{"Video", "/api/videos/task", map[string]string{"task_id": "task"}, handler.ServeVideo},
+		{"Events", "/api/tasks/task/events", map[string]string{"task_id": "task"}, handler.StreamTaskEvents},
+		{"Multi events", "/api/tasks/events?ids=task", nil, handler.StreamMultiTaskEvents},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req = req.WithContext(services.WithAPIKey(req.Context(), &services.APIKey{ID: "other"}))
+			if tt.params != nil {
+				req = withURLParams(req, tt.params)
+			}
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+	}
+}
+
 func TestServeVideoMethodNotAllowed(t *testing.T) {
 	// Create a handler with nil dependencies
 	handler := &YouTubeHandler{}
@@ -159,6 +274,144 @@ func TestServeVideoWithTaskID(t *testing.T) {
 	t.Skip("Skipping test that requires a non-nil asynq inspector")
 }
 
+func TestCancelTaskMethodNotAllowed(t *testing.T) {
+	// Create a handler with nil dependencies
+	handler := &YouTubeHandler{}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks/task-id", nil)
+	w := httptest.NewRecorder()
+
+	handler.CancelTask(w, req)
+
+	resp := w.Result()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestCancelTaskMissingTaskID(t *testing.T) {
+	// Create a handler with nil dependencies
+	handler := &YouTubeHandler{}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/tasks/", nil)
+	w := httptest.NewRecorder()
+
+	handler.CancelTask(w, req)
+
+	resp := w.Result()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Contains(t, string(body), "Missing task ID")
+}
+
+func TestStreamTaskEventsMethodNotAllowed(t *testing.T) {
+	// Create a handler with nil dependencies
+	handler := &YouTubeHandler{}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks/task-id/events", nil)
+	w := httptest.NewRecorder()
+
+	handler.StreamTaskEvents(w, req)
+
+	resp := w.Result()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestStreamTaskEventsMissingTaskID(t *testing.T) {
+	// Create a handler with nil dependencies
+	handler := &YouTubeHandler{}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tasks//events", nil)
+	w := httptest.NewRecorder()
+
+	handler.StreamTaskEvents(w, req)
+
+	resp := w.Result()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Contains(t, string(body), "Missing task ID")
+}
+
+func TestStreamMultiTaskEventsValidation(t *testing.T) {
+	// Create a handler with nil dependencies
+	handler := &YouTubeHandler{}
+
+	// One more distinct task ID than a stream may watch
+	tooManyIDs := make([]string, 0, maxStreamedTasks+1)
+	for i := 0; i <= maxStreamedTasks; i++ {
+		tooManyIDs = append(tooManyIDs, fmt.Sprintf("task-%d", i))
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		wantBody string
+	}{
+		{name: "No ids", query: "", wantBody: "Missing task ID"},
+		{name: "Only blank ids", query: "?ids=,,", wantBody: "Missing task ID"},
+		{name: "Too many ids", query: "?ids=" + strings.Join(tooManyIDs, ","), wantBody: "Cannot stream more than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/tasks/events"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.StreamMultiTaskEvents(w, req)
+
+			resp := w.Result()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Contains(t, string(body), tt.wantBody)
+		})
+	}
+}
+
+func TestParseTaskIDs(t *testing.T) {
+	assert.Nil(t, parseTaskIDs(""))
+	assert.Equal(t, []string{"a", "b"}, parseTaskIDs("a, b,,a"))
+}
+
+func TestParseTimeout(t *testing.T) {
+	h := &YouTubeHandler{config: &config.Config{
+		DownloadTimeout:    time.Hour,
+		MaxDownloadTimeout: 2 * time.Hour,
+	}}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "default", value: "", want: time.Hour},
+		{name: "custom", value: "30m", want: 30 * time.Minute},
+		{name: "maximum", value: "2h", want: 2 * time.Hour},
+		{name: "too long", value: "3h", wantErr: true},
+		{name: "zero", value: "0s", wantErr: true},
+		{name: "negative", value: "-5m", wantErr: true},
+		{name: "invalid", value: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.parseTimeout(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
 // TestResponseHeaders tests the content-type headers of the responses
 func TestResponseHeaders(t *testing.T) {
 	// Create a handler with nil dependencies
@@ -274,3 +527,96 @@ func TestServeVideoIntegration(t *testing.T) {
 	t.Log("This test needs a properly mocked asynq.Inspector to fully test serving video files")
 	t.Logf("Mock result prepared: %s", string(mockResultBytes))
 }
+
+// transferTaskService is a TaskServiceInterface serving the final state of one task and
+// recording its transfers in memory
+type transferTaskService struct {
+	services.TaskServiceInterface
+	state    []byte
+	received int64
+	callers  map[string]bool // API keys attached to the task
+}
+
+func (s *transferTaskService) IsCaller(ctx context.Context, taskID string, callerID string) (bool, error) {
+	return s.callers[callerID], nil
+}
+
+func (s *transferTaskService) GetFinalTaskState(ctx context.Context, taskID string) ([]byte, error) {
+	return s.state, nil
+}
+
+func (s *transferTaskService) RecordTransfer(ctx context.Context, taskID string, start int64, length int64, retention time.Duration) (int64, error) {
+	if start <= s.received && start+length > s.received {
+		s.received = start + length
+	}
+	return s.received, nil
+}
+
+// Ephemeral files are deleted once every byte was received, over one or several range requests
+func TestServeEphemeralVideo(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "Test Video_0123456789abcdef.mp4")
+	content := []byte("0123456789")
+
+	state, err := json.Marshal(tasks.VideoDownloadPayload{
+		Status:   tasks.TaskStatusCompleted,
+		FilePath: filePath,
+		Options:  services.DownloadOptions{EphemeralID: "task"},
+	})
+	require.NoError(t, err)
+
+	serve := func(taskService *transferTaskService, rangeHeader string) int {
+		store := storage.NewLocalStore(dir)
+		handler := &YouTubeHandler{
+			config: &config.Config{OutputDir: dir},
+			taskLookup: newTaskLookup(
+				services.NewYouTubeService(&config.Config{OutputDir: dir}, nil, store, nil, nil, nil),
+				taskService,
+				nil,
+				store,
+			),
+		}
+		req := httptest.NewRequest(http.MethodGet, "/api/videos/task", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("task_id", "task")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+		handler.ServeVideo(w, req)
+		return w.Code
+	}
+
+	t.Run("Single transfer", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filePath, content, 0644))
+		assert.Equal(t, http.StatusOK, serve(&transferTaskService{state: state}, ""))
+		assert.NoFileExists(t, filePath)
+	})
+
+	t.Run("Resumed transfer", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filePath, content, 0644))
+		taskService := &transferTaskService{state: state}
+
+		assert.Equal(t, http.StatusPartialContent, serve(taskService, "bytes=0-3"))
+		assert.FileExists(t, filePath)
+
+		// Seeking past what was received doesn't count
+		assert.Equal(t, http.StatusPartialContent, serve(taskService, "bytes=6-"))
+		assert.FileExists(t, filePath)
+
+		assert.Equal(t, http.StatusPartialContent, serve(taskService, "bytes=4-"))
+		assert.NoFileExists(t, filePath)
+	})
+}
+
+func TestTransferStart(t *testing.T) {
+	partial := http.Header{}
+	partial.Set("Content-Range", "bytes 100-199/1000")
+
+	assert.Equal(t, int64(0), transferStart(http.StatusOK, http.Header{}))
+	assert.Equal(t, int64(100), transferStart(http.StatusPartialContent, partial))
+	assert.Equal(t, int64(-1), transferStart(http.StatusPartialContent, http.Header{}))
+	assert.Equal(t, int64(-1), transferStart(http.StatusNotModified, http.Header{}))
+}
@@ -2,17 +2,28 @@ package httputils
 
 import "net/http"
 
-// CleanupResponseWriter wraps http.ResponseWriter to handle cleanup after closing the response
+// CleanupResponseWriter wraps http.ResponseWriter to run a cleanup function once the response is
+// done, with what the response actually delivered to the client
 type CleanupResponseWriter struct {
 	http.ResponseWriter
-	cleanup func()
+	cleanup func(status int, written int64)
+	status  int
+	written int64 // Body bytes accepted by the connection
 }
 
 func (w *CleanupResponseWriter) Write(b []byte) (int, error) {
-	return w.ResponseWriter.Write(b)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
 }
 
 func (w *CleanupResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
@@ -22,8 +33,19 @@ func (w *CleanupResponseWriter) Flush() {
 	}
 }
 
+// Close runs the cleanup function with the status code and the number of body bytes written.
+// It runs at most once.
+func (w *CleanupResponseWriter) Close() {
+	if w.cleanup == nil {
+		return
+	}
+	cleanup := w.cleanup
+	w.cleanup = nil
+	cleanup(w.status, w.written)
+}
+
 // NewCleanupResponseWriter creates a new CleanupResponseWriter
-func NewCleanupResponseWriter(w http.ResponseWriter, cleanup func()) *CleanupResponseWriter {
+func NewCleanupResponseWriter(w http.ResponseWriter, cleanup func(status int, written int64)) *CleanupResponseWriter {
 	return &CleanupResponseWriter{
 		ResponseWriter: w,
 		cleanup:        cleanup,
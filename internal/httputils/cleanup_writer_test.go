@@ -0,0 +1,48 @@
+package httputils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCleanupResponseWriter(t *testing.T) {
+	var calls int
+	var gotStatus int
+	var gotWritten int64
+	w := NewCleanupResponseWriter(httptest.NewRecorder(), func(status int, written int64) {
+		calls++
+		gotStatus, gotWritten = status, written
+	})
+
+	w.WriteHeader(http.StatusPartialContent)
+	w.WriteHeader(http.StatusOK) // Superfluous, the first status is the one sent
+	w.Write([]byte("hello"))
+	w.Write([]byte(" world"))
+	w.Close()
+	w.Close()
+
+	if calls != 1 {
+		t.Errorf("cleanup ran %d times, want 1", calls)
+	}
+	if gotStatus != http.StatusPartialContent {
+		t.Errorf("status = %d, want %d", gotStatus, http.StatusPartialContent)
+	}
+	if gotWritten != 11 {
+		t.Errorf("written = %d, want 11", gotWritten)
+	}
+}
+
+func TestCleanupResponseWriterImplicitStatus(t *testing.T) {
+	var gotStatus int
+	w := NewCleanupResponseWriter(httptest.NewRecorder(), func(status int, written int64) {
+		gotStatus = status
+	})
+
+	w.Write([]byte("hello"))
+	w.Close()
+
+	if gotStatus != http.StatusOK {
+		t.Errorf("status = %d, want %d", gotStatus, http.StatusOK)
+	}
+}
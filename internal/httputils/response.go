@@ -10,6 +10,7 @@ type Response struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"` // Machine readable error code, if the error has one
 }
 
 // SendJSON writes a successful JSON response
@@ -26,6 +27,7 @@ func SendJSON(w http.ResponseWriter, status int, data interface{}) {
 type HTTPError struct {
 	Message    string
 	StatusCode int
+	Code       string // Optional machine readable code, e.g. "invalid_video_id"
 }
 
 func (e *HTTPError) Error() string {
@@ -35,8 +37,10 @@ func (e *HTTPError) Error() string {
 // SendError writes a JSON error response
 func SendError(w http.ResponseWriter, err error) {
 	status := http.StatusInternalServerError
+	var code string
 	if httpErr, ok := err.(*HTTPError); ok {
 		status = httpErr.StatusCode
+		code = httpErr.Code
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -44,6 +48,7 @@ func SendError(w http.ResponseWriter, err error) {
 	json.NewEncoder(w).Encode(Response{
 		Success: false,
 		Error:   err.Error(),
+		Code:    code,
 	})
 }
 
@@ -60,6 +65,15 @@ func NewError(status int, message string) *HTTPError {
 	}
 }
 
+// NewCodedError creates a new HTTPError with a machine readable code clients can act on
+func NewCodedError(status int, code string, message string) *HTTPError {
+	return &HTTPError{
+		StatusCode: status,
+		Code:       code,
+		Message:    message,
+	}
+}
+
 // Common HTTP errors
 var (
 	ErrBadRequest         = NewError(http.StatusBadRequest, "Bad request")
@@ -75,4 +89,7 @@ var (
 var (
 	ErrTaskNotFound  = NewError(http.StatusNotFound, "Task not found")
 	ErrMissingTaskID = NewError(http.StatusBadRequest, "Missing task ID")
+
+	ErrVideoNotFound    = NewError(http.StatusNotFound, "Video not found")
+	ErrMissingVideoHash = NewError(http.StatusBadRequest, "Missing video hash")
 )
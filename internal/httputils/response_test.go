@@ -100,6 +100,12 @@ func TestSendError(t *testing.T) {
 			wantStatus: http.StatusBadRequest,
 			wantBody:   `{"success":false,"error":"Invalid input"}`,
 		},
+		{
+			name:       "Coded error",
+			err:        NewCodedError(http.StatusBadRequest, "invalid_video_id", "invalid video ID"),
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"success":false,"error":"invalid video ID","code":"invalid_video_id"}`,
+		},
 		{
 			name:       "Predefined error",
 			err:        ErrNotFound,
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"strings"
+)
+
+// AccessTokenParam is the query parameter the event streams take the API key in
+const AccessTokenParam = "access_token"
+
+// AuthMiddleware implements AuthMiddlewareInterface with API keys
+type AuthMiddleware struct {
+	config        *config.Config
+	apiKeyService services.APIKeyServiceInterface
+}
+
+// NewAuthMiddleware creates a new instance of AuthMiddleware
+func NewAuthMiddleware(config *config.Config, apiKeyService services.APIKeyServiceInterface) AuthMiddlewareInterface {
+	return &AuthMiddleware{
+		config:        config,
+		apiKeyService: apiKeyService,
+	}
+}
+
+// RequireAPIKey rejects requests without a valid API key, and adds the key to the context of the
+// others. Keys are sent in the X-API-Key header or as a bearer token. Every request passes while
+// authentication is disabled.
+func (m *AuthMiddleware) RequireAPIKey(next http.Handler) http.Handler {
+	return m.requireKey(next, requestAPIKey)
+}
+
+// RequireStreamAPIKey is RequireAPIKey for the Server-Sent Events streams. Browsers' EventSource
+// can't send headers, so the key may also be sent in the access_token query parameter.
+func (m *AuthMiddleware) RequireStreamAPIKey(next http.Handler) http.Handler {
+	return m.requireKey(next, func(r *http.Request) string {
+		if key := requestAPIKey(r); key != "" {
+			return key
+		}
+		return r.URL.Query().Get(AccessTokenParam)
+	})
+}
+
+// requireKey rejects requests without a valid API key, reading the key with keyOf
+func (m *AuthMiddleware) requireKey(next http.Handler, keyOf func(r *http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.config.AuthEnabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := keyOf(r)
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			httputils.SendError(w, httputils.ErrUnauthorized)
+			return
+		}
+
+		apiKey, err := m.apiKeyService.Authenticate(r.Context(), key)
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+			httputils.SendError(w, httputils.ErrUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to authenticate API key: Error=%v", err)
+			httputils.SendError(w, httputils.ErrInternalServer)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(services.WithAPIKey(r.Context(), apiKey)))
+	})
+}
+
+// RequireAdmin rejects requests whose API key isn't an admin key. It must run after RequireAPIKey.
+func (m *AuthMiddleware) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.config.AuthEnabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if apiKey := services.APIKeyFromContext(r.Context()); apiKey == nil || !apiKey.Admin {
+			httputils.SendError(w, httputils.ErrForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestAPIKey returns the API key a request was sent with, if any
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// RedactAccessToken hides the API key sent in the access_token query parameter from the request
+// URI, so request logs don't record it. It must run before the logger.
+func RedactAccessToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.Query().Has(AccessTokenParam) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		query.Set(AccessTokenParam, "REDACTED")
+		redacted := *r.URL
+		redacted.RawQuery = query.Encode()
+
+		// Routing and authentication read r.URL, which keeps the key
+		r = r.Clone(r.Context())
+		r.RequestURI = redacted.RequestURI()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// staticAPIKeys is an APIKeyServiceInterface authenticating a fixed set of keys
+type staticAPIKeys struct {
+	services.APIKeyServiceInterface
+	keys map[string]*services.APIKey
+}
+
+func (s *staticAPIKeys) Authenticate(ctx context.Context, key string) (*services.APIKey, error) {
+	apiKey, ok := s.keys[key]
+	if !ok {
+		return nil, services.ErrInvalidAPIKey
+	}
+	return apiKey, nil
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	apiKeys := &staticAPIKeys{keys: map[string]*services.APIKey{
+		"user.secret":  {ID: "user"},
+		"admin.secret": {ID: "admin", Admin: true},
+	}}
+
+	// The handler reports the ID of the key it was called with
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiKey := services.APIKeyFromContext(r.Context()); apiKey != nil {
+			w.Write([]byte(apiKey.ID))
+		}
+	})
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		admin    bool
+		header   string
+		value    string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Disabled", wantCode: http.StatusOK},
+		{name: "Disabled admin route", admin: true, wantCode: http.StatusOK},
+		{name: "Missing key", enabled: true, wantCode: http.StatusUnauthorized},
+		{name: "Invalid key", enabled: true, header: "X-API-Key", value: "user.wrong", wantCode: http.StatusUnauthorized},
+		{name: "Header", enabled: true, header: "X-API-Key", value: "user.secret", wantCode: http.StatusOK, wantBody: "user"},
+		{name: "Bearer token", enabled: true, header: "Authorization", value: "Bearer user.secret", wantCode: http.StatusOK, wantBody: "user"},
+		{name: "Admin route without admin key", enabled: true, admin: true, header: "X-API-Key", value: "user.secret", wantCode: http.StatusForbidden},
+		{name: "Admin route", enabled: true, admin: true, header: "X-API-Key", value: "admin.secret", wantCode: http.StatusOK, wantBody: "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := NewAuthMiddleware(&config.Config{AuthEnabled: tt.enabled}, apiKeys)
+			route := auth.RequireAPIKey(handler)
+			if tt.admin {
+				route = auth.RequireAPIKey(auth.RequireAdmin(handler))
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/tasks/123", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			route.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusUnauthorized {
+				assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireStreamAPIKey(t *testing.T) {
+	apiKeys := &staticAPIKeys{keys: map[string]*services.APIKey{"user.secret": {ID: "user"}}}
+	auth := NewAuthMiddleware(&config.Config{AuthEnabled: true}, apiKeys)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(services.APIKeyFromContext(r.Context()).ID))
+	})
+
+	serve := func(route http.Handler, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		route.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// Event streams take the key as a query parameter, since EventSource can't send headers
+	w := serve(auth.RequireStreamAPIKey(handler), "/api/tasks/123/events?access_token=user.secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user", w.Body.String())
+
+	w = serve(auth.RequireStreamAPIKey(handler), "/api/tasks/123/events?access_token=user.wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Other endpoints don't
+	w = serve(auth.RequireAPIKey(handler), "/api/tasks/123?access_token=user.secret")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRedactAccessToken(t *testing.T) {
+	var requestURI, token string
+	handler := RedactAccessToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURI = r.RequestURI
+		token = r.URL.Query().Get(AccessTokenParam)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/tasks/events?ids=a,b&access_token=user.secret", nil))
+	assert.NotContains(t, requestURI, "user.secret")
+	assert.Contains(t, requestURI, "access_token=REDACTED")
+	assert.Equal(t, "user.secret", token)
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// AuthMiddlewareInterface defines the contract for the middleware authenticating API requests
+type AuthMiddlewareInterface interface {
+	RequireAPIKey(next http.Handler) http.Handler
+	RequireStreamAPIKey(next http.Handler) http.Handler
+	RequireAdmin(next http.Handler) http.Handler
+}
+
+// RateLimitMiddlewareInterface defines the contract for the middleware rate limiting API requests
+type RateLimitMiddlewareInterface interface {
+	Limit(route string) func(http.Handler) http.Handler
+}
+
+// MonitoringMiddlewareInterface defines the contract for the middleware protecting the monitoring dashboard
+type MonitoringMiddlewareInterface interface {
+	Protect(next http.Handler) http.Handler
+}
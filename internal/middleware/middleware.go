@@ -0,0 +1,7 @@
+package middleware
+
+type Middlewares struct {
+	Auth       AuthMiddlewareInterface
+	RateLimit  RateLimitMiddlewareInterface
+	Monitoring MonitoringMiddlewareInterface
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/netip"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/services"
+)
+
+// MonitoringMiddleware implements MonitoringMiddlewareInterface with a network allowlist, basic
+// auth and admin API keys
+type MonitoringMiddleware struct {
+	config        *config.Config
+	apiKeyService services.APIKeyServiceInterface
+}
+
+// NewMonitoringMiddleware creates a new instance of MonitoringMiddleware
+func NewMonitoringMiddleware(config *config.Config, apiKeyService services.APIKeyServiceInterface) MonitoringMiddlewareInterface {
+	return &MonitoringMiddleware{
+		config:        config,
+		apiKeyService: apiKeyService,
+	}
+}
+
+// Protect only lets requests to the monitoring dashboard through from the allowed networks, if
+// any are configured, and with credentials, if any are configured: the MONITORING_PASSWORD of
+// MONITORING_USER or, with authentication enabled, an admin API key. Browsers send either as
+// basic auth, with any user name for API keys, and API clients can also send API keys in their
+// usual headers.
+func (m *MonitoringMiddleware) Protect(next http.Handler) http.Handler {
+	if !m.protected() && m.config.Monitoring == config.MonitoringFull {
+		log.Println("Warning: The monitoring dashboard is not protected, anyone reaching /monitoring can manage the task queue")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.allowedNetwork(r) {
+			httputils.SendError(w, httputils.ErrForbidden)
+			return
+		}
+
+		if m.config.MonitoringPassword == "" && !m.config.AuthEnabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authenticated, err := m.authenticate(r)
+		if err != nil {
+			log.Printf("Failed to authenticate monitoring request: Error=%v", err)
+			httputils.SendError(w, httputils.ErrInternalServer)
+			return
+		}
+		if !authenticated {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Monitoring"`)
+			httputils.SendError(w, httputils.ErrUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// protected reports whether any protection of the dashboard is configured
+func (m *MonitoringMiddleware) protected() bool {
+	return len(m.config.MonitoringNetworks) > 0 || m.config.MonitoringPassword != "" || m.config.AuthEnabled
+}
+
+// allowedNetwork reports whether a request comes from one of the allowed networks, or any
+// network is allowed
+func (m *MonitoringMiddleware) allowedNetwork(r *http.Request) bool {
+	if len(m.config.MonitoringNetworks) == 0 {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(clientIP(r, m.config.TrustProxy))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, network := range m.config.MonitoringNetworks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate reports whether a request carries the dashboard's password or an admin API key
+func (m *MonitoringMiddleware) authenticate(r *http.Request) (bool, error) {
+	user, password, hasBasicAuth := r.BasicAuth()
+	if hasBasicAuth && m.config.MonitoringPassword != "" {
+		userMatches := subtle.ConstantTimeCompare([]byte(user), []byte(m.config.MonitoringUser)) == 1
+		passwordMatches := subtle.ConstantTimeCompare([]byte(password), []byte(m.config.MonitoringPassword)) == 1
+		if userMatches && passwordMatches {
+			return true, nil
+		}
+	}
+
+	if !m.config.AuthEnabled {
+		return false, nil
+	}
+	key := requestAPIKey(r)
+	if key == "" && hasBasicAuth {
+		key = password
+	}
+	if key == "" {
+		return false, nil
+	}
+	apiKey, err := m.apiKeyService.Authenticate(r.Context(), key)
+	if errors.Is(err, services.ErrInvalidAPIKey) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return apiKey.Admin, nil
+}
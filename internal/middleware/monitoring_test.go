@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitoringMiddleware(t *testing.T) {
+	apiKeys := &staticAPIKeys{keys: map[string]*services.APIKey{
+		"user.secret":  {ID: "user"},
+		"admin.secret": {ID: "admin", Admin: true},
+	}}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	internal := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		config     config.Config
+		remoteAddr string
+		user       string
+		password   string
+		apiKey     string
+		wantCode   int
+	}{
+		{name: "Unprotected", wantCode: http.StatusOK},
+		{name: "Allowed network", config: config.Config{MonitoringNetworks: internal}, remoteAddr: "10.1.2.3:1234", wantCode: http.StatusOK},
+		{name: "Other network", config: config.Config{MonitoringNetworks: internal}, remoteAddr: "203.0.113.5:1234", wantCode: http.StatusForbidden},
+		{name: "Missing password", config: config.Config{MonitoringUser: "admin", MonitoringPassword: "pass"}, wantCode: http.StatusUnauthorized},
+		{name: "Wrong password", config: config.Config{MonitoringUser: "admin", MonitoringPassword: "pass"}, user: "admin", password: "wrong", wantCode: http.StatusUnauthorized},
+		{name: "Wrong user", config: config.Config{MonitoringUser: "admin", MonitoringPassword: "pass"}, user: "root", password: "pass", wantCode: http.StatusUnauthorized},
+		{name: "Password", config: config.Config{MonitoringUser: "admin", MonitoringPassword: "pass"}, user: "admin", password: "pass", wantCode: http.StatusOK},
+		{name: "Password from other network", config: config.Config{MonitoringUser: "admin", MonitoringPassword: "pass", MonitoringNetworks: internal}, remoteAddr: "203.0.113.5:1234", user: "admin", password: "pass", wantCode: http.StatusForbidden},
+		{name: "Admin key as password", config: config.Config{AuthEnabled: true}, user: "anyone", password: "admin.secret", wantCode: http.StatusOK},
+		{name: "Admin key header", config: config.Config{AuthEnabled: true}, apiKey: "admin.secret", wantCode: http.StatusOK},
+		{name: "User key", config: config.Config{AuthEnabled: true}, apiKey: "user.secret", wantCode: http.StatusUnauthorized},
+		{name: "Invalid key", config: config.Config{AuthEnabled: true}, user: "anyone", password: "admin.wrong", wantCode: http.StatusUnauthorized},
+		{name: "Password with authentication enabled", config: config.Config{AuthEnabled: true, MonitoringUser: "admin", MonitoringPassword: "pass"}, user: "admin", password: "pass", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.config
+			route := NewMonitoringMiddleware(&cfg, apiKeys).Protect(handler)
+
+			req := httptest.NewRequest(http.MethodGet, "/monitoring/api/queues", nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if tt.user != "" || tt.password != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			w := httptest.NewRecorder()
+			route.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusUnauthorized {
+				assert.Equal(t, `Basic realm="Monitoring"`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/httputils"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitMiddleware implements RateLimitMiddlewareInterface with a Redis-backed rate limiter
+type RateLimitMiddleware struct {
+	config  *config.Config
+	limiter services.RateLimiterInterface
+}
+
+// NewRateLimitMiddleware creates a new instance of RateLimitMiddleware
+func NewRateLimitMiddleware(config *config.Config, limiter services.RateLimiterInterface) RateLimitMiddlewareInterface {
+	return &RateLimitMiddleware{
+		config:  config,
+		limiter: limiter,
+	}
+}
+
+// Limit returns a middleware applying the configured limit of a route group to each client, keyed
+// by API key or, without one, by IP. Routes without a configured limit aren't limited. Requests
+// are let through if Redis can't be reached, so an outage doesn't take down the API.
+func (m *RateLimitMiddleware) Limit(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		limit, ok := m.config.RateLimits[route]
+		if !ok {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := m.limiter.Allow(r.Context(), route, m.client(r), limit)
+			if err != nil {
+				log.Printf("Failed to check rate limit: Route=%s, Error=%v", route, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Window.Seconds())))
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(seconds(result.ResetAfter)))
+			if !result.Allowed {
+				header.Set("Retry-After", strconv.Itoa(max(seconds(result.RetryAfter), 1)))
+				httputils.SendError(w, httputils.NewCodedError(http.StatusTooManyRequests, "rate_limited",
+					fmt.Sprintf("Rate limit of %d requests per %s exceeded", limit.Requests, limit.Window)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// client identifies who a request is counted against: its API key, or its IP without one
+func (m *RateLimitMiddleware) client(r *http.Request) string {
+	if apiKey := services.APIKeyFromContext(r.Context()); apiKey != nil {
+		return "key:" + apiKey.ID
+	}
+	return "ip:" + clientIP(r, m.config.TrustProxy)
+}
+
+// clientIP returns the IP a request comes from. Behind a trusted reverse proxy it is the first
+// address of X-Forwarded-For, or X-Real-IP; the headers are ignored otherwise, since any client
+// can set them.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// seconds rounds a duration up to whole seconds, as rate limit headers carry them
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingLimiter is a RateLimiterInterface allowing a fixed number of requests per route and
+// client, without ever refilling
+type countingLimiter struct {
+	counts map[string]int
+	err    error
+}
+
+func (l *countingLimiter) Allow(ctx context.Context, route string, client string, limit config.RateLimit) (*services.RateLimitResult, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	key := route + "|" + client
+	if l.counts[key] >= limit.Requests {
+		return &services.RateLimitResult{Limit: limit.Requests, ResetAfter: limit.Window, RetryAfter: 1500 * time.Millisecond}, nil
+	}
+	l.counts[key]++
+	return &services.RateLimitResult{Allowed: true, Limit: limit.Requests, Remaining: limit.Requests - l.counts[key], ResetAfter: limit.Window}, nil
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	cfg := &config.Config{RateLimits: map[string]config.RateLimit{"download": {Requests: 2, Window: time.Minute}}}
+	limiter := &countingLimiter{counts: map[string]int{}}
+	rateLimit := NewRateLimitMiddleware(cfg, limiter)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	route := rateLimit.Limit("download")(handler)
+
+	send := func(remoteAddr string, apiKey *services.APIKey) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/download", nil)
+		req.RemoteAddr = remoteAddr
+		if apiKey != nil {
+			req = req.WithContext(services.WithAPIKey(req.Context(), apiKey))
+		}
+		w := httptest.NewRecorder()
+		route.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("10.0.0.1:1234", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:5678", nil).Code)
+	w = send("10.0.0.1:1234", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Contains(t, w.Body.String(), "rate_limited")
+
+	// Other IPs and API keys have their own limits
+	assert.Equal(t, http.StatusOK, send("10.0.0.2:1234", nil).Code)
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1234", &services.APIKey{ID: "abc"}).Code)
+	assert.Contains(t, limiter.counts, "download|key:abc")
+
+	// Routes without a limit aren't counted
+	w = httptest.NewRecorder()
+	rateLimit.Limit("info")(handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/info", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+
+	// Requests pass when the limiter fails
+	limiter.err = errors.New("redis down")
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1234", nil).Code)
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		headers    map[string]string
+		want       string
+	}{
+		{name: "Remote address", want: "192.0.2.1"},
+		{name: "Untrusted forwarded header", headers: map[string]string{"X-Forwarded-For": "203.0.113.5"}, want: "192.0.2.1"},
+		{name: "Forwarded header", trustProxy: true, headers: map[string]string{"X-Forwarded-For": "203.0.113.5, 10.0.0.1"}, want: "203.0.113.5"},
+		{name: "Real IP header", trustProxy: true, headers: map[string]string{"X-Real-IP": "203.0.113.6"}, want: "203.0.113.6"},
+		{name: "Proxy without headers", trustProxy: true, want: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
+			req.RemoteAddr = "192.0.2.1:4321"
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			assert.Equal(t, tt.want, clientIP(req, tt.trustProxy))
+		})
+	}
+}
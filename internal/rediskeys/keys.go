@@ -23,3 +23,136 @@ func GetFilePathFromKey(key string) string {
 func GetMetadataKey(filePath string) string {
 	return fmt.Sprintf("video:metadata:%s", filePath)
 }
+
+// GetVideoInfoKey returns the Redis key caching the info of a video
+func GetVideoInfoKey(videoID string) string {
+	return fmt.Sprintf("video:info:%s", videoID)
+}
+
+// GetDownloadLockKey returns the Redis key of the lock held by the worker downloading a video hash
+func GetDownloadLockKey(urlHash string) string {
+	return fmt.Sprintf("video:lock:%s", urlHash)
+}
+
+// GetTaskEventsChannel returns the Redis pub/sub channel a task's status updates are published on
+func GetTaskEventsChannel(taskID string) string {
+	return fmt.Sprintf("task:events:%s", taskID)
+}
+
+// GetTaskIDFromEventsChannel extracts the task ID from a task events channel name
+func GetTaskIDFromEventsChannel(channel string) string {
+	return strings.TrimPrefix(channel, "task:events:")
+}
+
+// GetTaskFinalStateKey returns the Redis key holding the final state of a task that
+// could not write its own result (cancelled or timed out)
+func GetTaskFinalStateKey(taskID string) string {
+	return fmt.Sprintf("task:final:%s", taskID)
+}
+
+// GetInFlightTaskKey returns the Redis key holding the ID of the task currently downloading a video
+// hash, along with when it claimed the video
+func GetInFlightTaskKey(urlHash string) string {
+	return fmt.Sprintf("task:inflight:%s", urlHash)
+}
+
+// GetTaskCallersKey returns the Redis key of the hash counting how many times each API key
+// requested a task, by submitting it or attaching to it
+func GetTaskCallersKey(taskID string) string {
+	return fmt.Sprintf("task:callers:%s", taskID)
+}
+
+// GetSubscriptionsKey returns the Redis key of the set holding every subscription ID
+func GetSubscriptionsKey() string {
+	return "subscriptions"
+}
+
+// GetSubscriptionKey returns the Redis key holding a subscription's definition
+func GetSubscriptionKey(subscriptionID string) string {
+	return fmt.Sprintf("subscription:%s", subscriptionID)
+}
+
+// GetSubscriptionSyncKey returns the Redis key holding the result of a subscription's last sync
+func GetSubscriptionSyncKey(subscriptionID string) string {
+	return fmt.Sprintf("subscription:sync:%s", subscriptionID)
+}
+
+// GetSubscriptionArchiveKey returns the Redis key of the set of video IDs a subscription already downloaded
+func GetSubscriptionArchiveKey(subscriptionID string) string {
+	return fmt.Sprintf("subscription:archive:%s", subscriptionID)
+}
+
+// GetMediaIndexKey returns the Redis key of the set of video hashes with a finished download
+func GetMediaIndexKey() string {
+	return "media:index"
+}
+
+// GetMediaEntryKey returns the Redis key holding the index entry of a downloaded video hash
+func GetMediaEntryKey(urlHash string) string {
+	return fmt.Sprintf("media:entry:%s", urlHash)
+}
+
+// GetFileLeasesKey returns the Redis key of the sorted set of leases holding the files of a
+// video hash while they are served or downloaded
+func GetFileLeasesKey(urlHash string) string {
+	return fmt.Sprintf("video:leases:%s", urlHash)
+}
+
+// GetTransferKey returns the Redis key holding how much of an ephemeral task's file its client
+// has received
+func GetTransferKey(taskID string) string {
+	return fmt.Sprintf("task:transfer:%s", taskID)
+}
+
+// GetShareKey returns the Redis key holding the definition of a share link
+func GetShareKey(token string) string {
+	return fmt.Sprintf("share:%s", token)
+}
+
+// GetShareDownloadsKey returns the Redis key counting the downloads of a share link
+func GetShareDownloadsKey(token string) string {
+	return fmt.Sprintf("share:downloads:%s", token)
+}
+
+// GetTaskSharesKey returns the Redis key of the set of share link tokens of a task
+func GetTaskSharesKey(taskID string) string {
+	return fmt.Sprintf("task:shares:%s", taskID)
+}
+
+// GetAPIKeysKey returns the Redis key of the set holding every API key ID
+func GetAPIKeysKey() string {
+	return "apikeys"
+}
+
+// GetAPIKeyKey returns the Redis key holding an API key's definition
+func GetAPIKeyKey(id string) string {
+	return fmt.Sprintf("apikey:%s", id)
+}
+
+// GetAPIKeyUsageKey returns the Redis key of the hash counting an API key's usage on a UTC day
+func GetAPIKeyUsageKey(id string, day string) string {
+	return fmt.Sprintf("apikey:usage:%s:%s", id, day)
+}
+
+// GetRateLimitKey returns the Redis key holding a client's token bucket for a rate limited route group
+func GetRateLimitKey(route string, client string) string {
+	return fmt.Sprintf("ratelimit:%s:%s", route, client)
+}
+
+// GetOutboundDownloadsKey returns the Redis key of the sorted set of leases held by running
+// downloads on the outbound download slots
+func GetOutboundDownloadsKey() string {
+	return "outbound:downloads"
+}
+
+// GetOutboundPauseKey returns the Redis key that pauses downloads while it exists, after a site
+// rejected one for sending too many requests
+func GetOutboundPauseKey() string {
+	return "outbound:pause"
+}
+
+// GetOutboundBackoffKey returns the Redis key holding the last download pause, in milliseconds,
+// which the next one doubles
+func GetOutboundBackoffKey() string {
+	return "outbound:backoff"
+}
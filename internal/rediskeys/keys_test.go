@@ -127,3 +127,129 @@ func TestKeyRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestGetVideoInfoKey(t *testing.T) {
+	if key := GetVideoInfoKey("dQw4w9WgXcQ"); key != "video:info:dQw4w9WgXcQ" {
+		t.Errorf("GetVideoInfoKey(%q) = %q, want %q", "dQw4w9WgXcQ", key, "video:info:dQw4w9WgXcQ")
+	}
+}
+
+func TestGetDownloadLockKey(t *testing.T) {
+	if key := GetDownloadLockKey("abc123"); key != "video:lock:abc123" {
+		t.Errorf("GetDownloadLockKey(%q) = %q, want %q", "abc123", key, "video:lock:abc123")
+	}
+}
+
+func TestTaskEventsChannelRoundTrip(t *testing.T) {
+	channel := GetTaskEventsChannel("task-123")
+	if channel != "task:events:task-123" {
+		t.Errorf("GetTaskEventsChannel(%q) = %q, want %q", "task-123", channel, "task:events:task-123")
+	}
+
+	if taskID := GetTaskIDFromEventsChannel(channel); taskID != "task-123" {
+		t.Errorf("GetTaskIDFromEventsChannel(%q) = %q, want %q", channel, taskID, "task-123")
+	}
+}
+
+func TestGetTaskFinalStateKey(t *testing.T) {
+	if key := GetTaskFinalStateKey("task-123"); key != "task:final:task-123" {
+		t.Errorf("GetTaskFinalStateKey(%q) = %q, want %q", "task-123", key, "task:final:task-123")
+	}
+}
+
+func TestGetInFlightTaskKey(t *testing.T) {
+	if key := GetInFlightTaskKey("abc123"); key != "task:inflight:abc123" {
+		t.Errorf("GetInFlightTaskKey(%q) = %q, want %q", "abc123", key, "task:inflight:abc123")
+	}
+}
+
+func TestGetTaskCallersKey(t *testing.T) {
+	if key := GetTaskCallersKey("abc123"); key != "task:callers:abc123" {
+		t.Errorf("GetTaskCallersKey(%q) = %q, want %q", "abc123", key, "task:callers:abc123")
+	}
+}
+
+func TestSubscriptionKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "subscriptions", got: GetSubscriptionsKey(), want: "subscriptions"},
+		{name: "subscription", got: GetSubscriptionKey("abc"), want: "subscription:abc"},
+		{name: "sync", got: GetSubscriptionSyncKey("abc"), want: "subscription:sync:abc"},
+		{name: "archive", got: GetSubscriptionArchiveKey("abc"), want: "subscription:archive:abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaIndexKeys(t *testing.T) {
+	if got := GetMediaIndexKey(); got != "media:index" {
+		t.Errorf("GetMediaIndexKey() = %q, want %q", got, "media:index")
+	}
+	if got := GetMediaEntryKey("0123456789abcdef"); got != "media:entry:0123456789abcdef" {
+		t.Errorf("GetMediaEntryKey() = %q, want %q", got, "media:entry:0123456789abcdef")
+	}
+}
+
+func TestGetFileLeasesKey(t *testing.T) {
+	if got := GetFileLeasesKey("0123456789abcdef"); got != "video:leases:0123456789abcdef" {
+		t.Errorf("GetFileLeasesKey() = %q, want %q", got, "video:leases:0123456789abcdef")
+	}
+}
+
+func TestGetTransferKey(t *testing.T) {
+	if got := GetTransferKey("abc"); got != "task:transfer:abc" {
+		t.Errorf("GetTransferKey() = %q, want %q", got, "task:transfer:abc")
+	}
+}
+
+func TestShareKeys(t *testing.T) {
+	if got := GetShareKey("tok"); got != "share:tok" {
+		t.Errorf("GetShareKey() = %q, want %q", got, "share:tok")
+	}
+	if got := GetShareDownloadsKey("tok"); got != "share:downloads:tok" {
+		t.Errorf("GetShareDownloadsKey() = %q, want %q", got, "share:downloads:tok")
+	}
+	if got := GetTaskSharesKey("abc"); got != "task:shares:abc" {
+		t.Errorf("GetTaskSharesKey() = %q, want %q", got, "task:shares:abc")
+	}
+}
+
+func TestAPIKeyKeys(t *testing.T) {
+	if got := GetAPIKeysKey(); got != "apikeys" {
+		t.Errorf("GetAPIKeysKey() = %q, want %q", got, "apikeys")
+	}
+	if got := GetAPIKeyKey("abc"); got != "apikey:abc" {
+		t.Errorf("GetAPIKeyKey() = %q, want %q", got, "apikey:abc")
+	}
+	if got := GetAPIKeyUsageKey("abc", "2024-05-31"); got != "apikey:usage:abc:2024-05-31" {
+		t.Errorf("GetAPIKeyUsageKey() = %q, want %q", got, "apikey:usage:abc:2024-05-31")
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	if got := GetRateLimitKey("download", "ip:10.0.0.1"); got != "ratelimit:download:ip:10.0.0.1" {
+		t.Errorf("GetRateLimitKey() = %q, want %q", got, "ratelimit:download:ip:10.0.0.1")
+	}
+}
+
+func TestOutboundKeys(t *testing.T) {
+	tests := map[string]string{
+		GetOutboundDownloadsKey(): "outbound:downloads",
+		GetOutboundPauseKey():     "outbound:pause",
+		GetOutboundBackoffKey():   "outbound:backoff",
+	}
+	for got, want := range tests {
+		if got != want {
+			t.Errorf("got key %q, want %q", got, want)
+		}
+	}
+}
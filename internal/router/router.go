@@ -2,24 +2,30 @@ package router
 
 import (
 	"net/http"
+	"spiropoulos94/youtube-downloader/internal/config"
 	"spiropoulos94/youtube-downloader/internal/handlers"
+	"spiropoulos94/youtube-downloader/internal/middleware"
 	"spiropoulos94/youtube-downloader/internal/workers"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/hibiken/asynqmon"
 )
 
 type Router struct {
+	config        *config.Config
 	router        *chi.Mux
 	handlers      *handlers.Handlers
+	middlewares   *middleware.Middlewares
 	workerManager *workers.Manager
 }
 
-func BuildRouter(handlers *handlers.Handlers, workerManager *workers.Manager) *Router {
+func BuildRouter(config *config.Config, handlers *handlers.Handlers, middlewares *middleware.Middlewares, workerManager *workers.Manager) *Router {
 	r := &Router{
+		config:        config,
 		router:        chi.NewRouter(),
 		handlers:      handlers,
+		middlewares:   middlewares,
 		workerManager: workerManager,
 	}
 	r.setupRoutes()
@@ -28,33 +34,97 @@ func BuildRouter(handlers *handlers.Handlers, workerManager *workers.Manager) *R
 
 func (r *Router) setupRoutes() {
 	// Middleware
-	r.router.Use(middleware.Logger)
-	r.router.Use(middleware.Recoverer)
+	r.router.Use(middleware.RedactAccessToken)
+	r.router.Use(chimiddleware.Logger)
+	r.router.Use(chimiddleware.Recoverer)
 
 	// Routes
 	r.router.Route("/api", func(router chi.Router) {
-		// Download endpoint
-		router.Post("/download", r.handlers.YouTube.DownloadVideo)
-
-		// Task status endpoint
-		router.Get("/tasks/{task_id}", r.handlers.YouTube.GetTaskStatus)
-
-		// Video download endpoint
-		router.Get("/videos/{task_id}", r.handlers.YouTube.ServeVideo)
-
 		// Health check endpoint
 		router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("OK"))
 		})
-	})
 
-	// Asynqmon dashboard
-	asynqmonHandler := asynqmon.New(asynqmon.Options{
-		RedisConnOpt: r.workerManager.GetRedisOpt(),
-		RootPath:     "/monitoring", // RootPath specifies the root for asynqmon app
+		// Share links are opened by anyone they are given to
+		router.With(r.middlewares.RateLimit.Limit("shares")).Get("/shares/{token}", r.handlers.YouTube.ServeShare)
+
+		// Task status Server-Sent Events endpoints (single task and ?ids=a,b,c). EventSource can't
+		// send headers, so they also take the API key in the access_token query parameter
+		router.Group(func(router chi.Router) {
+			router.Use(r.middlewares.Auth.RequireStreamAPIKey)
+			limit := r.middlewares.RateLimit.Limit
+			router.With(limit("tasks")).Get("/tasks/{task_id}/events", r.handlers.YouTube.StreamTaskEvents)
+			router.With(limit("tasks")).Get("/tasks/events", r.handlers.YouTube.StreamMultiTaskEvents)
+		})
+
+		// Every other endpoint requires an API key when authentication is enabled
+		router.Group(func(router chi.Router) {
+			router.Use(r.middlewares.Auth.RequireAPIKey)
+
+			// Rate limits are applied per route group, after authentication so API keys are counted
+			// separately from their IPs
+			limit := r.middlewares.RateLimit.Limit
+
+			// Download endpoint
+			router.With(limit("download")).Post("/download", r.handlers.YouTube.DownloadVideo)
+
+			// Video info preview endpoint
+			router.With(limit("info")).Get("/info", r.handlers.YouTube.GetVideoInfo)
+
+			// Task status endpoint
+			router.With(limit("tasks")).Get("/tasks/{task_id}", r.handlers.YouTube.GetTaskStatus)
+
+			// Task cancellation endpoint
+			router.With(limit("tasks")).Delete("/tasks/{task_id}", r.handlers.YouTube.CancelTask)
+
+			// Playlist status and ZIP archive endpoints
+			router.With(limit("tasks")).Get("/playlists/{task_id}", r.handlers.YouTube.GetPlaylistStatus)
+			router.With(limit("videos")).Get("/playlists/{task_id}/zip", r.handlers.YouTube.DownloadPlaylistZip)
+
+			// Channel and playlist subscription endpoints
+			router.Route("/subscriptions", func(router chi.Router) {
+				router.Use(limit("subscriptions"))
+				router.Post("/", r.handlers.Subscription.CreateSubscription)
+				router.Get("/", r.handlers.Subscription.ListSubscriptions)
+				router.Get("/{subscription_id}", r.handlers.Subscription.GetSubscription)
+				router.Put("/{subscription_id}", r.handlers.Subscription.UpdateSubscription)
+				router.Delete("/{subscription_id}", r.handlers.Subscription.DeleteSubscription)
+				router.Post("/{subscription_id}/sync", r.handlers.Subscription.SyncSubscription)
+			})
+
+			// Video download endpoint
+			router.With(limit("videos")).Get("/videos/{task_id}", r.handlers.YouTube.ServeVideo)
+
+			// Share link management
+			router.With(limit("shares")).Post("/tasks/{task_id}/shares", r.handlers.YouTube.CreateShare)
+			router.With(limit("shares")).Get("/tasks/{task_id}/shares", r.handlers.YouTube.ListShares)
+			router.With(limit("shares")).Delete("/tasks/{task_id}/shares/{token}", r.handlers.YouTube.RevokeShare)
+
+			// Admin endpoints managing stored videos: cleanup runs, listing, pinning and purging
+			router.Route("/admin", func(router chi.Router) {
+				router.Use(r.middlewares.Auth.RequireAdmin)
+				router.Use(limit("admin"))
+				router.Post("/cleanup", r.handlers.Admin.RunCleanup)
+				router.Get("/videos", r.handlers.Admin.ListVideos)
+				router.Put("/videos/{url_hash}/pin", r.handlers.Admin.PinVideo)
+				router.Delete("/videos/{url_hash}/pin", r.handlers.Admin.PinVideo)
+				router.Delete("/videos/{url_hash}", r.handlers.Admin.PurgeVideo)
+			})
+		})
 	})
-	r.router.Mount("/monitoring", asynqmonHandler)
+
+	// Asynqmon dashboard, unless turned off
+	if r.config.Monitoring == config.MonitoringOff {
+		r.router.Mount("/monitoring", http.NotFoundHandler())
+	} else {
+		asynqmonHandler := asynqmon.New(asynqmon.Options{
+			RedisConnOpt: r.workerManager.GetRedisOpt(),
+			RootPath:     "/monitoring", // RootPath specifies the root for asynqmon app
+			ReadOnly:     r.config.Monitoring == config.MonitoringReadOnly,
+		})
+		r.router.Mount("/monitoring", r.middlewares.Monitoring.Protect(asynqmonHandler))
+	}
 
 	// Frontend handler for React app
 	r.router.Get("/*", r.handlers.Frontend.ServeFrontend)
@@ -22,6 +22,12 @@ func (m *MockYouTubeHandler) DownloadVideo(w http.ResponseWriter, r *http.Reques
 	w.Write([]byte(`{"success":true}`))
 }
 
+func (m *MockYouTubeHandler) GetVideoInfo(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"success":true}`))
+}
+
 func (m *MockYouTubeHandler) GetTaskStatus(w http.ResponseWriter, r *http.Request) {
 	m.Called(w, r)
 	w.WriteHeader(http.StatusOK)
@@ -34,6 +40,114 @@ func (m *MockYouTubeHandler) ServeVideo(w http.ResponseWriter, r *http.Request)
 	w.Write([]byte("mock video data"))
 }
 
+func (m *MockYouTubeHandler) CancelTask(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"success":true,"status":"cancelled"}`))
+}
+
+func (m *MockYouTubeHandler) StreamTaskEvents(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *MockYouTubeHandler) StreamMultiTaskEvents(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *MockYouTubeHandler) GetPlaylistStatus(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"success":true,"status":"processing"}`))
+}
+
+func (m *MockYouTubeHandler) DownloadPlaylistZip(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.Header().Set("Content-Type", "application/zip")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *MockYouTubeHandler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (m *MockYouTubeHandler) ListShares(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *MockYouTubeHandler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *MockYouTubeHandler) ServeShare(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusOK)
+}
+
+type MockSubscriptionHandler struct {
+	mock.Mock
+}
+
+func (m *MockSubscriptionHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (m *MockSubscriptionHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *MockSubscriptionHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *MockSubscriptionHandler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *MockSubscriptionHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *MockSubscriptionHandler) SyncSubscription(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type MockAdminHandler struct {
+	mock.Mock
+}
+
+func (m *MockAdminHandler) RunCleanup(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *MockAdminHandler) ListVideos(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *MockAdminHandler) PinVideo(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *MockAdminHandler) PurgeVideo(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+	w.WriteHeader(http.StatusOK)
+}
+
 type MockFrontendHandler struct {
 	mock.Mock
 }
@@ -73,12 +187,16 @@ func TestRouterServeHTTP(t *testing.T) {
 func TestRouterAPIEndpoints(t *testing.T) {
 	// Create mock handlers
 	mockYouTubeHandler := new(MockYouTubeHandler)
+	mockSubscriptionHandler := new(MockSubscriptionHandler)
+	mockAdminHandler := new(MockAdminHandler)
 	mockFrontendHandler := new(MockFrontendHandler)
 
 	// Create handlers struct with mocks
 	handlers := &handlers.Handlers{
-		YouTube:  mockYouTubeHandler,
-		Frontend: mockFrontendHandler,
+		YouTube:      mockYouTubeHandler,
+		Subscription: mockSubscriptionHandler,
+		Admin:        mockAdminHandler,
+		Frontend:     mockFrontendHandler,
 	}
 
 	// Create a router manually with just the mock handlers
@@ -97,8 +215,33 @@ func TestRouterAPIEndpoints(t *testing.T) {
 	// Setup API routes
 	router.router.Route("/api", func(r chi.Router) {
 		r.Post("/download", mockYouTubeHandler.DownloadVideo)
+		r.Get("/info", mockYouTubeHandler.GetVideoInfo)
 		r.Get("/tasks/{task_id}", mockYouTubeHandler.GetTaskStatus)
+		r.Delete("/tasks/{task_id}", mockYouTubeHandler.CancelTask)
+		r.Get("/tasks/{task_id}/events", mockYouTubeHandler.StreamTaskEvents)
+		r.Get("/tasks/events", mockYouTubeHandler.StreamMultiTaskEvents)
+		r.Get("/playlists/{task_id}", mockYouTubeHandler.GetPlaylistStatus)
+		r.Get("/playlists/{task_id}/zip", mockYouTubeHandler.DownloadPlaylistZip)
+		r.Route("/subscriptions", func(r chi.Router) {
+			r.Post("/", mockSubscriptionHandler.CreateSubscription)
+			r.Get("/", mockSubscriptionHandler.ListSubscriptions)
+			r.Get("/{subscription_id}", mockSubscriptionHandler.GetSubscription)
+			r.Put("/{subscription_id}", mockSubscriptionHandler.UpdateSubscription)
+			r.Delete("/{subscription_id}", mockSubscriptionHandler.DeleteSubscription)
+			r.Post("/{subscription_id}/sync", mockSubscriptionHandler.SyncSubscription)
+		})
 		r.Get("/videos/{task_id}", mockYouTubeHandler.ServeVideo)
+		r.Post("/tasks/{task_id}/shares", mockYouTubeHandler.CreateShare)
+		r.Get("/tasks/{task_id}/shares", mockYouTubeHandler.ListShares)
+		r.Delete("/tasks/{task_id}/shares/{token}", mockYouTubeHandler.RevokeShare)
+		r.Get("/shares/{token}", mockYouTubeHandler.ServeShare)
+		r.Route("/admin", func(r chi.Router) {
+			r.Post("/cleanup", mockAdminHandler.RunCleanup)
+			r.Get("/videos", mockAdminHandler.ListVideos)
+			r.Put("/videos/{url_hash}/pin", mockAdminHandler.PinVideo)
+			r.Delete("/videos/{url_hash}/pin", mockAdminHandler.PinVideo)
+			r.Delete("/videos/{url_hash}", mockAdminHandler.PurgeVideo)
+		})
 		r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("OK"))
@@ -123,6 +266,14 @@ func TestRouterAPIEndpoints(t *testing.T) {
 	assert.Equal(t, http.StatusAccepted, w.Code)
 	mockYouTubeHandler.AssertCalled(t, "DownloadVideo", w, mock.Anything)
 
+	// Test video info endpoint
+	mockYouTubeHandler.On("GetVideoInfo", mock.Anything, mock.Anything).Return()
+	req = httptest.NewRequest("GET", "/api/info?url=https://www.youtube.com/watch?v=dQw4w9WgXcQ", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockYouTubeHandler.AssertCalled(t, "GetVideoInfo", w, mock.Anything)
+
 	// Test task status endpoint
 	mockYouTubeHandler.On("GetTaskStatus", mock.Anything, mock.Anything).Return()
 	req = httptest.NewRequest("GET", "/api/tasks/123", nil)
@@ -131,6 +282,69 @@ func TestRouterAPIEndpoints(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	mockYouTubeHandler.AssertCalled(t, "GetTaskStatus", w, mock.Anything)
 
+	// Test task cancellation endpoint
+	mockYouTubeHandler.On("CancelTask", mock.Anything, mock.Anything).Return()
+	req = httptest.NewRequest("DELETE", "/api/tasks/123", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockYouTubeHandler.AssertCalled(t, "CancelTask", w, mock.Anything)
+
+	// Test task events endpoint
+	mockYouTubeHandler.On("StreamTaskEvents", mock.Anything, mock.Anything).Return()
+	req = httptest.NewRequest("GET", "/api/tasks/123/events", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	mockYouTubeHandler.AssertCalled(t, "StreamTaskEvents", w, mock.Anything)
+
+	// Test multi-task events endpoint (must not be routed to the task status endpoint)
+	mockYouTubeHandler.On("StreamMultiTaskEvents", mock.Anything, mock.Anything).Return()
+	req = httptest.NewRequest("GET", "/api/tasks/events?ids=1,2", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	mockYouTubeHandler.AssertCalled(t, "StreamMultiTaskEvents", w, mock.Anything)
+
+	// Test playlist status endpoint
+	mockYouTubeHandler.On("GetPlaylistStatus", mock.Anything, mock.Anything).Return()
+	req = httptest.NewRequest("GET", "/api/playlists/123", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockYouTubeHandler.AssertCalled(t, "GetPlaylistStatus", w, mock.Anything)
+
+	// Test playlist archive endpoint
+	mockYouTubeHandler.On("DownloadPlaylistZip", mock.Anything, mock.Anything).Return()
+	req = httptest.NewRequest("GET", "/api/playlists/123/zip", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	mockYouTubeHandler.AssertCalled(t, "DownloadPlaylistZip", w, mock.Anything)
+
+	// Test subscription endpoints
+	subscriptionTests := []struct {
+		method     string
+		path       string
+		handler    string
+		wantStatus int
+	}{
+		{method: "POST", path: "/api/subscriptions", handler: "CreateSubscription", wantStatus: http.StatusCreated},
+		{method: "GET", path: "/api/subscriptions", handler: "ListSubscriptions", wantStatus: http.StatusOK},
+		{method: "GET", path: "/api/subscriptions/abc", handler: "GetSubscription", wantStatus: http.StatusOK},
+		{method: "PUT", path: "/api/subscriptions/abc", handler: "UpdateSubscription", wantStatus: http.StatusOK},
+		{method: "DELETE", path: "/api/subscriptions/abc", handler: "DeleteSubscription", wantStatus: http.StatusNoContent},
+		{method: "POST", path: "/api/subscriptions/abc/sync", handler: "SyncSubscription", wantStatus: http.StatusAccepted},
+	}
+	for _, tt := range subscriptionTests {
+		mockSubscriptionHandler.On(tt.handler, mock.Anything, mock.Anything).Return()
+		req = httptest.NewRequest(tt.method, tt.path, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tt.wantStatus, w.Code, "%s %s", tt.method, tt.path)
+		mockSubscriptionHandler.AssertCalled(t, tt.handler, w, mock.Anything)
+	}
+
 	// Test video endpoint
 	mockYouTubeHandler.On("ServeVideo", mock.Anything, mock.Anything).Return()
 	req = httptest.NewRequest("GET", "/api/videos/123", nil)
@@ -139,6 +353,48 @@ func TestRouterAPIEndpoints(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	mockYouTubeHandler.AssertCalled(t, "ServeVideo", w, mock.Anything)
 
+	// Test share link endpoints
+	shareTests := []struct {
+		method     string
+		path       string
+		handler    string
+		wantStatus int
+	}{
+		{method: "POST", path: "/api/tasks/123/shares", handler: "CreateShare", wantStatus: http.StatusCreated},
+		{method: "GET", path: "/api/tasks/123/shares", handler: "ListShares", wantStatus: http.StatusOK},
+		{method: "DELETE", path: "/api/tasks/123/shares/abc", handler: "RevokeShare", wantStatus: http.StatusNoContent},
+		{method: "GET", path: "/api/shares/abc", handler: "ServeShare", wantStatus: http.StatusOK},
+	}
+	for _, tt := range shareTests {
+		mockYouTubeHandler.On(tt.handler, mock.Anything, mock.Anything).Return()
+		req = httptest.NewRequest(tt.method, tt.path, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tt.wantStatus, w.Code, "%s %s", tt.method, tt.path)
+		mockYouTubeHandler.AssertCalled(t, tt.handler, w, mock.Anything)
+	}
+
+	// Test admin endpoints
+	adminTests := []struct {
+		method  string
+		path    string
+		handler string
+	}{
+		{method: "POST", path: "/api/admin/cleanup?dry_run=true", handler: "RunCleanup"},
+		{method: "GET", path: "/api/admin/videos", handler: "ListVideos"},
+		{method: "PUT", path: "/api/admin/videos/0123456789abcdef/pin", handler: "PinVideo"},
+		{method: "DELETE", path: "/api/admin/videos/0123456789abcdef/pin", handler: "PinVideo"},
+		{method: "DELETE", path: "/api/admin/videos/0123456789abcdef", handler: "PurgeVideo"},
+	}
+	for _, tt := range adminTests {
+		mockAdminHandler.On(tt.handler, mock.Anything, mock.Anything).Return()
+		req = httptest.NewRequest(tt.method, tt.path, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, "%s %s", tt.method, tt.path)
+		mockAdminHandler.AssertCalled(t, tt.handler, w, mock.Anything)
+	}
+
 	// Test frontend endpoint
 	mockFrontendHandler.On("ServeFrontend", mock.Anything, mock.Anything).Return()
 	req = httptest.NewRequest("GET", "/", nil)
@@ -149,5 +405,7 @@ func TestRouterAPIEndpoints(t *testing.T) {
 
 	// Verify all expectations were met
 	mockYouTubeHandler.AssertExpectations(t)
+	mockSubscriptionHandler.AssertExpectations(t)
+	mockAdminHandler.AssertExpectations(t)
 	mockFrontendHandler.AssertExpectations(t)
 }
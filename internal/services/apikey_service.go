@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"spiropoulos94/youtube-downloader/internal/rediskeys"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrAPIKeyNotFound is returned when an API key ID doesn't exist
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrInvalidAPIKey is returned when a request's API key is malformed, unknown or revoked
+	ErrInvalidAPIKey = errors.New("invalid API key")
+)
+
+// usageRetention is how long the usage of a day is kept, long enough to still be read on the next day
+const usageRetention = 48 * time.Hour
+
+// APIKey identifies a client of the API. The key itself is only shown once, when it is created:
+// it is made of the key's ID and a secret, of which only a hash is stored.
+type APIKey struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	SecretHash     string    `json:"secret_hash"` // Hex encoded SHA-256 of the secret
+	Admin          bool      `json:"admin,omitempty"`
+	DailyDownloads int       `json:"daily_downloads,omitempty"` // Download requests allowed per UTC day, 0 for unlimited
+	DailyBytes     int64     `json:"daily_bytes,omitempty"`     // Bytes of video served per UTC day, 0 for unlimited
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// APIKeyUsage is how much of its quotas an API key used on a UTC day
+type APIKeyUsage struct {
+	Day       string `json:"day"` // e.g. "2024-05-31"
+	Downloads int    `json:"downloads"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// QuotaExceededError is returned when an API key used up one of its daily quotas
+type QuotaExceededError struct {
+	Quota   string // "downloads" or "bytes"
+	Limit   int64
+	ResetAt time.Time // Start of the next UTC day
+}
+
+func (e *QuotaExceededError) Error() string {
+	if e.Quota == "bytes" {
+		return fmt.Sprintf("daily quota of %s served exceeded, it resets at %s", formatSize(e.Limit), e.ResetAt.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("daily quota of %d downloads exceeded, it resets at %s", e.Limit, e.ResetAt.Format(time.RFC3339))
+}
+
+// claimDownloadQuotaScript counts a download request of an API key unless one of its daily quotas
+// is used up. It returns 0 if the download is allowed, 1 if the download quota is used up and 2
+// if the byte quota is.
+var claimDownloadQuotaScript = redis.NewScript(`
+local maxDownloads = tonumber(ARGV[1])
+local maxBytes = tonumber(ARGV[2])
+if maxBytes > 0 and tonumber(redis.call("HGET", KEYS[1], "bytes") or "0") >= maxBytes then
+	return 2
+end
+if maxDownloads > 0 and tonumber(redis.call("HGET", KEYS[1], "downloads") or "0") >= maxDownloads then
+	return 1
+end
+redis.call("HINCRBY", KEYS[1], "downloads", 1)
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return 0
+`)
+
+// APIKeyService implements APIKeyServiceInterface
+type APIKeyService struct {
+	redis *redis.Client
+}
+
+// NewAPIKeyService creates a new APIKeyService instance
+func NewAPIKeyService(redis *redis.Client) APIKeyServiceInterface {
+	return &APIKeyService{
+		redis: redis,
+	}
+}
+
+// CreateAPIKey stores a new API key, assigning its ID and creation time, and returns the key
+// clients authenticate with
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, apiKey *APIKey) (string, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate API key ID: %v", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate API key secret: %v", err)
+	}
+	apiKey.ID = hex.EncodeToString(id)
+	apiKey.CreatedAt = time.Now().UTC()
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	apiKey.SecretHash = hashSecret(encodedSecret)
+
+	data, err := json.Marshal(apiKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal API key: %v", err)
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, rediskeys.GetAPIKeyKey(apiKey.ID), data, 0)
+	pipe.SAdd(ctx, rediskeys.GetAPIKeysKey(), apiKey.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("failed to create API key: %v", err)
+	}
+	return apiKey.ID + "." + encodedSecret, nil
+}
+
+// GetAPIKey returns an API key, or ErrAPIKeyNotFound
+func (s *APIKeyService) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	data, err := s.redis.Get(ctx, rediskeys.GetAPIKeyKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %v", err)
+	}
+
+	var apiKey APIKey
+	if err := json.Unmarshal(data, &apiKey); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal API key: %v", err)
+	}
+	return &apiKey, nil
+}
+
+// ListAPIKeys returns every API key
+func (s *APIKeyService) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	ids, err := s.redis.SMembers(ctx, rediskeys.GetAPIKeysKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+
+	apiKeys := make([]*APIKey, 0, len(ids))
+	for _, id := range ids {
+		apiKey, err := s.GetAPIKey(ctx, id)
+		if err == ErrAPIKeyNotFound {
+			continue // Revoked while listing
+		}
+		if err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	return apiKeys, nil
+}
+
+// RevokeAPIKey deletes an API key, its requests are rejected right away
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, id string) error {
+	pipe := s.redis.TxPipeline()
+	removed := pipe.SRem(ctx, rediskeys.GetAPIKeysKey(), id)
+	pipe.Del(ctx, rediskeys.GetAPIKeyKey(id))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke API key: %v", err)
+	}
+	if removed.Val() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the API key a client authenticates with, or ErrInvalidAPIKey
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (*APIKey, error) {
+	id, secret, ok := strings.Cut(key, ".")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.GetAPIKey(ctx, id)
+	if err == ErrAPIKeyNotFound {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(apiKey.SecretHash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	return apiKey, nil
+}
+
+// GetUsage returns how much of its quotas an API key used today
+func (s *APIKeyService) GetUsage(ctx context.Context, id string) (*APIKeyUsage, error) {
+	day := usageDay(time.Now())
+	values, err := s.redis.HMGet(ctx, rediskeys.GetAPIKeyUsageKey(id, day), "downloads", "bytes").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key usage: %v", err)
+	}
+
+	usage := &APIKeyUsage{Day: day}
+	if value, ok := values[0].(string); ok {
+		fmt.Sscan(value, &usage.Downloads)
+	}
+	if value, ok := values[1].(string); ok {
+		fmt.Sscan(value, &usage.Bytes)
+	}
+	return usage, nil
+}
+
+// ClaimDownload counts a download request of an API key, or returns a *QuotaExceededError
+// without counting it once one of the key's daily quotas is used up
+func (s *APIKeyService) ClaimDownload(ctx context.Context, apiKey *APIKey) error {
+	now := time.Now()
+	key := rediskeys.GetAPIKeyUsageKey(apiKey.ID, usageDay(now))
+	result, err := claimDownloadQuotaScript.Run(ctx, s.redis, []string{key}, apiKey.DailyDownloads, apiKey.DailyBytes, usageRetention.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to count download: %v", err)
+	}
+
+	switch result {
+	case 1:
+		return &QuotaExceededError{Quota: "downloads", Limit: int64(apiKey.DailyDownloads), ResetAt: nextUsageDay(now)}
+	case 2:
+		return &QuotaExceededError{Quota: "bytes", Limit: apiKey.DailyBytes, ResetAt: nextUsageDay(now)}
+	}
+	return nil
+}
+
+// RefundDownload takes back a download request counted by ClaimDownload, e.g. when it couldn't be enqueued
+func (s *APIKeyService) RefundDownload(ctx context.Context, id string) error {
+	if err := s.redis.HIncrBy(ctx, rediskeys.GetAPIKeyUsageKey(id, usageDay(time.Now())), "downloads", -1).Err(); err != nil {
+		return fmt.Errorf("failed to refund download: %v", err)
+	}
+	return nil
+}
+
+// CheckDownload returns a *QuotaExceededError if ClaimDownload would reject a download request of
+// an API key, without counting one
+func (s *APIKeyService) CheckDownload(ctx context.Context, apiKey *APIKey) error {
+	if apiKey.DailyDownloads <= 0 && apiKey.DailyBytes <= 0 {
+		return nil
+	}
+	usage, err := s.GetUsage(ctx, apiKey.ID)
+	if err != nil {
+		return err
+	}
+	if apiKey.DailyBytes > 0 && usage.Bytes >= apiKey.DailyBytes {
+		return &QuotaExceededError{Quota: "bytes", Limit: apiKey.DailyBytes, ResetAt: nextUsageDay(time.Now())}
+	}
+	if apiKey.DailyDownloads > 0 && usage.Downloads >= apiKey.DailyDownloads {
+		return &QuotaExceededError{Quota: "downloads", Limit: int64(apiKey.DailyDownloads), ResetAt: nextUsageDay(time.Now())}
+	}
+	return nil
+}
+
+// CheckBytes returns a *QuotaExceededError once an API key's daily byte quota is used up
+func (s *APIKeyService) CheckBytes(ctx context.Context, apiKey *APIKey) error {
+	if apiKey.DailyBytes <= 0 {
+		return nil
+	}
+	usage, err := s.GetUsage(ctx, apiKey.ID)
+	if err != nil {
+		return err
+	}
+	if usage.Bytes >= apiKey.DailyBytes {
+		return &QuotaExceededError{Quota: "bytes", Limit: apiKey.DailyBytes, ResetAt: nextUsageDay(time.Now())}
+	}
+	return nil
+}
+
+// RecordBytes adds bytes of video served to an API key's usage of the day
+func (s *APIKeyService) RecordBytes(ctx context.Context, id string, bytes int64) error {
+	key := rediskeys.GetAPIKeyUsageKey(id, usageDay(time.Now()))
+	pipe := s.redis.TxPipeline()
+	pipe.HIncrBy(ctx, key, "bytes", bytes)
+	pipe.Expire(ctx, key, usageRetention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record served bytes: %v", err)
+	}
+	return nil
+}
+
+// apiKeyContextKey is the context key of the API key a request was authenticated with
+type apiKeyContextKey struct{}
+
+// WithAPIKey returns a context carrying the API key a request was authenticated with
+func WithAPIKey(ctx context.Context, apiKey *APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, apiKey)
+}
+
+// APIKeyFromContext returns the API key a request was authenticated with, or nil if
+// authentication is disabled
+func APIKeyFromContext(ctx context.Context) *APIKey {
+	apiKey, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return apiKey
+}
+
+// hashSecret returns the hex encoded SHA-256 of an API key secret. Secrets are random, so they
+// don't need a slow password hash.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// usageDay returns the UTC day usage at a time is counted in
+func usageDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// nextUsageDay returns when the usage counted at a time resets
+func nextUsageDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
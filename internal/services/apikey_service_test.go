@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageDay(t *testing.T) {
+	athens := time.FixedZone("Athens", 3*60*60)
+	now := time.Date(2024, 6, 1, 1, 30, 0, 0, athens)
+
+	// Days are UTC days
+	assert.Equal(t, "2024-05-31", usageDay(now))
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), nextUsageDay(now))
+}
+
+func TestHashSecret(t *testing.T) {
+	assert.Equal(t, hashSecret("secret"), hashSecret("secret"))
+	assert.NotEqual(t, hashSecret("secret"), hashSecret("Secret"))
+	assert.Len(t, hashSecret("secret"), 64)
+}
+
+func TestQuotaExceededError(t *testing.T) {
+	resetAt := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	err := &QuotaExceededError{Quota: "downloads", Limit: 100, ResetAt: resetAt}
+	assert.Equal(t, "daily quota of 100 downloads exceeded, it resets at 2024-06-01T00:00:00Z", err.Error())
+
+	err = &QuotaExceededError{Quota: "bytes", Limit: 10 << 30, ResetAt: resetAt}
+	assert.Equal(t, "daily quota of 10.0 GB served exceeded, it resets at 2024-06-01T00:00:00Z", err.Error())
+}
+
+func TestAPIKeyContext(t *testing.T) {
+	assert.Nil(t, APIKeyFromContext(context.Background()))
+
+	apiKey := &APIKey{ID: "abc"}
+	assert.Equal(t, apiKey, APIKeyFromContext(WithAPIKey(context.Background(), apiKey)))
+}
@@ -2,12 +2,16 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"path/filepath"
 	"spiropoulos94/youtube-downloader/internal/config"
 	"spiropoulos94/youtube-downloader/internal/rediskeys"
+	"spiropoulos94/youtube-downloader/internal/storage"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -17,14 +21,47 @@ import (
 type CleanupService struct {
 	config   *config.Config
 	redis    *redis.Client
+	store    storage.StoreInterface
+	index    MediaIndexInterface
+	leases   FileLeasesInterface
+	mu       sync.Mutex // Keeps scheduled and admin triggered runs from deleting files concurrently
 	stopChan chan struct{}
 }
 
+// CleanupReport lists the files a cleanup run deleted, or would delete in a dry run
+type CleanupReport struct {
+	DryRun     bool          `json:"dry_run"`
+	Files      []CleanedFile `json:"files"`
+	FreedBytes int64         `json:"freed_bytes"`
+}
+
+// CleanedFile is a file deleted by a cleanup run and the reason it was deleted
+type CleanedFile struct {
+	FilePath string `json:"file_path"`
+	Size     int64  `json:"size"`
+	Reason   string `json:"reason"`
+}
+
+// newCleanupReport creates the report of a run deleting files
+func newCleanupReport(dryRun bool, files []CleanedFile) *CleanupReport {
+	report := &CleanupReport{DryRun: dryRun, Files: files}
+	if report.Files == nil {
+		report.Files = []CleanedFile{}
+	}
+	for _, file := range files {
+		report.FreedBytes += file.Size
+	}
+	return report
+}
+
 // NewCleanupService creates a new CleanupService instance
-func NewCleanupService(config *config.Config, redis *redis.Client) CleanupServiceInterface {
+func NewCleanupService(config *config.Config, redis *redis.Client, store storage.StoreInterface, index MediaIndexInterface, leases FileLeasesInterface) CleanupServiceInterface {
 	return &CleanupService{
 		config:   config,
 		redis:    redis,
+		store:    store,
+		index:    index,
+		leases:   leases,
 		stopChan: make(chan struct{}),
 	}
 }
@@ -41,28 +78,87 @@ func (s *CleanupService) Stop() {
 
 // runCleanupLoop runs the cleanup process periodically based on config
 func (s *CleanupService) runCleanupLoop() {
-	ticker := time.NewTicker(s.config.TaskRetention)
+	ticker := time.NewTicker(s.config.CleanupInterval)
 	defer ticker.Stop()
 
-	log.Printf("Starting cleanup service with interval: %s", s.config.TaskRetention)
+	log.Printf("Starting cleanup service with interval: %s, retention: %s", s.config.CleanupInterval, s.config.TaskRetention)
+
+	// Index files downloaded before the media index existed, or while Redis lost it. Only done on
+	// startup, since indexing a file reads all of it, which means downloading it from S3.
+	if err := s.rebuildIndex(context.Background()); err != nil {
+		log.Printf("Error rebuilding media index: %v", err)
+	}
+
+	// Storage usage is checked far more often than files expire, busy days fill the disk quickly
+	var quotaTicks <-chan time.Time
+	if s.config.MaxStorageSize > 0 {
+		quotaTicker := time.NewTicker(s.config.StorageCheck)
+		defer quotaTicker.Stop()
+		quotaTicks = quotaTicker.C
+		log.Printf("Evicting videos once they take more than %s, checked every %s", formatSize(s.config.MaxStorageSize), s.config.StorageCheck)
+	}
 
 	for {
 		select {
 		case <-s.stopChan:
 			return
 		case <-ticker.C:
-			if err := s.cleanup(); err != nil {
+			if _, err := s.RunCleanup(context.Background(), false); err != nil {
 				log.Printf("Error during cleanup: %v", err)
 			}
+		case <-quotaTicks:
+			if err := s.enforceQuota(context.Background()); err != nil {
+				log.Printf("Error enforcing storage limit: %v", err)
+			}
 		}
 	}
 }
 
-// cleanup performs the actual cleanup of files
-func (s *CleanupService) cleanup() error {
-	ctx := context.Background()
+// RunCleanup deletes the videos that haven't been requested within the retention period, then
+// evicts videos while storage is over its limit. A dry run only reports what would be deleted.
+func (s *CleanupService) RunCleanup(ctx context.Context, dryRun bool) (*CleanupReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !dryRun {
+		s.deleteOrphanedKeys(ctx)
+	}
+
+	objects, err := s.listMediaFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files := s.expiredFiles(ctx, objects)
+	evictions, err := s.quotaEvictions(ctx, objects, files)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, evictions...)
+
+	if dryRun {
+		return newCleanupReport(true, files), nil
+	}
+	return newCleanupReport(false, s.deleteFiles(ctx, files)), nil
+}
+
+// ErrFileHeld is returned when purging a file that is being served or downloaded
+var ErrFileHeld = errors.New("file is being served or downloaded")
+
+// PurgeFile deletes a stored video along with its Redis keys, pinned or not. Files that are being
+// served or downloaded are not deleted.
+func (s *CleanupService) PurgeFile(ctx context.Context, filePath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// First, check for orphaned Redis keys (keys without corresponding files)
+	if err := purgeUnheldFile(ctx, s.store, s.redis, s.index, s.leases, filePath); err != nil {
+		return err
+	}
+	log.Printf("Deleted file and associated data: %s (purged by an admin)", filePath)
+	return nil
+}
+
+// deleteOrphanedKeys deletes the last request keys of files that no longer exist
+func (s *CleanupService) deleteOrphanedKeys(ctx context.Context) {
 	pattern := rediskeys.GetLastRequestKey("*")
 	iter := s.redis.Scan(ctx, 0, pattern, 0).Iterator()
 
@@ -74,7 +170,7 @@ func (s *CleanupService) cleanup() error {
 		}
 
 		// Check if file exists
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		if _, err := s.store.Stat(ctx, storage.Key(filePath)); errors.Is(err, storage.ErrNotFound) {
 			// File doesn't exist, delete the Redis key
 			if err := s.redis.Del(ctx, key).Err(); err != nil {
 				log.Printf("Error deleting orphaned Redis key %s: %v", key, err)
@@ -87,77 +183,234 @@ func (s *CleanupService) cleanup() error {
 	if err := iter.Err(); err != nil {
 		log.Printf("Error scanning Redis keys: %v", err)
 	}
+}
 
-	// Then check for files without Redis keys
-	files, err := os.ReadDir(s.config.OutputDir)
+// listMediaFiles lists the stored downloads, skipping partial downloads and other files
+func (s *CleanupService) listMediaFiles(ctx context.Context) ([]storage.ObjectInfo, error) {
+	objects, err := s.store.List(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to read output directory: %v", err)
+		return nil, fmt.Errorf("failed to list stored files: %v", err)
 	}
 
-	for _, file := range files {
-		filePath := filepath.Join(s.config.OutputDir, file.Name())
-		_, err := file.Info()
-		if err != nil {
-			log.Printf("Error getting file info for %s: %v", filePath, err)
-			continue
+	var media []storage.ObjectInfo
+	for _, object := range objects {
+		if isMediaFile(object.Key) {
+			media = append(media, object)
 		}
+	}
+	return media, nil
+}
 
-		// Skip if not a video file
-		if !isVideoFile(file.Name()) {
+// expiredFiles returns the files whose last request key expired, i.e. that haven't been
+// requested within the retention period
+func (s *CleanupService) expiredFiles(ctx context.Context, objects []storage.ObjectInfo) []CleanedFile {
+	var expired []CleanedFile
+	for _, object := range objects {
+		filePath := filepath.Join(s.config.OutputDir, object.Key)
+
+		// Skip files that are kept for good, or in use
+		if s.isPinned(ctx, filePath) || s.isHeld(ctx, filePath) {
 			continue
 		}
 
-		// Check if file has been requested in the last hour
-		key := rediskeys.GetLastRequestKey(filePath)
-		exists, err := s.redis.Exists(ctx, key).Result()
+		exists, err := s.redis.Exists(ctx, rediskeys.GetLastRequestKey(filePath)).Result()
 		if err != nil {
 			log.Printf("Error checking last request key for %s: %v", filePath, err)
 			continue
 		}
-
-		// If key doesn't exist, file hasn't been requested in the last hour
 		if exists == 0 {
-			if err := s.deleteFile(filePath); err != nil {
-				log.Printf("Error deleting file %s: %v", filePath, err)
+			expired = append(expired, CleanedFile{
+				FilePath: filePath,
+				Size:     object.Size,
+				Reason:   fmt.Sprintf("not requested for %s", s.config.TaskRetention),
+			})
+		}
+	}
+	return expired
+}
+
+// rebuildIndex repairs the media index from the stored files: entries of files that are gone are
+// removed and files that are missing from the index, or changed since they were indexed, are added
+func (s *CleanupService) rebuildIndex(ctx context.Context) error {
+	objects, err := s.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list stored files: %v", err)
+	}
+	stored := make(map[string]storage.ObjectInfo)
+	for _, object := range objects {
+		if urlHash := urlHashFromPath(object.Key); urlHash != "" && isMediaFile(object.Key) {
+			stored[urlHash] = object
+		}
+	}
+
+	entries, err := s.index.List(ctx)
+	if err != nil {
+		return err
+	}
+	indexed := make(map[string]*MediaEntry)
+	for _, entry := range entries {
+		object, ok := stored[entry.URLHash]
+		if !ok {
+			if err := s.index.Delete(ctx, entry.URLHash); err != nil {
+				log.Printf("Error removing index entry of %s: %v", entry.FilePath, err)
+			} else {
+				log.Printf("Removed index entry of missing file: %s", entry.FilePath)
 			}
+			continue
+		}
+		if storage.Key(entry.FilePath) == object.Key && entry.Size == object.Size {
+			indexed[entry.URLHash] = entry
 		}
 	}
 
+	for urlHash, object := range stored {
+		if indexed[urlHash] != nil {
+			continue
+		}
+		if err := s.indexFile(ctx, urlHash, object); err != nil {
+			log.Printf("Error indexing file %s: %v", object.Key, err)
+		} else {
+			log.Printf("Indexed file: %s", object.Key)
+		}
+	}
 	return nil
 }
 
-// deleteFile deletes a file and its associated Redis keys (last request and metadata)
-func (s *CleanupService) deleteFile(filePath string) error {
-	ctx := context.Background()
-
-	// Delete the file
-	if err := os.Remove(filePath); err != nil {
-		return fmt.Errorf("failed to delete file: %v", err)
+// indexFile adds a stored file to the media index. The video and format it was downloaded for
+// can't be told from its hash, but metadata stored by older versions is kept.
+func (s *CleanupService) indexFile(ctx context.Context, urlHash string, object storage.ObjectInfo) error {
+	file, _, err := s.store.Open(ctx, object.Key)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	// Delete the last request key
-	lastRequestKey := rediskeys.GetLastRequestKey(filePath)
-	if err := s.redis.Del(ctx, lastRequestKey).Err(); err != nil {
-		log.Printf("Error deleting Redis key %s: %v", lastRequestKey, err)
+	sum, err := checksum(file)
+	if err != nil {
+		return err
 	}
 
-	// Delete the metadata key
-	metadataKey := rediskeys.GetMetadataKey(filePath)
-	if err := s.redis.Del(ctx, metadataKey).Err(); err != nil {
-		log.Printf("Error deleting Redis metadata key %s: %v", metadataKey, err)
+	filePath := filepath.Join(s.config.OutputDir, object.Key)
+	entry := &MediaEntry{
+		URLHash:   urlHash,
+		FilePath:  filePath,
+		Size:      object.Size,
+		Checksum:  sum,
+		IndexedAt: time.Now().UTC(),
+	}
+	if previous, err := s.index.Get(ctx, urlHash); err == nil && previous != nil {
+		entry.VideoKey, entry.Format, entry.Metadata, entry.Pinned = previous.VideoKey, previous.Format, previous.Metadata, previous.Pinned
+	}
+	if entry.Metadata == nil && s.redis != nil {
+		if data, err := s.redis.Get(ctx, rediskeys.GetMetadataKey(filePath)).Bytes(); err == nil {
+			var metadata VideoMetadata
+			if json.Unmarshal(data, &metadata) == nil {
+				entry.Metadata = &metadata
+			}
+		}
 	}
 
-	log.Printf("Successfully deleted file and associated data: %s", filePath)
+	if err := s.index.Put(ctx, entry); err != nil {
+		return err
+	}
+	if s.redis != nil {
+		s.redis.Del(ctx, rediskeys.GetMetadataKey(filePath))
+	}
 	return nil
 }
 
-// isVideoFile checks if the file is a video file
-func isVideoFile(filename string) bool {
-	extensions := []string{".mp4", ".webm", ".mkv"}
-	for _, ext := range extensions {
-		if filepath.Ext(filename) == ext {
-			return true
+// isPinned reports whether a file is exempt from expiry and eviction
+func (s *CleanupService) isPinned(ctx context.Context, filePath string) bool {
+	entry, err := s.index.Get(ctx, urlHashFromPath(filePath))
+	if err != nil {
+		// Keep the file rather than delete one that may be pinned
+		log.Printf("Error reading index entry of %s: %v", filePath, err)
+		return true
+	}
+	return entry != nil && entry.Pinned
+}
+
+// isHeld reports whether a file is being served or downloaded
+func (s *CleanupService) isHeld(ctx context.Context, filePath string) bool {
+	urlHash := leaseHashFromPath(filePath)
+	if s.leases == nil || urlHash == "" {
+		return false
+	}
+	held, err := s.leases.IsHeld(ctx, urlHash)
+	if err != nil {
+		// Keep the file rather than delete one that may be in use
+		log.Printf("Error checking leases on %s: %v", filePath, err)
+		return true
+	}
+	return held
+}
+
+// deleteFiles deletes files along with their Redis keys, logging why each was deleted, and
+// returns the files that were deleted
+func (s *CleanupService) deleteFiles(ctx context.Context, files []CleanedFile) []CleanedFile {
+	deleted := make([]CleanedFile, 0, len(files))
+	for _, file := range files {
+		// Files may have been requested since the run started
+		err := purgeUnheldFile(ctx, s.store, s.redis, s.index, s.leases, file.FilePath)
+		if errors.Is(err, ErrFileHeld) {
+			log.Printf("Skipped deleting file in use: %s", file.FilePath)
+			continue
 		}
+		if err != nil {
+			log.Printf("Error deleting file %s: %v", file.FilePath, err)
+			continue
+		}
+		log.Printf("Deleted file and associated data: %s (%s)", file.FilePath, file.Reason)
+		deleted = append(deleted, file)
 	}
-	return false
+	return deleted
+}
+
+// purgeUnheldFile deletes a stored file along with its Redis keys, unless it is being served or
+// downloaded, or its leases can't be checked. The files are held exclusively while they are
+// deleted, so a lease can't be taken between the check and the deletion.
+func purgeUnheldFile(ctx context.Context, store storage.StoreInterface, redis *redis.Client, index MediaIndexInterface, leases FileLeasesInterface, filePath string) error {
+	if urlHash := leaseHashFromPath(filePath); leases != nil && urlHash != "" {
+		release, err := leases.AcquireExclusive(ctx, urlHash)
+		if err != nil {
+			// Keep the file rather than delete one that may be in use
+			return fmt.Errorf("%s: %w: %v", filePath, ErrFileHeld, err)
+		}
+		if release == nil {
+			return fmt.Errorf("%s: %w", filePath, ErrFileHeld)
+		}
+		defer release()
+	}
+	return purgeFile(ctx, store, redis, index, filePath)
+}
+
+// purgeFile deletes a stored file along with its last request key, index entry and legacy
+// metadata key. The keys are deleted even if the file is already gone.
+func purgeFile(ctx context.Context, store storage.StoreInterface, redis *redis.Client, index MediaIndexInterface, filePath string) error {
+	// Delete the file
+	if err := store.Delete(ctx, storage.Key(filePath)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to delete file: %v", err)
+	}
+
+	// Delete the last request key and the metadata key of older versions
+	if redis != nil {
+		keys := []string{rediskeys.GetLastRequestKey(filePath), rediskeys.GetMetadataKey(filePath)}
+		if err := redis.Del(ctx, keys...).Err(); err != nil {
+			log.Printf("Error deleting Redis keys of %s: %v", filePath, err)
+		}
+	}
+
+	// Delete the index entry, which holds the metadata
+	if index != nil {
+		if err := index.Delete(ctx, urlHashFromPath(filePath)); err != nil {
+			log.Printf("Error deleting index entry of %s: %v", filePath, err)
+		}
+	}
+	return nil
+}
+
+// isMediaFile checks if the file is a downloaded video or audio file
+func isMediaFile(filename string) bool {
+	_, ok := mediaContentTypes[strings.ToLower(filepath.Ext(filename))]
+	return ok
 }
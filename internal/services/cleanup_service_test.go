@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"spiropoulos94/youtube-downloader/internal/storage"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCleanupReport(t *testing.T) {
+	report := newCleanupReport(true, []CleanedFile{
+		{FilePath: "downloads/a_0123456789abcdef.mp4", Size: 100, Reason: "not requested for 24h0m0s"},
+		{FilePath: "downloads/b_fedcba9876543210.mp4", Size: 50, Reason: "evicted"},
+	})
+	assert.True(t, report.DryRun)
+	assert.Len(t, report.Files, 2)
+	assert.Equal(t, int64(150), report.FreedBytes)
+
+	// Runs that delete nothing report an empty list rather than null
+	assert.NotNil(t, newCleanupReport(false, nil).Files)
+}
+
+func TestIsMediaFile(t *testing.T) {
+	assert.True(t, isMediaFile("downloads/Video_0123456789abcdef.mp4"))
+	assert.True(t, isMediaFile("downloads/Video_0123456789abcdef.MP4"))
+	assert.True(t, isMediaFile("Song_0123456789abcdef.Opus"))
+	assert.False(t, isMediaFile("downloads/Video_0123456789abcdef.mp4.part"))
+	assert.False(t, isMediaFile("downloads/notes.txt"))
+}
+
+// Purging deletes the file and its index entry, and cleans up after files that are already gone
+func TestPurgeFile(t *testing.T) {
+	dir := t.TempDir()
+	store := storage.NewLocalStore(dir)
+	index := memoryIndex{}
+
+	filePath := filepath.Join(dir, "Test Video_0123456789abcdef.mp4")
+	require.NoError(t, os.WriteFile(filePath, []byte("video"), 0644))
+	index["0123456789abcdef"] = MediaEntry{URLHash: "0123456789abcdef", FilePath: filePath, Pinned: true}
+
+	require.NoError(t, purgeFile(context.Background(), store, nil, index, filePath))
+	assert.NoFileExists(t, filePath)
+	assert.Empty(t, index)
+
+	index["0123456789abcdef"] = MediaEntry{URLHash: "0123456789abcdef", FilePath: filePath}
+	require.NoError(t, purgeFile(context.Background(), store, nil, index, filePath))
+	assert.Empty(t, index)
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"spiropoulos94/youtube-downloader/internal/rediskeys"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// downloadLockPollInterval is how often a worker waiting for another worker's download checks the lock
+const downloadLockPollInterval = time.Second
+
+// errDownloadLockLost stops a download whose lock expired before it could be renewed,
+// since another worker may already be writing the same files
+var errDownloadLockLost = errors.New("download lock lost")
+
+// renewLockScript extends a lock only if it is still held by the given owner
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// lockDownload waits until this worker holds the lock on a video hash, so workers sharing the
+// output directory never write the same files at the same time. The lock is a lease that is
+// renewed until the returned unlock function is called, and expires after DownloadLockTTL if
+// the worker dies. The returned context is cancelled if the lease is lost.
+func (s *YouTubeService) lockDownload(ctx context.Context, urlHash string) (context.Context, func(), error) {
+	if s.redis == nil {
+		return ctx, func() {}, nil // The CLI runs without Redis
+	}
+
+	key := rediskeys.GetDownloadLockKey(urlHash)
+	owner := uuid.NewString()
+	ttl := s.config.DownloadLockTTL
+
+	for waiting := false; ; waiting = true {
+		acquired, err := s.redis.SetNX(ctx, key, owner, ttl).Result()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to acquire download lock: %v", err)
+		}
+		if acquired {
+			break
+		}
+		if !waiting {
+			log.Printf("Waiting for another worker to finish downloading %s", urlHash)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("waiting for download lock: %w", ctx.Err())
+		case <-time.After(downloadLockPollInterval):
+		}
+	}
+
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	renewDone := make(chan struct{})
+	go func() {
+		defer close(renewDone)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-lockCtx.Done():
+				return
+			case <-ticker.C:
+				renewed, err := renewLockScript.Run(lockCtx, s.redis, []string{key}, owner, ttl.Milliseconds()).Int()
+				if err != nil && lockCtx.Err() == nil {
+					// Keep trying until the lease runs out, Redis may only be briefly unavailable
+					log.Printf("Warning: Failed to renew download lock of %s: %v", urlHash, err)
+					continue
+				}
+				if err == nil && renewed == 0 {
+					log.Printf("Download lock of %s expired, stopping the download", urlHash)
+					cancel(errDownloadLockLost)
+					return
+				}
+			}
+		}
+	}()
+
+	unlock := func() {
+		cancel(nil)
+		<-renewDone
+		if err := compareAndDeleteScript.Run(context.WithoutCancel(ctx), s.redis, []string{key}, owner).Err(); err != nil {
+			log.Printf("Warning: Failed to release download lock of %s: %v", urlHash, err)
+		}
+	}
+	return lockCtx, unlock, nil
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"context"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockDownloadWithoutRedis(t *testing.T) {
+	// The CLI has no Redis and no other workers, so downloads are never locked
+	service := &YouTubeService{config: &config.Config{}}
+	ctx := context.Background()
+
+	lockCtx, unlock, err := service.lockDownload(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, ctx, lockCtx)
+	unlock()
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Supported video codecs for DownloadOptions.VideoCodec
+const (
+	VideoCodecH264 = "h264"
+	VideoCodecVP9  = "vp9"
+	VideoCodecAV1  = "av1"
+)
+
+// Download modes for DownloadOptions.Mode
+const (
+	ModeVideo = "video"
+	ModeAudio = "audio"
+)
+
+// Supported audio formats for DownloadOptions.AudioFormat
+const (
+	AudioFormatMP3  = "mp3"
+	AudioFormatM4A  = "m4a"
+	AudioFormatOpus = "opus"
+)
+
+const (
+	maxSupportedHeight = 4320 // Largest resolution yt-dlp is asked for (8K)
+	minAudioBitrate    = 32   // kbps
+	maxAudioBitrate    = 320  // kbps
+)
+
+// DownloadOptions describes the format a caller wants a video downloaded in.
+// The zero value keeps yt-dlp's default format selection.
+type DownloadOptions struct {
+	Mode          string `json:"mode,omitempty"`            // "video" (default) or "audio"
+	MaxHeight     int    `json:"max_height,omitempty"`      // Maximum vertical resolution, e.g. 720
+	VideoCodec    string `json:"video_codec,omitempty"`     // Preferred video codec (h264, vp9 or av1)
+	MaxFileSizeMB int    `json:"max_filesize_mb,omitempty"` // Maximum size of each downloaded stream in MB
+	AudioFormat   string `json:"audio_format,omitempty"`    // Audio mode only: mp3 (default), m4a or opus
+	AudioBitrate  int    `json:"audio_bitrate,omitempty"`   // Audio mode only: bitrate in kbps, best quality if unset
+	EphemeralID   string `json:"ephemeral_id,omitempty"`    // Set by the server to the task ID of ephemeral downloads, so their files are never shared
+}
+
+// IsAudio reports whether only the audio track should be extracted
+func (o DownloadOptions) IsAudio() bool {
+	return o.Mode == ModeAudio
+}
+
+// Extension returns the file extension (without the dot) of the downloaded file
+func (o DownloadOptions) Extension() string {
+	if !o.IsAudio() {
+		return "mp4"
+	}
+	if o.AudioFormat == "" {
+		return AudioFormatMP3
+	}
+	return o.AudioFormat
+}
+
+// Validate checks that the options can be turned into a yt-dlp format selection
+func (o DownloadOptions) Validate() error {
+	switch o.Mode {
+	case "", ModeVideo:
+		if o.AudioFormat != "" || o.AudioBitrate != 0 {
+			return fmt.Errorf("audio_format and audio_bitrate require mode %q", ModeAudio)
+		}
+	case ModeAudio:
+		if o.MaxHeight != 0 || o.VideoCodec != "" {
+			return fmt.Errorf("max_height and video_codec cannot be used with mode %q", ModeAudio)
+		}
+	default:
+		return fmt.Errorf("unsupported mode %q (supported: %s, %s)", o.Mode, ModeVideo, ModeAudio)
+	}
+
+	switch o.AudioFormat {
+	case "", AudioFormatMP3, AudioFormatM4A, AudioFormatOpus:
+	default:
+		return fmt.Errorf("unsupported audio format %q (supported: %s, %s, %s)", o.AudioFormat, AudioFormatMP3, AudioFormatM4A, AudioFormatOpus)
+	}
+
+	if o.AudioBitrate != 0 && (o.AudioBitrate < minAudioBitrate || o.AudioBitrate > maxAudioBitrate) {
+		return fmt.Errorf("audio_bitrate must be between %d and %d kbps", minAudioBitrate, maxAudioBitrate)
+	}
+
+	if o.MaxHeight < 0 || o.MaxHeight > maxSupportedHeight {
+		return fmt.Errorf("max_height must be between 1 and %d, or 0 for no limit", maxSupportedHeight)
+	}
+
+	switch o.VideoCodec {
+	case "", VideoCodecH264, VideoCodecVP9, VideoCodecAV1:
+	default:
+		return fmt.Errorf("unsupported video codec %q (supported: %s, %s, %s)", o.VideoCodec, VideoCodecH264, VideoCodecVP9, VideoCodecAV1)
+	}
+
+	if o.MaxFileSizeMB < 0 {
+		return fmt.Errorf("max_filesize_mb cannot be negative")
+	}
+
+	if o.EphemeralID != "" {
+		return fmt.Errorf("ephemeral_id is set by the server, use ephemeral instead")
+	}
+
+	return nil
+}
+
+// CacheKey returns a stable string identifying the chosen format.
+// It is empty for the default format so existing cache entries stay valid.
+func (o DownloadOptions) CacheKey() string {
+	var parts []string
+	if o.IsAudio() {
+		parts = append(parts, "a"+o.Extension())
+		if o.AudioBitrate > 0 {
+			parts = append(parts, fmt.Sprintf("b%d", o.AudioBitrate))
+		}
+	}
+	if o.MaxHeight > 0 {
+		parts = append(parts, fmt.Sprintf("h%d", o.MaxHeight))
+	}
+	if o.VideoCodec != "" {
+		parts = append(parts, "c"+o.VideoCodec)
+	}
+	if o.MaxFileSizeMB > 0 {
+		parts = append(parts, fmt.Sprintf("s%d", o.MaxFileSizeMB))
+	}
+	if o.EphemeralID != "" {
+		parts = append(parts, "e"+o.EphemeralID)
+	}
+	return strings.Join(parts, "-")
+}
+
+// formatArgs returns the yt-dlp arguments selecting the requested format
+func (o DownloadOptions) formatArgs() []string {
+	if o.IsAudio() {
+		return o.audioFormatArgs()
+	}
+
+	args := []string{"--merge-output-format", "mp4"} // Force output to be MP4
+
+	// Hard limits (resolution and size) are expressed as format filters
+	var filters string
+	if o.MaxHeight > 0 {
+		filters += fmt.Sprintf("[height<=%d]", o.MaxHeight)
+	}
+	if o.MaxFileSizeMB > 0 {
+		// "<?" also accepts formats whose size yt-dlp does not know in advance
+		filters += fmt.Sprintf("[filesize<?%dM][filesize_approx<?%dM]", o.MaxFileSizeMB, o.MaxFileSizeMB)
+	}
+	if filters != "" {
+		args = append(args, "-f", fmt.Sprintf("bv*%s+ba/b%s", filters, filters))
+	}
+
+	// The codec is a preference, so it goes into the format sort order
+	if o.VideoCodec != "" {
+		args = append(args, "-S", "vcodec:"+ytdlpCodecName(o.VideoCodec))
+	}
+
+	if o.MaxFileSizeMB > 0 {
+		// Abort instead of silently downloading a larger file when sizes were unknown
+		args = append(args, "--max-filesize", fmt.Sprintf("%dM", o.MaxFileSizeMB))
+	}
+
+	return args
+}
+
+// audioFormatArgs returns the yt-dlp arguments extracting the audio track
+func (o DownloadOptions) audioFormatArgs() []string {
+	format := "ba/b"
+	if o.MaxFileSizeMB > 0 {
+		format = fmt.Sprintf("ba[filesize<?%dM]/b[filesize<?%dM]", o.MaxFileSizeMB, o.MaxFileSizeMB)
+	}
+
+	// Audio quality 0 is the best variable bitrate
+	quality := "0"
+	if o.AudioBitrate > 0 {
+		quality = fmt.Sprintf("%dK", o.AudioBitrate)
+	}
+
+	args := []string{
+		"-f", format,
+		"--extract-audio",
+		"--audio-format", o.Extension(),
+		"--audio-quality", quality,
+	}
+	if o.MaxFileSizeMB > 0 {
+		args = append(args, "--max-filesize", fmt.Sprintf("%dM", o.MaxFileSizeMB))
+	}
+	return args
+}
+
+// ytdlpCodecName maps our codec names to the names used in yt-dlp's format sorting
+func ytdlpCodecName(codec string) string {
+	if codec == VideoCodecAV1 {
+		return "av01"
+	}
+	return codec
+}
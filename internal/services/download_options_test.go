@@ -0,0 +1,109 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test DownloadOptions.Validate
+func TestDownloadOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    DownloadOptions
+		wantErr bool
+	}{
+		{name: "Default options", opts: DownloadOptions{}, wantErr: false},
+		{name: "All options set", opts: DownloadOptions{MaxHeight: 720, VideoCodec: VideoCodecVP9, MaxFileSizeMB: 500}, wantErr: false},
+		{name: "Negative height", opts: DownloadOptions{MaxHeight: -1}, wantErr: true},
+		{name: "Height too large", opts: DownloadOptions{MaxHeight: 10000}, wantErr: true},
+		{name: "Unknown codec", opts: DownloadOptions{VideoCodec: "mpeg2"}, wantErr: true},
+		{name: "Negative file size", opts: DownloadOptions{MaxFileSizeMB: -5}, wantErr: true},
+		{name: "Audio mode", opts: DownloadOptions{Mode: ModeAudio, AudioFormat: AudioFormatOpus, AudioBitrate: 128}, wantErr: false},
+		{name: "Unknown mode", opts: DownloadOptions{Mode: "subtitles"}, wantErr: true},
+		{name: "Unknown audio format", opts: DownloadOptions{Mode: ModeAudio, AudioFormat: "flac"}, wantErr: true},
+		{name: "Audio bitrate out of range", opts: DownloadOptions{Mode: ModeAudio, AudioBitrate: 1000}, wantErr: true},
+		{name: "Audio format in video mode", opts: DownloadOptions{AudioFormat: AudioFormatMP3}, wantErr: true},
+		{name: "Resolution in audio mode", opts: DownloadOptions{Mode: ModeAudio, MaxHeight: 720}, wantErr: true},
+		{name: "Ephemeral ID set by the client", opts: DownloadOptions{EphemeralID: "abc"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			assert.Equal(t, tt.wantErr, err != nil, "Validate() error = %v", err)
+		})
+	}
+
+	// The error names the whole accepted range, including 0
+	assert.EqualError(t, DownloadOptions{MaxHeight: -1}.Validate(), "max_height must be between 1 and 4320, or 0 for no limit")
+}
+
+// Test DownloadOptions.CacheKey
+func TestDownloadOptionsCacheKey(t *testing.T) {
+	assert.Equal(t, "", DownloadOptions{}.CacheKey())
+	assert.Equal(t, "h720", DownloadOptions{MaxHeight: 720}.CacheKey())
+	assert.Equal(t, "h1080-ch264-s200", DownloadOptions{MaxHeight: 1080, VideoCodec: VideoCodecH264, MaxFileSizeMB: 200}.CacheKey())
+	assert.Equal(t, "h720-eabc", DownloadOptions{MaxHeight: 720, EphemeralID: "abc"}.CacheKey())
+	assert.Equal(t, "amp3", DownloadOptions{Mode: ModeAudio}.CacheKey())
+	assert.Equal(t, "am4a-b192", DownloadOptions{Mode: ModeAudio, AudioFormat: AudioFormatM4A, AudioBitrate: 192}.CacheKey())
+}
+
+// Test DownloadOptions.Extension
+func TestDownloadOptionsExtension(t *testing.T) {
+	assert.Equal(t, "mp4", DownloadOptions{}.Extension())
+	assert.Equal(t, "mp4", DownloadOptions{Mode: ModeVideo, MaxHeight: 720}.Extension())
+	assert.Equal(t, "mp3", DownloadOptions{Mode: ModeAudio}.Extension())
+	assert.Equal(t, "opus", DownloadOptions{Mode: ModeAudio, AudioFormat: AudioFormatOpus}.Extension())
+}
+
+// Test DownloadOptions.formatArgs
+func TestDownloadOptionsFormatArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     DownloadOptions
+		expected []string
+	}{
+		{
+			name:     "Default options",
+			opts:     DownloadOptions{},
+			expected: []string{"--merge-output-format", "mp4"},
+		},
+		{
+			name:     "Max height",
+			opts:     DownloadOptions{MaxHeight: 480},
+			expected: []string{"--merge-output-format", "mp4", "-f", "bv*[height<=480]+ba/b[height<=480]"},
+		},
+		{
+			name:     "AV1 codec",
+			opts:     DownloadOptions{VideoCodec: VideoCodecAV1},
+			expected: []string{"--merge-output-format", "mp4", "-S", "vcodec:av01"},
+		},
+		{
+			name: "Height, codec and size",
+			opts: DownloadOptions{MaxHeight: 720, VideoCodec: VideoCodecH264, MaxFileSizeMB: 100},
+			expected: []string{
+				"--merge-output-format", "mp4",
+				"-f", "bv*[height<=720][filesize<?100M][filesize_approx<?100M]+ba/b[height<=720][filesize<?100M][filesize_approx<?100M]",
+				"-S", "vcodec:h264",
+				"--max-filesize", "100M",
+			},
+		},
+		{
+			name:     "Audio with defaults",
+			opts:     DownloadOptions{Mode: ModeAudio},
+			expected: []string{"-f", "ba/b", "--extract-audio", "--audio-format", "mp3", "--audio-quality", "0"},
+		},
+		{
+			name:     "Audio with format and bitrate",
+			opts:     DownloadOptions{Mode: ModeAudio, AudioFormat: AudioFormatM4A, AudioBitrate: 128},
+			expected: []string{"-f", "ba/b", "--extract-audio", "--audio-format", "m4a", "--audio-quality", "128K"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.opts.formatArgs())
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"spiropoulos94/youtube-downloader/internal/rediskeys"
+	"spiropoulos94/youtube-downloader/internal/storage"
+	"time"
+)
+
+// evictionCandidate is a stored video that may be evicted to free up space
+type evictionCandidate struct {
+	filePath      string
+	size          int64
+	lastRequested time.Time // Zero if the time is unknown, which makes the file the first to go
+}
+
+// enforceQuota evicts the least recently requested videos once stored videos take more than
+// MaxStorageSize, until they are down to the low watermark. Pinned videos are never evicted.
+func (s *CleanupService) enforceQuota(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects, err := s.listMediaFiles(ctx)
+	if err != nil {
+		return err
+	}
+	evictions, err := s.quotaEvictions(ctx, objects, nil)
+	if err != nil {
+		return err
+	}
+	s.deleteFiles(ctx, evictions)
+	return nil
+}
+
+// quotaEvictions returns the videos to evict to bring storage usage under its limit, once the
+// files a cleanup run already deletes are gone
+func (s *CleanupService) quotaEvictions(ctx context.Context, objects []storage.ObjectInfo, deleting []CleanedFile) ([]CleanedFile, error) {
+	if s.config.MaxStorageSize <= 0 {
+		return nil, nil
+	}
+
+	deleted := make(map[string]bool, len(deleting))
+	for _, file := range deleting {
+		deleted[file.FilePath] = true
+	}
+
+	var usage int64
+	var candidates []evictionCandidate
+	for _, object := range objects {
+		filePath := filepath.Join(s.config.OutputDir, object.Key)
+		if deleted[filePath] {
+			continue
+		}
+		usage += object.Size
+
+		if s.isPinned(ctx, filePath) || s.isHeld(ctx, filePath) {
+			continue
+		}
+		candidates = append(candidates, evictionCandidate{filePath: filePath, size: object.Size})
+	}
+	if usage <= s.config.MaxStorageSize {
+		return nil, nil
+	}
+
+	target := s.lowWatermark()
+	log.Printf("Stored videos take %s, over the %s limit: evicting down to %s", formatSize(usage), formatSize(s.config.MaxStorageSize), formatSize(target))
+
+	if err := s.loadLastRequestTimes(ctx, candidates); err != nil {
+		return nil, err
+	}
+	var evictions []CleanedFile
+	for _, candidate := range selectEvictions(candidates, usage, target) {
+		lastRequested := "never"
+		if !candidate.lastRequested.IsZero() {
+			lastRequested = candidate.lastRequested.Format(time.RFC3339)
+		}
+		evictions = append(evictions, CleanedFile{
+			FilePath: candidate.filePath,
+			Size:     candidate.size,
+			Reason:   fmt.Sprintf("evicted to stay under the %s storage limit, last requested %s", formatSize(s.config.MaxStorageSize), lastRequested),
+		})
+		usage -= candidate.size
+	}
+
+	if usage > target {
+		log.Printf("Warning: Stored videos still take %s after eviction, pinned videos and videos in use can't be evicted", formatSize(usage))
+	}
+	return evictions, nil
+}
+
+// lowWatermark returns the usage eviction brings stored videos down to
+func (s *CleanupService) lowWatermark() int64 {
+	if s.config.StorageLowWater > 0 && s.config.StorageLowWater < s.config.MaxStorageSize {
+		return s.config.StorageLowWater
+	}
+	return s.config.MaxStorageSize / 10 * 9
+}
+
+// loadLastRequestTimes reads when each candidate was last requested
+func (s *CleanupService) loadLastRequestTimes(ctx context.Context, candidates []evictionCandidate) error {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		keys[i] = rediskeys.GetLastRequestKey(candidate.filePath)
+	}
+	values, err := s.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read last request times: %v", err)
+	}
+
+	for i, value := range values {
+		if text, ok := value.(string); ok {
+			candidates[i].lastRequested, _ = time.Parse(time.RFC3339, text)
+		}
+	}
+	return nil
+}
+
+// selectEvictions returns the least recently requested candidates whose eviction brings usage
+// down to target
+func selectEvictions(candidates []evictionCandidate, usage int64, target int64) []evictionCandidate {
+	sorted := make([]evictionCandidate, len(candidates))
+	copy(sorted, candidates)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].lastRequested.Before(sorted[j].lastRequested)
+	})
+
+	var evictions []evictionCandidate
+	for _, candidate := range sorted {
+		if usage <= target {
+			break
+		}
+		evictions = append(evictions, candidate)
+		usage -= candidate.size
+	}
+	return evictions
+}
+
+// formatSize formats a size in bytes for logs, e.g. "1.5 GB"
+func formatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"spiropoulos94/youtube-downloader/internal/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectEvictions(t *testing.T) {
+	now := time.Now()
+	candidates := []evictionCandidate{
+		{filePath: "recent.mp4", size: 40, lastRequested: now},
+		{filePath: "old.mp4", size: 30, lastRequested: now.Add(-2 * time.Hour)},
+		{filePath: "unknown.mp4", size: 10},
+		{filePath: "older.mp4", size: 20, lastRequested: now.Add(-3 * time.Hour)},
+	}
+
+	paths := func(evictions []evictionCandidate) []string {
+		var paths []string
+		for _, eviction := range evictions {
+			paths = append(paths, eviction.filePath)
+		}
+		return paths
+	}
+
+	// Least recently requested first, files never requested before anything else
+	assert.Equal(t, []string{"unknown.mp4", "older.mp4"}, paths(selectEvictions(candidates, 100, 75)))
+	assert.Equal(t, []string{"unknown.mp4", "older.mp4", "old.mp4"}, paths(selectEvictions(candidates, 100, 60)))
+	assert.Empty(t, selectEvictions(candidates, 100, 100))
+
+	// Pinned files aren't candidates, so usage may stay over the target
+	assert.Len(t, selectEvictions(candidates, 1000, 0), 4)
+}
+
+func TestLowWatermark(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      int64
+		low      int64
+		expected int64
+	}{
+		{name: "Configured", max: 1000, low: 500, expected: 500},
+		{name: "Default", max: 1000, expected: 900},
+		{name: "Above the maximum", max: 1000, low: 2000, expected: 900},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &CleanupService{config: &config.Config{MaxStorageSize: tt.max, StorageLowWater: tt.low}}
+			assert.Equal(t, tt.expected, service.lowWatermark())
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", formatSize(512))
+	assert.Equal(t, "1.5 KB", formatSize(1536))
+	assert.Equal(t, "50.0 GB", formatSize(50<<30))
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"spiropoulos94/youtube-downloader/internal/rediskeys"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// FileLeases implements FileLeasesInterface in Redis. The leases on the files of a video hash are
+// kept in a sorted set scored by their expiry, so leases of crashed servers and workers run out
+// on their own.
+type FileLeases struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+// NewFileLeases creates a new FileLeases instance whose renewed leases expire ttl after the
+// server or worker holding them dies
+func NewFileLeases(redis *redis.Client, ttl time.Duration) FileLeasesInterface {
+	return &FileLeases{
+		redis: redis,
+		ttl:   ttl,
+	}
+}
+
+// exclusiveLeaseID is the member of the exclusive lease the cleanup service takes on the files of
+// a video hash while it deletes them
+const exclusiveLeaseID = "exclusive"
+
+// exclusiveLeaseRetryInterval is how often a lease refused while the files are being deleted is
+// tried again
+const exclusiveLeaseRetryInterval = 100 * time.Millisecond
+
+// errExclusiveLease is returned when a lease is refused because the files are being deleted
+var errExclusiveLease = errors.New("files are being deleted")
+
+// addLeaseScript adds or extends a lease until ARGV[2] milliseconds from now, and keeps the set
+// around at least as long as the lease. Expiries are taken from the Redis clock, so servers and
+// workers with skewed clocks agree on them. While the exclusive lease ARGV[3] is held by someone
+// else, it returns 0 without adding the lease.
+var addLeaseScript = redis.NewScript(`
+redis.replicate_commands()
+local ttl = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local exclusive = redis.call("ZSCORE", KEYS[1], ARGV[3])
+if ARGV[1] ~= ARGV[3] and exclusive and tonumber(exclusive) > now then
+	return 0
+end
+redis.call("ZADD", KEYS[1], now + ttl, ARGV[1])
+if redis.call("PTTL", KEYS[1]) < ttl then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return 1
+`)
+
+// addLimitedLeaseScript adds lease ARGV[1] until ARGV[2] milliseconds from now if fewer than
+// ARGV[3] leases are held, dropping the expired ones first. It returns 1 if the lease was added,
+// 0 if too many are held.
+var addLimitedLeaseScript = redis.NewScript(`
+redis.replicate_commands()
+local ttl = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], now + ttl, ARGV[1])
+if redis.call("PTTL", KEYS[1]) < ttl then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return 1
+`)
+
+// countLeasesScript counts the leases that haven't expired by the Redis clock
+var countLeasesScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+return redis.call("ZCOUNT", KEYS[1], "(" .. string.format("%d", now), "+inf")
+`)
+
+// Acquire holds the files of a video hash until the returned release function is first called.
+// The lease is renewed in the meantime.
+func (l *FileLeases) Acquire(ctx context.Context, urlHash string) (func(), error) {
+	return holdLease(ctx, l.redis, rediskeys.GetFileLeasesKey(urlHash), l.ttl)
+}
+
+// AcquireFor holds the files of a video hash for a fixed time, e.g. while a presigned URL to
+// them is valid
+func (l *FileLeases) AcquireFor(ctx context.Context, urlHash string, ttl time.Duration) error {
+	return waitForLease(ctx, l.redis, rediskeys.GetFileLeasesKey(urlHash), uuid.NewString(), ttl)
+}
+
+// AcquireExclusive holds the files of a video hash exclusively, to delete them, if no other lease
+// is held on them. Other leases wait until the returned release function is first called. It
+// returns a nil release function if the files are held.
+func (l *FileLeases) AcquireExclusive(ctx context.Context, urlHash string) (func(), error) {
+	key := rediskeys.GetFileLeasesKey(urlHash)
+	acquired, err := addLimitedLease(ctx, l.redis, key, exclusiveLeaseID, l.ttl, 1)
+	if err != nil || !acquired {
+		return nil, err
+	}
+	return keepLease(ctx, l.redis, key, exclusiveLeaseID, l.ttl), nil
+}
+
+// IsHeld reports whether the files of a video hash hold a lease that hasn't expired
+func (l *FileLeases) IsHeld(ctx context.Context, urlHash string) (bool, error) {
+	count, err := countLeases(ctx, l.redis, rediskeys.GetFileLeasesKey(urlHash))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// holdLease adds a lease to the sorted set at key until the returned release function is first
+// called, renewing it in the meantime so it only runs out if its holder dies
+func holdLease(ctx context.Context, client *redis.Client, key string, ttl time.Duration) (func(), error) {
+	leaseID := uuid.NewString()
+	if err := waitForLease(ctx, client, key, leaseID, ttl); err != nil {
+		return nil, err
+	}
+	return keepLease(ctx, client, key, leaseID, ttl), nil
+}
+
+// keepLease renews a lease added to the sorted set at key until the returned release function
+// is first called, which removes it
+func keepLease(ctx context.Context, client *redis.Client, key string, leaseID string, ttl time.Duration) func() {
+	renewCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	renewDone := make(chan struct{})
+	go func() {
+		defer close(renewDone)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-ticker.C:
+				if err := addLease(renewCtx, client, key, leaseID, ttl); err != nil && renewCtx.Err() == nil {
+					// Keep trying until the lease runs out, Redis may only be briefly unavailable
+					log.Printf("Warning: Failed to renew lease on %s: %v", key, err)
+				}
+			}
+		}
+	}()
+
+	return sync.OnceFunc(func() {
+		cancel()
+		<-renewDone
+		if err := client.ZRem(context.WithoutCancel(ctx), key, leaseID).Err(); err != nil {
+			log.Printf("Warning: Failed to release lease on %s: %v", key, err)
+		}
+	})
+}
+
+// waitForLease adds a lease to the sorted set at key until ttl from now, waiting while another
+// holder has the exclusive lease
+func waitForLease(ctx context.Context, client *redis.Client, key string, leaseID string, ttl time.Duration) error {
+	for {
+		err := addLease(ctx, client, key, leaseID, ttl)
+		if !errors.Is(err, errExclusiveLease) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for lease: %w", ctx.Err())
+		case <-time.After(exclusiveLeaseRetryInterval):
+		}
+	}
+}
+
+// addLease adds or extends a lease in the sorted set at key until ttl from now. It returns
+// errExclusiveLease while another holder has the exclusive lease.
+func addLease(ctx context.Context, client *redis.Client, key string, leaseID string, ttl time.Duration) error {
+	added, err := addLeaseScript.Run(ctx, client, []string{key}, leaseID, ttl.Milliseconds(), exclusiveLeaseID).Int()
+	if err != nil {
+		return fmt.Errorf("failed to acquire lease: %v", err)
+	}
+	if added == 0 {
+		return errExclusiveLease
+	}
+	return nil
+}
+
+// addLimitedLease adds a lease to the sorted set at key until ttl from now, if fewer than limit
+// leases are held, and reports whether it did
+func addLimitedLease(ctx context.Context, client *redis.Client, key string, leaseID string, ttl time.Duration, limit int) (bool, error) {
+	added, err := addLimitedLeaseScript.Run(ctx, client, []string{key}, leaseID, ttl.Milliseconds(), limit).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease: %v", err)
+	}
+	return added == 1, nil
+}
+
+// countLeases returns the number of leases in the sorted set at key that haven't expired
+func countLeases(ctx context.Context, client *redis.Client, key string) (int64, error) {
+	count, err := countLeasesScript.Run(ctx, client, []string{key}).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count leases: %v", err)
+	}
+	return count, nil
+}
+
+// leaseHashPattern matches the video hash in the name of a downloaded file, including the
+// intermediate files of a download in progress, e.g. "Title_<hash>.f137.mp4"
+var leaseHashPattern = regexp.MustCompile(`_([0-9a-f]{16})\.`)
+
+// leaseHashFromPath returns the video hash whose leases hold a file, or an empty string if the
+// file isn't named like a download
+func leaseHashFromPath(filePath string) string {
+	matches := leaseHashPattern.FindAllStringSubmatch(filepath.Base(filePath), -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[len(matches)-1][1]
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryLeases is a FileLeasesInterface counting the leases held on each video hash
+type memoryLeases struct {
+	held map[string]int
+	err  error
+}
+
+func (l *memoryLeases) Acquire(ctx context.Context, urlHash string) (func(), error) {
+	l.held[urlHash]++
+	return func() { l.held[urlHash]-- }, nil
+}
+
+func (l *memoryLeases) AcquireFor(ctx context.Context, urlHash string, ttl time.Duration) error {
+	l.held[urlHash]++
+	return nil
+}
+
+func (l *memoryLeases) AcquireExclusive(ctx context.Context, urlHash string) (func(), error) {
+	if l.err != nil || l.held[urlHash] > 0 {
+		return nil, l.err
+	}
+	l.held[urlHash]++
+	return func() { l.held[urlHash]-- }, nil
+}
+
+func (l *memoryLeases) IsHeld(ctx context.Context, urlHash string) (bool, error) {
+	return l.held[urlHash] > 0, l.err
+}
+
+func TestLeaseHashFromPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/downloads/Test Video_0123456789abcdef.mp4", want: "0123456789abcdef"},
+		{path: "/downloads/Test Video_0123456789abcdef.f137.mp4", want: "0123456789abcdef"},
+		{path: "/downloads/Test_1111111111111111. Video_0123456789abcdef.mp3", want: "0123456789abcdef"},
+		{path: "/downloads/Test Video.mp4", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, leaseHashFromPath(tt.path))
+		})
+	}
+}
+
+// Files are held while the lease is, and never without Redis
+func TestHoldFile(t *testing.T) {
+	leases := &memoryLeases{held: map[string]int{}}
+	service := &YouTubeService{config: &config.Config{}, leases: leases}
+	filePath := "/downloads/Test Video_0123456789abcdef.mp4"
+
+	release, err := service.HoldFile(context.Background(), filePath)
+	require.NoError(t, err)
+	assert.Equal(t, 1, leases.held["0123456789abcdef"])
+	release()
+	assert.Equal(t, 0, leases.held["0123456789abcdef"])
+
+	release, err = (&YouTubeService{config: &config.Config{}}).HoldFile(context.Background(), filePath)
+	require.NoError(t, err)
+	release()
+}
+
+// Held files can't be purged, and files whose leases can't be checked are treated as held
+func TestPurgeHeldFile(t *testing.T) {
+	dir := t.TempDir()
+	leases := &memoryLeases{held: map[string]int{"0123456789abcdef": 1}}
+	service := &CleanupService{config: &config.Config{OutputDir: dir}, store: storage.NewLocalStore(dir), index: memoryIndex{}, leases: leases}
+
+	filePath := filepath.Join(dir, "Test Video_0123456789abcdef.mp4")
+	require.NoError(t, os.WriteFile(filePath, []byte("video"), 0644))
+
+	assert.ErrorIs(t, service.PurgeFile(context.Background(), filePath), ErrFileHeld)
+	assert.FileExists(t, filePath)
+
+	leases.held["0123456789abcdef"] = 0
+	leases.err = errors.New("connection refused")
+	assert.ErrorIs(t, service.PurgeFile(context.Background(), filePath), ErrFileHeld)
+
+	leases.err = nil
+	require.NoError(t, service.PurgeFile(context.Background(), filePath))
+	assert.NoFileExists(t, filePath)
+}
@@ -1,17 +1,36 @@
 package services
 
 import (
+	"context"
 	"net/http"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"time"
 )
 
 // YouTubeServiceInterface defines the contract for YouTube-related operations
 type YouTubeServiceInterface interface {
-	UpdateLastRequestTime(filePath string) error
-	GetURLHash(url string) string
-	DownloadVideo(url string) (*VideoData, error)
-	StoreMetadata(filePath string, metadata *VideoMetadata) error
-	GetStoredMetadata(filePath string) (*VideoMetadata, error)
+	UpdateLastRequestTime(ctx context.Context, filePath string) error
+	GetURLHash(url string, opts DownloadOptions) string
+	FindDownloadedFile(ctx context.Context, url string, opts DownloadOptions) (string, error)
+	DownloadVideo(ctx context.Context, url string, opts DownloadOptions, onProgress ProgressFunc) (*VideoData, error)
+	ListPlaylist(ctx context.Context, url string, maxItems int) (*PlaylistInfo, error)
+	GetVideoInfo(ctx context.Context, url string) (*VideoInfo, error)
+	StoreMetadata(ctx context.Context, filePath string, metadata *VideoMetadata) error
+	GetStoredMetadata(ctx context.Context, filePath string) (*VideoMetadata, error)
+	SetPinned(ctx context.Context, urlHash string, pinned bool) (*MediaEntry, error)
+	HoldFile(ctx context.Context, filePath string) (func(), error)
+	HoldFileFor(ctx context.Context, filePath string, ttl time.Duration) error
+	DeleteFile(ctx context.Context, filePath string) error
 	GetOriginalFilename(filePath string, escape bool) string
+	GetContentType(filePath string) string
+}
+
+// MediaIndexInterface defines the contract for the index of finished downloads by video hash
+type MediaIndexInterface interface {
+	Get(ctx context.Context, urlHash string) (*MediaEntry, error)
+	Put(ctx context.Context, entry *MediaEntry) error
+	Delete(ctx context.Context, urlHash string) error
+	List(ctx context.Context) ([]*MediaEntry, error)
 }
 
 // FrontendServiceInterface defines the contract for frontend-related operations
@@ -19,8 +38,82 @@ type FrontendServiceInterface interface {
 	ServeStaticFiles(w http.ResponseWriter, r *http.Request)
 }
 
+// FileLeasesInterface defines the contract for the leases holding the files of a video hash while
+// they are served or downloaded, so the cleanup service doesn't delete them
+type FileLeasesInterface interface {
+	Acquire(ctx context.Context, urlHash string) (func(), error)
+	AcquireFor(ctx context.Context, urlHash string, ttl time.Duration) error
+	AcquireExclusive(ctx context.Context, urlHash string) (func(), error)
+	IsHeld(ctx context.Context, urlHash string) (bool, error)
+}
+
 // CleanupServiceInterface defines the contract for cleanup operations
 type CleanupServiceInterface interface {
 	Start()
 	Stop()
+	RunCleanup(ctx context.Context, dryRun bool) (*CleanupReport, error)
+	PurgeFile(ctx context.Context, filePath string) error
+}
+
+// TaskServiceInterface defines the contract for task state shared between workers and the API
+type TaskServiceInterface interface {
+	PublishTaskEvent(ctx context.Context, taskID string, data []byte) error
+	SubscribeTaskEvents(ctx context.Context, taskIDs []string) (*TaskEventSubscription, error)
+	SaveFinalTaskState(ctx context.Context, taskID string, data []byte, retention time.Duration) error
+	GetFinalTaskState(ctx context.Context, taskID string) ([]byte, error)
+	ClaimInFlightTask(ctx context.Context, urlHash string, taskID string, ttl time.Duration) (string, time.Duration, error)
+	ReleaseInFlightTask(ctx context.Context, urlHash string, taskID string) error
+	AttachCaller(ctx context.Context, taskID string, callerID string, ttl time.Duration) error
+	DetachCaller(ctx context.Context, taskID string, callerID string) (bool, int64, error)
+	IsCaller(ctx context.Context, taskID string, callerID string) (bool, error)
+	RecordTransfer(ctx context.Context, taskID string, start int64, length int64, retention time.Duration) (int64, error)
+}
+
+// SubscriptionServiceInterface defines the contract for storing subscriptions and their download archives
+type SubscriptionServiceInterface interface {
+	CreateSubscription(ctx context.Context, subscription *Subscription) error
+	GetSubscription(ctx context.Context, id string) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	UpdateSubscription(ctx context.Context, subscription *Subscription) error
+	DeleteSubscription(ctx context.Context, id string) error
+	SaveSubscriptionSync(ctx context.Context, id string, sync *SubscriptionSync) error
+	ArchiveVideo(ctx context.Context, id string, videoID string) (bool, error)
+	UnarchiveVideo(ctx context.Context, id string, videoID string) error
+	IsArchived(ctx context.Context, id string, videoID string) (bool, error)
+}
+
+// ShareServiceInterface defines the contract for storing share links and counting their downloads
+type ShareServiceInterface interface {
+	CreateShare(ctx context.Context, link *ShareLink, password string, maxTTL time.Duration) error
+	GetShare(ctx context.Context, token string) (*ShareLink, error)
+	ListShares(ctx context.Context, taskID string) ([]*ShareLink, error)
+	RevokeShare(ctx context.Context, taskID string, token string) error
+	ClaimDownload(ctx context.Context, link *ShareLink) (bool, error)
+}
+
+// APIKeyServiceInterface defines the contract for storing API keys and tracking their daily quotas
+type APIKeyServiceInterface interface {
+	CreateAPIKey(ctx context.Context, apiKey *APIKey) (string, error)
+	GetAPIKey(ctx context.Context, id string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]*APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+	Authenticate(ctx context.Context, key string) (*APIKey, error)
+	GetUsage(ctx context.Context, id string) (*APIKeyUsage, error)
+	ClaimDownload(ctx context.Context, apiKey *APIKey) error
+	RefundDownload(ctx context.Context, id string) error
+	CheckDownload(ctx context.Context, apiKey *APIKey) error
+	CheckBytes(ctx context.Context, apiKey *APIKey) error
+	RecordBytes(ctx context.Context, id string, bytes int64) error
+}
+
+// RateLimiterInterface defines the contract for counting client requests against rate limits
+type RateLimiterInterface interface {
+	Allow(ctx context.Context, route string, client string, limit config.RateLimit) (*RateLimitResult, error)
+}
+
+// OutboundLimiterInterface defines the contract for limiting the downloads workers start together
+type OutboundLimiterInterface interface {
+	Acquire(ctx context.Context) (int64, func(), error)
+	ReportRateLimited(ctx context.Context) (time.Duration, error)
+	PausedFor(ctx context.Context) (time.Duration, error)
 }
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"spiropoulos94/youtube-downloader/internal/rediskeys"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MediaEntry is the index record of a finished download
+type MediaEntry struct {
+	URLHash   string         `json:"url_hash"`            // Video and format of the download, see GetURLHash
+	VideoKey  string         `json:"video_key,omitempty"` // Canonical key of the video, unknown for files found by a rebuild
+	Format    string         `json:"format,omitempty"`    // Format options the file was downloaded with
+	FilePath  string         `json:"file_path"`
+	Size      int64          `json:"size"`
+	Checksum  string         `json:"checksum"` // Hex encoded SHA-256 of the file
+	Metadata  *VideoMetadata `json:"metadata,omitempty"`
+	Pinned    bool           `json:"pinned,omitempty"` // Pinned files are never evicted or expired by the cleanup service
+	IndexedAt time.Time      `json:"indexed_at"`
+}
+
+// ErrFileNotIndexed is returned for files that aren't in the media index
+var ErrFileNotIndexed = errors.New("file is not indexed")
+
+// MediaIndex implements MediaIndexInterface in Redis
+type MediaIndex struct {
+	redis *redis.Client
+}
+
+// NewMediaIndex creates a new MediaIndex instance
+func NewMediaIndex(redis *redis.Client) MediaIndexInterface {
+	return &MediaIndex{
+		redis: redis,
+	}
+}
+
+// Get returns the entry of a video hash, or nil if it hasn't been downloaded
+func (i *MediaIndex) Get(ctx context.Context, urlHash string) (*MediaEntry, error) {
+	data, err := i.redis.Get(ctx, rediskeys.GetMediaEntryKey(urlHash)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media entry: %v", err)
+	}
+
+	var entry MediaEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal media entry: %v", err)
+	}
+	return &entry, nil
+}
+
+// Put adds or replaces the entry of a video hash
+func (i *MediaIndex) Put(ctx context.Context, entry *MediaEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal media entry: %v", err)
+	}
+
+	pipe := i.redis.TxPipeline()
+	pipe.Set(ctx, rediskeys.GetMediaEntryKey(entry.URLHash), data, 0)
+	pipe.SAdd(ctx, rediskeys.GetMediaIndexKey(), entry.URLHash)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store media entry: %v", err)
+	}
+	return nil
+}
+
+// Delete removes the entry of a video hash, if there is one
+func (i *MediaIndex) Delete(ctx context.Context, urlHash string) error {
+	pipe := i.redis.TxPipeline()
+	pipe.Del(ctx, rediskeys.GetMediaEntryKey(urlHash))
+	pipe.SRem(ctx, rediskeys.GetMediaIndexKey(), urlHash)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete media entry: %v", err)
+	}
+	return nil
+}
+
+// List returns every entry of the index
+func (i *MediaIndex) List(ctx context.Context) ([]*MediaEntry, error) {
+	hashes, err := i.redis.SMembers(ctx, rediskeys.GetMediaIndexKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list media index: %v", err)
+	}
+
+	entries := make([]*MediaEntry, 0, len(hashes))
+	for _, urlHash := range hashes {
+		entry, err := i.Get(ctx, urlHash)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			// The entry was deleted while listing
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// urlHashPattern matches the video hash at the end of a downloaded file's name
+var urlHashPattern = regexp.MustCompile(`_([0-9a-f]{16})$`)
+
+// urlHashFromPath returns the video hash a downloaded file is named after (see DownloadVideo),
+// or an empty string if the file isn't named like a download
+func urlHashFromPath(filePath string) string {
+	name := filepath.Base(filePath)
+	match := urlHashPattern.FindStringSubmatch(strings.TrimSuffix(name, filepath.Ext(name)))
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// checksum returns the hex encoded SHA-256 of a file's content
+func checksum(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", fmt.Errorf("failed to compute checksum: %v", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/storage"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryIndex is a MediaIndexInterface keeping its entries in memory
+type memoryIndex map[string]MediaEntry
+
+func (i memoryIndex) Get(ctx context.Context, urlHash string) (*MediaEntry, error) {
+	entry, ok := i[urlHash]
+	if !ok {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func (i memoryIndex) Put(ctx context.Context, entry *MediaEntry) error {
+	i[entry.URLHash] = *entry
+	return nil
+}
+
+func (i memoryIndex) Delete(ctx context.Context, urlHash string) error {
+	delete(i, urlHash)
+	return nil
+}
+
+func (i memoryIndex) List(ctx context.Context) ([]*MediaEntry, error) {
+	var entries []*MediaEntry
+	for _, entry := range i {
+		entry := entry
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
+
+func TestURLHashFromPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/downloads/Test Video_0123456789abcdef.mp4", want: "0123456789abcdef"},
+		{path: "Some_title_with_underscores_fedcba9876543210.mp3", want: "fedcba9876543210"},
+		{path: "/downloads/Test Video_0123456789abcdef.f137.mp4", want: ""},
+		{path: "/downloads/Test Video.mp4", want: ""},
+		{path: "/downloads/Test Video_0123456789ABCDEF.mp4", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, urlHashFromPath(tt.path))
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	sum, err := checksum(strings.NewReader("test video content"))
+	require.NoError(t, err)
+	assert.Equal(t, "b8e219804f9ca63b0cf1d1422176fa55838d065ac80f710e8aa1e985bf7c11fc", sum)
+}
+
+// Lookups go through the index, and entries of files that are gone are dropped
+func TestFindDownloadedFileUsesIndex(t *testing.T) {
+	dir := t.TempDir()
+	index := memoryIndex{}
+	service := NewYouTubeService(&config.Config{OutputDir: dir}, nil, storage.NewLocalStore(dir), index, nil, nil).(*YouTubeService)
+
+	url := "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	opts := DownloadOptions{}
+	urlHash := service.GetURLHash(url, opts)
+	filePath := filepath.Join(dir, "Test Video_"+urlHash+".mp4")
+	require.NoError(t, os.WriteFile(filePath, []byte("video"), 0644))
+
+	// Files that aren't indexed are not found, the cleanup service indexes them
+	found, err := service.FindDownloadedFile(context.Background(), url, opts)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+
+	index[urlHash] = MediaEntry{URLHash: urlHash, FilePath: filePath, Metadata: &VideoMetadata{Title: "Test Video"}}
+	found, err = service.FindDownloadedFile(context.Background(), url, opts)
+	require.NoError(t, err)
+	assert.Equal(t, filePath, found)
+
+	metadata, err := service.GetStoredMetadata(context.Background(), filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "Test Video", metadata.Title)
+
+	require.NoError(t, os.Remove(filePath))
+	found, err = service.FindDownloadedFile(context.Background(), url, opts)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+	assert.NotContains(t, index, urlHash)
+}
+
+// The rebuild indexes new files, re-indexes changed ones and drops entries of missing ones
+func TestRebuildIndex(t *testing.T) {
+	dir := t.TempDir()
+	index := memoryIndex{}
+	service := &CleanupService{config: &config.Config{OutputDir: dir}, store: storage.NewLocalStore(dir), index: index}
+
+	newPath := filepath.Join(dir, "New Video_0123456789abcdef.mp4")
+	changedPath := filepath.Join(dir, "Changed Video_1111111111111111.mp3")
+	require.NoError(t, os.WriteFile(newPath, []byte("new video"), 0644))
+	require.NoError(t, os.WriteFile(changedPath, []byte("changed audio"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Partial_2222222222222222.mp4.part"), []byte("partial"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a video"), 0644))
+
+	index["1111111111111111"] = MediaEntry{URLHash: "1111111111111111", FilePath: changedPath, Size: 1, VideoKey: "abc", Metadata: &VideoMetadata{Title: "Changed Video"}}
+	index["3333333333333333"] = MediaEntry{URLHash: "3333333333333333", FilePath: filepath.Join(dir, "Gone_3333333333333333.mp4")}
+
+	require.NoError(t, service.rebuildIndex(context.Background()))
+
+	require.Len(t, index, 2)
+	assert.Equal(t, newPath, index["0123456789abcdef"].FilePath)
+	assert.Equal(t, int64(len("new video")), index["0123456789abcdef"].Size)
+	assert.Len(t, index["0123456789abcdef"].Checksum, 64)
+
+	changed := index["1111111111111111"]
+	assert.Equal(t, int64(len("changed audio")), changed.Size)
+	assert.Equal(t, "abc", changed.VideoKey)
+	assert.Equal(t, "Changed Video", changed.Metadata.Title)
+}
+
+// Migrating a legacy file moves its index entry to the new hash
+func TestMigrateLegacyFileMovesIndexEntry(t *testing.T) {
+	dir := t.TempDir()
+	index := memoryIndex{}
+	service := NewYouTubeService(&config.Config{OutputDir: dir}, nil, storage.NewLocalStore(dir), index, nil, nil).(*YouTubeService)
+
+	url := "https://youtu.be/dQw4w9WgXcQ?t=30"
+	opts := DownloadOptions{}
+	legacyHash := legacyURLHash(url, opts)
+	legacyPath := filepath.Join(dir, "Test Video_"+legacyHash+".mp4")
+	require.NoError(t, os.WriteFile(legacyPath, []byte("video"), 0644))
+	index[legacyHash] = MediaEntry{URLHash: legacyHash, FilePath: legacyPath, Metadata: &VideoMetadata{Title: "Test Video"}}
+
+	require.NoError(t, service.migrateLegacyFile(context.Background(), url, opts))
+
+	urlHash := service.GetURLHash(url, opts)
+	assert.NotContains(t, index, legacyHash)
+	require.Contains(t, index, urlHash)
+	assert.Equal(t, filepath.Join(dir, "Test Video_"+urlHash+".mp4"), index[urlHash].FilePath)
+	assert.Equal(t, "dQw4w9WgXcQ", index[urlHash].VideoKey)
+	assert.Equal(t, "Test Video", index[urlHash].Metadata.Title)
+}
+
+func TestSetPinned(t *testing.T) {
+	index := memoryIndex{"0123456789abcdef": {URLHash: "0123456789abcdef", FilePath: "/downloads/Test Video_0123456789abcdef.mp4"}}
+	service := &YouTubeService{config: &config.Config{}, index: index}
+
+	entry, err := service.SetPinned(context.Background(), "0123456789abcdef", true)
+	require.NoError(t, err)
+	assert.Equal(t, "/downloads/Test Video_0123456789abcdef.mp4", entry.FilePath)
+	assert.True(t, index["0123456789abcdef"].Pinned)
+
+	_, err = service.SetPinned(context.Background(), "0123456789abcdef", false)
+	require.NoError(t, err)
+	assert.False(t, index["0123456789abcdef"].Pinned)
+
+	_, err = service.SetPinned(context.Background(), "fedcba9876543210", true)
+	assert.ErrorIs(t, err, ErrFileNotIndexed)
+}
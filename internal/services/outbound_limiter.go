@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/rediskeys"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrUpstreamRateLimited is returned when a site rejects a download for sending too many requests
+var ErrUpstreamRateLimited = errors.New("rate limited by the video site")
+
+// outboundSlotRetryInterval is how long a download held back because every slot is taken waits
+// before it is tried again
+const outboundSlotRetryInterval = 10 * time.Second
+
+// OutboundWaitError is returned when the outbound limits don't let a download start yet. The
+// download should be tried again after RetryAfter, without holding anything in the meantime.
+type OutboundWaitError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *OutboundWaitError) Error() string {
+	return fmt.Sprintf("%s, retrying in %s", e.Reason, e.RetryAfter.Round(time.Second))
+}
+
+// pauseDownloadsScript pauses downloads after a site rejected one. The pause doubles, up to
+// ARGV[2] milliseconds, with every rejection coming less than ARGV[2] after the last pause ended,
+// starting from ARGV[1]. Rejections while downloads are already paused don't extend the pause,
+// since they come from downloads started before it. It returns the pause in milliseconds.
+var pauseDownloadsScript = redis.NewScript(`
+local paused = redis.call("PTTL", KEYS[1])
+if paused > 0 then
+	return paused
+end
+local base = tonumber(ARGV[1])
+local max = tonumber(ARGV[2])
+local backoff = tonumber(redis.call("GET", KEYS[2]) or "0")
+if backoff > 0 then
+	backoff = math.min(backoff * 2, max)
+else
+	backoff = base
+end
+redis.call("SET", KEYS[1], "1", "PX", backoff)
+redis.call("SET", KEYS[2], backoff, "PX", backoff + max)
+return backoff
+`)
+
+// OutboundLimiter implements OutboundLimiterInterface in Redis, so every worker shares the same
+// limits on the downloads they start
+type OutboundLimiter struct {
+	config  *config.Config
+	redis   *redis.Client
+	limiter RateLimiterInterface
+}
+
+// NewOutboundLimiter creates a new OutboundLimiter instance. Downloads started per minute are
+// counted with limiter.
+func NewOutboundLimiter(config *config.Config, redis *redis.Client, limiter RateLimiterInterface) OutboundLimiterInterface {
+	return &OutboundLimiter{
+		config:  config,
+		redis:   redis,
+		limiter: limiter,
+	}
+}
+
+// Acquire starts a download if the outbound limits let it: downloads aren't paused, one of the
+// OutboundConcurrency slots is free and fewer than DownloadsPerMinute were started in the last
+// minute. It returns the bandwidth the download may take, in bytes per second or 0 for no limit,
+// and a function to call once the download is done, which frees its slot. Otherwise it returns
+// an *OutboundWaitError right away, so the download doesn't hold a worker while it waits.
+func (l *OutboundLimiter) Acquire(ctx context.Context) (int64, func(), error) {
+	paused, err := l.PausedFor(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	if paused > 0 {
+		return 0, nil, &OutboundWaitError{Reason: "downloads are paused after a site rejected too many requests", RetryAfter: paused}
+	}
+
+	release, err := l.acquireSlot(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	if release == nil {
+		reason := fmt.Sprintf("all %d outbound download slots are taken", l.config.OutboundConcurrency)
+		return 0, nil, &OutboundWaitError{Reason: reason, RetryAfter: outboundSlotRetryInterval}
+	}
+
+	if l.config.DownloadsPerMinute > 0 {
+		limit := config.RateLimit{Requests: l.config.DownloadsPerMinute, Window: time.Minute}
+		result, err := l.limiter.Allow(ctx, "outbound", "downloads", limit)
+		if err != nil {
+			release()
+			return 0, nil, err
+		}
+		if result.RetryAfter > 0 {
+			release()
+			return 0, nil, &OutboundWaitError{Reason: "too many downloads were started in the last minute", RetryAfter: result.RetryAfter}
+		}
+	}
+
+	return bandwidthShare(l.config.OutboundBandwidth, l.config.OutboundConcurrency), release, nil
+}
+
+// acquireSlot takes one of the OutboundConcurrency slots and holds it until the returned release
+// function is first called. It returns a nil function if every slot is taken.
+func (l *OutboundLimiter) acquireSlot(ctx context.Context) (func(), error) {
+	if l.config.OutboundConcurrency <= 0 {
+		return func() {}, nil
+	}
+
+	key := rediskeys.GetOutboundDownloadsKey()
+	ttl := l.config.OutboundLeaseTTL
+	leaseID := uuid.NewString()
+	acquired, err := addLimitedLease(ctx, l.redis, key, leaseID, ttl, l.config.OutboundConcurrency)
+	if err != nil || !acquired {
+		return nil, err
+	}
+	return keepLease(ctx, l.redis, key, leaseID, ttl), nil
+}
+
+// ReportRateLimited pauses downloads after a site rejected one for sending too many requests,
+// and returns how long they are paused
+func (l *OutboundLimiter) ReportRateLimited(ctx context.Context) (time.Duration, error) {
+	keys := []string{rediskeys.GetOutboundPauseKey(), rediskeys.GetOutboundBackoffKey()}
+	pause, err := pauseDownloadsScript.Run(ctx, l.redis, keys, l.config.OutboundBackoff.Milliseconds(), l.config.OutboundMaxBackoff.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to pause downloads: %v", err)
+	}
+	return time.Duration(pause) * time.Millisecond, nil
+}
+
+// PausedFor returns how long downloads remain paused, 0 if they aren't
+func (l *OutboundLimiter) PausedFor(ctx context.Context) (time.Duration, error) {
+	pause, err := l.redis.PTTL(ctx, rediskeys.GetOutboundPauseKey()).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check download pause: %v", err)
+	}
+	return max(pause, 0), nil
+}
+
+// bandwidthShare returns the bandwidth of each running download, a fixed share of bandwidth per
+// slot so the downloads together never go over it, or 0 for no limit
+func bandwidthShare(bandwidth int64, concurrency int) int64 {
+	if bandwidth <= 0 {
+		return 0
+	}
+	return max(bandwidth/int64(max(concurrency, 1)), 1)
+}
+
+// isTooManyRequests reports whether a yt-dlp error says the site rejected it for sending too
+// many requests
+func isTooManyRequests(line string) bool {
+	line = strings.ToLower(line)
+	return strings.Contains(line, "http error 429") ||
+		strings.Contains(line, "too many requests") ||
+		strings.Contains(line, "rate-limited")
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"spiropoulos94/youtube-downloader/internal/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTooManyRequests(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{line: "ERROR: [youtube] dQw4w9WgXcQ: Unable to download webpage: HTTP Error 429: Too Many Requests", want: true},
+		{line: "ERROR: unable to download video data: HTTP Error 429", want: true},
+		{line: "ERROR: [youtube] dQw4w9WgXcQ: The current session has been rate-limited by YouTube for up to an hour.", want: true},
+		{line: "ERROR: [youtube] dQw4w9WgXcQ: Video unavailable", want: false},
+		{line: "ERROR: unable to download video data: HTTP Error 403: Forbidden", want: false},
+		{line: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			assert.Equal(t, tt.want, isTooManyRequests(tt.line))
+		})
+	}
+}
+
+func TestBandwidthShare(t *testing.T) {
+	assert.Equal(t, int64(0), bandwidthShare(0, 4))
+	assert.Equal(t, int64(250), bandwidthShare(1000, 4))
+	assert.Equal(t, int64(1000), bandwidthShare(1000, 0))
+	assert.Equal(t, int64(1), bandwidthShare(3, 4))
+}
+
+func TestOutboundArgs(t *testing.T) {
+	service := &YouTubeService{config: &config.Config{}}
+	assert.Empty(t, service.outboundArgs(0))
+	assert.Equal(t, []string{"--limit-rate", "1048576"}, service.outboundArgs(1<<20))
+
+	service.config = &config.Config{SleepInterval: 1500 * time.Millisecond, SleepRequests: time.Second}
+	assert.Equal(t, []string{
+		"--sleep-interval", "1.5",
+		"--max-sleep-interval", "3",
+		"--sleep-requests", "1",
+	}, service.outboundArgs(0))
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PlaylistInfo is the flat listing of a playlist: its title and the videos it contains
+type PlaylistInfo struct {
+	ID      string          `json:"id"`
+	Title   string          `json:"title"`
+	Entries []PlaylistEntry `json:"entries"`
+}
+
+// PlaylistEntry is a single video of a playlist.
+// Duration and UploadedAt are zero when the listing doesn't include them.
+type PlaylistEntry struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Title      string    `json:"title"`
+	Duration   float64   `json:"duration,omitempty"` // Seconds
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// ListPlaylist lists the videos of a playlist without downloading them.
+// At most maxItems entries are returned, all of them if maxItems is zero.
+func (s *YouTubeService) ListPlaylist(ctx context.Context, url string, maxItems int) (*PlaylistInfo, error) {
+	args := []string{
+		"--flat-playlist",    // Only list the entries, don't resolve every video
+		"--dump-single-json", // Print the whole playlist as one JSON object
+		"--yes-playlist",     // Expand the playlist even if the URL also names a video
+		"--quiet",            // Only print the JSON
+		// Flat channel listings only have relative upload dates ("3 days ago"), ask for their approximation
+		"--extractor-args", "youtubetab:approximate_date",
+	}
+	if maxItems > 0 {
+		args = append(args, "--playlist-end", strconv.Itoa(maxItems))
+	}
+	args = append(args, url)
+
+	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	configureProcessGroup(cmd)
+
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("failed to list playlist: %v: %s", err, lastLine(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("failed to list playlist: %v", err)
+	}
+
+	return parsePlaylist(output)
+}
+
+// parsePlaylist extracts the playlist entries from yt-dlp's flat playlist JSON
+func parsePlaylist(output []byte) (*PlaylistInfo, error) {
+	var data struct {
+		ID           string `json:"id"`
+		Title        string `json:"title"`
+		ExtractorKey string `json:"extractor_key"`
+		Entries      []struct {
+			ID         string  `json:"id"`
+			URL        string  `json:"url"`
+			WebpageURL string  `json:"webpage_url"`
+			IEKey      string  `json:"ie_key"` // Extractor of the entry, e.g. "Youtube"
+			Title      string  `json:"title"`
+			Duration   float64 `json:"duration"`
+			Timestamp  int64   `json:"timestamp"`
+			UploadDate string  `json:"upload_date"` // YYYYMMDD
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(output, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse playlist: %v", err)
+	}
+
+	playlist := &PlaylistInfo{ID: data.ID, Title: data.Title}
+	for _, entry := range data.Entries {
+		if entry.ID == "" {
+			continue
+		}
+		url := entryURL(entry.WebpageURL, entry.URL)
+		if url == "" {
+			// Flat YouTube entries don't always carry a full URL, so build a canonical watch URL from the ID
+			extractor := entry.IEKey
+			if extractor == "" {
+				extractor = data.ExtractorKey
+			}
+			if !strings.HasPrefix(extractor, "Youtube") {
+				continue
+			}
+			url = "https://www.youtube.com/watch?v=" + entry.ID
+		}
+		playlistEntry := PlaylistEntry{
+			ID:       entry.ID,
+			URL:      url,
+			Title:    entry.Title,
+			Duration: entry.Duration,
+		}
+		if entry.Timestamp > 0 {
+			playlistEntry.UploadedAt = time.Unix(entry.Timestamp, 0).UTC()
+		} else if uploadDate, err := time.Parse("20060102", entry.UploadDate); err == nil {
+			playlistEntry.UploadedAt = uploadDate
+		}
+		playlist.Entries = append(playlist.Entries, playlistEntry)
+	}
+
+	if len(playlist.Entries) == 0 {
+		return nil, fmt.Errorf("playlist has no videos")
+	}
+	return playlist, nil
+}
+
+// entryURL returns the first of the given URLs that is absolute, or "" if none is
+func entryURL(candidates ...string) string {
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, "https://") || strings.HasPrefix(candidate, "http://") {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// lastLine returns the last non-empty line of a command's output
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
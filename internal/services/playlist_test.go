@@ -0,0 +1,66 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePlaylist(t *testing.T) {
+	output := []byte(`{
+		"_type": "playlist",
+		"id": "PL123",
+		"title": "My Playlist",
+		"extractor_key": "YoutubeTab",
+		"entries": [
+			{"_type": "url", "id": "dQw4w9WgXcQ", "url": "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "title": "First"},
+			{"_type": "url", "id": "", "title": "Broken entry"},
+			{"_type": "url", "id": "9bZkp7q19f0", "title": "Second", "duration": 252, "timestamp": 1700000000},
+			{"_type": "url", "id": "kJQP7kiw5Fk", "title": "Third", "upload_date": "20240131"},
+			{"_type": "url", "id": "76979871", "ie_key": "Vimeo", "url": "https://vimeo.com/76979871", "title": "Elsewhere"},
+			{"_type": "url", "id": "12345", "ie_key": "Vimeo", "url": "12345", "title": "Relative URL"}
+		]
+	}`)
+
+	playlist, err := parsePlaylist(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "PL123", playlist.ID)
+	assert.Equal(t, "My Playlist", playlist.Title)
+	assert.Equal(t, []PlaylistEntry{
+		{ID: "dQw4w9WgXcQ", URL: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", Title: "First"},
+		{ID: "9bZkp7q19f0", URL: "https://www.youtube.com/watch?v=9bZkp7q19f0", Title: "Second", Duration: 252, UploadedAt: time.Unix(1700000000, 0).UTC()},
+		{ID: "kJQP7kiw5Fk", URL: "https://www.youtube.com/watch?v=kJQP7kiw5Fk", Title: "Third", UploadedAt: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{ID: "76979871", URL: "https://vimeo.com/76979871", Title: "Elsewhere"},
+	}, playlist.Entries)
+}
+
+func TestParsePlaylistErrors(t *testing.T) {
+	_, err := parsePlaylist([]byte(`not json`))
+	assert.Error(t, err)
+
+	_, err = parsePlaylist([]byte(`{"id": "PL123", "entries": []}`))
+	assert.EqualError(t, err, "playlist has no videos")
+}
+
+func TestParsePlaylistOtherSites(t *testing.T) {
+	output := []byte(`{
+		"id": "album",
+		"extractor_key": "Bandcamp",
+		"entries": [
+			{"id": "1", "url": "track-1", "webpage_url": "https://artist.bandcamp.com/track/one", "title": "One"},
+			{"id": "2", "url": "track-2", "title": "Two"}
+		]
+	}`)
+
+	playlist, err := parsePlaylist(output)
+	assert.NoError(t, err)
+	assert.Equal(t, []PlaylistEntry{
+		{ID: "1", URL: "https://artist.bandcamp.com/track/one", Title: "One"},
+	}, playlist.Entries)
+}
+
+func TestLastLine(t *testing.T) {
+	assert.Equal(t, "ERROR: playlist does not exist", lastLine([]byte("WARNING: something\nERROR: playlist does not exist\n")))
+	assert.Equal(t, "", lastLine(nil))
+}
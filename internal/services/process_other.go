@@ -0,0 +1,9 @@
+//go:build !unix
+
+package services
+
+import "os/exec"
+
+// configureProcessGroup is a no-op on platforms without process groups,
+// where cancelling the context only kills yt-dlp itself
+func configureProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Download phases reported in Progress.Phase
+const (
+	PhaseDownloading    = "downloading"
+	PhaseMerging        = "merging"
+	PhasePostProcessing = "post_processing"
+)
+
+// progressPrefix marks the lines printed by our yt-dlp progress templates
+const progressPrefix = "ytdl-progress|"
+
+// progressTemplateArgs make yt-dlp print machine readable progress lines, one per update.
+// Missing values are printed as "NA" by yt-dlp.
+var progressTemplateArgs = []string{
+	"--progress", // Report progress even though --quiet is set
+	"--newline",  // One line per update instead of redrawing the same line
+	"--progress-template", "download:" + progressPrefix + "download|%(progress.status)s|%(progress.downloaded_bytes)s|%(progress.total_bytes)s|%(progress.total_bytes_estimate)s|%(progress.speed)s|%(progress.eta)s",
+	"--progress-template", "postprocess:" + progressPrefix + "postprocess|%(progress.status)s|%(progress.postprocessor)s",
+}
+
+// Progress is a snapshot of a running download
+type Progress struct {
+	Phase           string  `json:"phase"`
+	Percent         float64 `json:"percent"`
+	DownloadedBytes int64   `json:"downloaded_bytes"`
+	TotalBytes      int64   `json:"total_bytes"`
+	Speed           float64 `json:"speed"` // Bytes per second
+	ETA             int64   `json:"eta"`   // Seconds
+}
+
+// ProgressFunc receives progress updates while a download runs
+type ProgressFunc func(Progress)
+
+// parseProgressLine parses a line printed by progressTemplateArgs.
+// It returns false if the line is not a progress line.
+func parseProgressLine(line string) (Progress, bool) {
+	if !strings.HasPrefix(line, progressPrefix) {
+		return Progress{}, false
+	}
+	fields := strings.Split(strings.TrimPrefix(line, progressPrefix), "|")
+
+	switch fields[0] {
+	case "download":
+		if len(fields) != 7 {
+			return Progress{}, false
+		}
+		progress := Progress{
+			Phase:           PhaseDownloading,
+			DownloadedBytes: int64(parseProgressNumber(fields[2])),
+			TotalBytes:      int64(parseProgressNumber(fields[3])),
+			Speed:           parseProgressNumber(fields[5]),
+			ETA:             int64(parseProgressNumber(fields[6])),
+		}
+		// Fragmented downloads only know an estimate of their size
+		if progress.TotalBytes == 0 {
+			progress.TotalBytes = int64(parseProgressNumber(fields[4]))
+		}
+		if fields[1] == "finished" {
+			progress.Percent = 100
+			progress.ETA = 0
+		} else if progress.TotalBytes > 0 {
+			progress.Percent = float64(progress.DownloadedBytes) / float64(progress.TotalBytes) * 100
+		}
+		return progress, true
+
+	case "postprocess":
+		if len(fields) != 3 {
+			return Progress{}, false
+		}
+		phase := PhasePostProcessing
+		if fields[2] == "Merger" {
+			phase = PhaseMerging
+		}
+		return Progress{Phase: phase, Percent: 100}, true
+	}
+
+	return Progress{}, false
+}
+
+// parseProgressNumber parses a numeric progress field, treating "NA" and garbage as zero
+func parseProgressNumber(value string) float64 {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// scanOutput reads yt-dlp output line by line, forwarding progress lines to onProgress
+// and every other non-empty line to onLine. Either callback may be nil.
+func scanOutput(r io.Reader, onProgress ProgressFunc, onLine func(string)) error {
+	// A bufio.Reader is used instead of a Scanner because --dump-json lines can be several MB long
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			if progress, ok := parseProgressLine(line); ok {
+				if onProgress != nil {
+					onProgress(progress)
+				}
+			} else if onLine != nil {
+				onLine(line)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
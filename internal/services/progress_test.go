@@ -0,0 +1,106 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test parseProgressLine
+func TestParseProgressLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected Progress
+		ok       bool
+	}{
+		{
+			name: "Download in progress",
+			line: "ytdl-progress|download|downloading|5242880|20971520|NA|1048576.5|15",
+			expected: Progress{
+				Phase:           PhaseDownloading,
+				Percent:         25,
+				DownloadedBytes: 5242880,
+				TotalBytes:      20971520,
+				Speed:           1048576.5,
+				ETA:             15,
+			},
+			ok: true,
+		},
+		{
+			name: "Fragmented download with estimated size",
+			line: "ytdl-progress|download|downloading|1000|NA|4000.0|NA|NA",
+			expected: Progress{
+				Phase:           PhaseDownloading,
+				Percent:         25,
+				DownloadedBytes: 1000,
+				TotalBytes:      4000,
+			},
+			ok: true,
+		},
+		{
+			name: "Download finished",
+			line: "ytdl-progress|download|finished|20971520|20971520|NA|NA|NA",
+			expected: Progress{
+				Phase:           PhaseDownloading,
+				Percent:         100,
+				DownloadedBytes: 20971520,
+				TotalBytes:      20971520,
+			},
+			ok: true,
+		},
+		{
+			name:     "Merging formats",
+			line:     "ytdl-progress|postprocess|started|Merger",
+			expected: Progress{Phase: PhaseMerging, Percent: 100},
+			ok:       true,
+		},
+		{
+			name:     "Extracting audio",
+			line:     "ytdl-progress|postprocess|started|ExtractAudio",
+			expected: Progress{Phase: PhasePostProcessing, Percent: 100},
+			ok:       true,
+		},
+		{
+			name: "Regular output line",
+			line: "[youtube] dQw4w9WgXcQ: Downloading webpage",
+			ok:   false,
+		},
+		{
+			name: "Truncated progress line",
+			line: "ytdl-progress|download|downloading|1000",
+			ok:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress, ok := parseProgressLine(tt.line)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, progress)
+		})
+	}
+}
+
+// Test scanOutput
+func TestScanOutput(t *testing.T) {
+	output := strings.Join([]string{
+		`{"title": "Test Video"}`,
+		"ytdl-progress|download|downloading|50|100|NA|10|5",
+		"",
+		"ERROR: something went wrong",
+	}, "\n")
+
+	var progresses []Progress
+	var lines []string
+	err := scanOutput(strings.NewReader(output),
+		func(p Progress) { progresses = append(progresses, p) },
+		func(line string) { lines = append(lines, line) },
+	)
+
+	assert.NoError(t, err)
+	assert.Len(t, progresses, 1)
+	assert.Equal(t, float64(50), progresses[0].Percent)
+	assert.Equal(t, []string{`{"title": "Test Video"}`, "ERROR: something went wrong"}, lines)
+}
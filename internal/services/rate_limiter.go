@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/rediskeys"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitResult is the outcome of a request counted against a rate limit
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int           // Requests allowed per window
+	Remaining  int           // Requests the client can still burst right away
+	ResetAfter time.Duration // Time until the client can burst the full limit again
+	RetryAfter time.Duration // Time until the next request is allowed, 0 if this one was
+}
+
+// rateLimitScript is a token bucket using the generic cell rate algorithm: the key holds the
+// theoretical arrival time (TAT) of the client's next request, in milliseconds, and a request is
+// allowed unless the TAT is more than a window ahead. Time is read from Redis, so every replica of
+// the server agrees on it. It returns whether the request is allowed, the remaining requests, the
+// reset time and the retry time in milliseconds.
+var rateLimitScript = redis.NewScript(`
+redis.replicate_commands()
+local interval = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local tat = math.max(tonumber(redis.call("GET", KEYS[1]) or "0"), now)
+local newTat = tat + interval
+local allowAt = newTat - window
+if allowAt > now then
+	return {0, 0, math.ceil(tat - now), math.ceil(allowAt - now)}
+end
+redis.call("SET", KEYS[1], newTat, "PX", math.ceil(newTat - now))
+return {1, math.floor((now - allowAt) / interval), math.ceil(newTat - now), 0}
+`)
+
+// RateLimiter implements RateLimiterInterface with Redis, so limits hold across server replicas
+type RateLimiter struct {
+	redis *redis.Client
+}
+
+// NewRateLimiter creates a new RateLimiter instance
+func NewRateLimiter(redis *redis.Client) RateLimiterInterface {
+	return &RateLimiter{
+		redis: redis,
+	}
+}
+
+// Allow counts a request of a client against the limit of a route group. Clients get the limit's
+// requests back evenly over its window, and can burst up to all of them at once.
+func (l *RateLimiter) Allow(ctx context.Context, route string, client string, limit config.RateLimit) (*RateLimitResult, error) {
+	window := float64(limit.Window.Milliseconds())
+	interval := window / float64(limit.Requests)
+	values, err := rateLimitScript.Run(ctx, l.redis, []string{rediskeys.GetRateLimitKey(route, client)}, interval, window).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check rate limit: %v", err)
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("failed to check rate limit: unexpected result %v", values)
+	}
+
+	return &RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      limit.Requests,
+		Remaining:  int(values[1]),
+		ResetAfter: time.Duration(values[2]) * time.Millisecond,
+		RetryAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
@@ -1,7 +1,15 @@
 package services
 
 type Services struct {
-	YouTube  YouTubeServiceInterface
-	Cleanup  CleanupServiceInterface
-	Frontend FrontendServiceInterface
+	YouTube      YouTubeServiceInterface
+	Cleanup      CleanupServiceInterface
+	Frontend     FrontendServiceInterface
+	Task         TaskServiceInterface
+	Subscription SubscriptionServiceInterface
+	MediaIndex   MediaIndexInterface
+	FileLeases   FileLeasesInterface
+	Share        ShareServiceInterface
+	APIKey       APIKeyServiceInterface
+	RateLimiter  RateLimiterInterface
+	Outbound     OutboundLimiterInterface
 }
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"spiropoulos94/youtube-downloader/internal/rediskeys"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrShareNotFound is returned when a share link doesn't exist or was revoked
+var ErrShareNotFound = errors.New("share link not found")
+
+// ShareLink gives access to a task's file through an opaque token instead of its task ID
+type ShareLink struct {
+	Token        string     `json:"token"`
+	TaskID       string     `json:"task_id"`
+	PasswordHash string     `json:"password_hash,omitempty"` // bcrypt hash, empty for links without a password
+	MaxDownloads int        `json:"max_downloads,omitempty"` // Zero for unlimited downloads
+	Downloads    int        `json:"downloads"`               // Read from its own counter, never saved with the link
+	APIKeyID     string     `json:"api_key_id,omitempty"`    // API key that created the link, whose byte quota its downloads count against
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// HasPassword reports whether downloading through the link requires a password
+func (l *ShareLink) HasPassword() bool {
+	return l.PasswordHash != ""
+}
+
+// CheckPassword reports whether a password unlocks the link
+func (l *ShareLink) CheckPassword(password string) bool {
+	if !l.HasPassword() {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(l.PasswordHash), []byte(password)) == nil
+}
+
+// Expired reports whether the link's expiry has passed
+func (l *ShareLink) Expired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// Exhausted reports whether the link's downloads are used up
+func (l *ShareLink) Exhausted() bool {
+	return l.MaxDownloads > 0 && l.Downloads >= l.MaxDownloads
+}
+
+// claimDownloadScript counts a download of a share link unless its limit is reached, returning 1
+// if the download is allowed. The counter expires along with the link.
+var claimDownloadScript = redis.NewScript(`
+local count = tonumber(redis.call("GET", KEYS[1]) or "0")
+local max = tonumber(ARGV[1])
+if max > 0 and count >= max then
+	return 0
+end
+redis.call("INCR", KEYS[1])
+local ttl = redis.call("PTTL", KEYS[2])
+if ttl > 0 then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return 1
+`)
+
+// ShareService implements ShareServiceInterface
+type ShareService struct {
+	redis *redis.Client
+}
+
+// NewShareService creates a new ShareService instance
+func NewShareService(redis *redis.Client) ShareServiceInterface {
+	return &ShareService{
+		redis: redis,
+	}
+}
+
+// CreateShare stores a new share link, assigning its token and creation time. An empty password
+// creates a link without one. Links are kept for maxTTL, which must not be shorter than their expiry,
+// so expired links can still be told apart from unknown ones.
+func (s *ShareService) CreateShare(ctx context.Context, link *ShareLink, password string, maxTTL time.Duration) error {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return fmt.Errorf("failed to generate share token: %v", err)
+	}
+	link.Token = base64.RawURLEncoding.EncodeToString(token)
+	link.CreatedAt = time.Now().UTC()
+	link.Downloads = 0
+
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("failed to hash share password: %v", err)
+		}
+		link.PasswordHash = string(hash)
+	}
+
+	data, err := json.Marshal(link)
+	if err != nil {
+		return fmt.Errorf("failed to marshal share link: %v", err)
+	}
+
+	// Every link is kept for maxTTL, so the task's set of links outlives the links in it
+	sharesKey := rediskeys.GetTaskSharesKey(link.TaskID)
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, rediskeys.GetShareKey(link.Token), data, maxTTL)
+	pipe.SAdd(ctx, sharesKey, link.Token)
+	pipe.Expire(ctx, sharesKey, maxTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to create share link: %v", err)
+	}
+	return nil
+}
+
+// GetShare returns a share link along with its download count, or ErrShareNotFound
+func (s *ShareService) GetShare(ctx context.Context, token string) (*ShareLink, error) {
+	data, err := s.redis.Get(ctx, rediskeys.GetShareKey(token)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share link: %v", err)
+	}
+
+	var link ShareLink
+	if err := json.Unmarshal(data, &link); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal share link: %v", err)
+	}
+
+	downloads, err := s.redis.Get(ctx, rediskeys.GetShareDownloadsKey(token)).Int()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get share downloads: %v", err)
+	}
+	link.Downloads = downloads
+
+	return &link, nil
+}
+
+// ListShares returns the share links of a task, including expired and exhausted ones
+func (s *ShareService) ListShares(ctx context.Context, taskID string) ([]*ShareLink, error) {
+	tokens, err := s.redis.SMembers(ctx, rediskeys.GetTaskSharesKey(taskID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list share links: %v", err)
+	}
+
+	links := make([]*ShareLink, 0, len(tokens))
+	for _, token := range tokens {
+		link, err := s.GetShare(ctx, token)
+		if err == ErrShareNotFound {
+			// Its record expired, forget it
+			s.redis.SRem(ctx, rediskeys.GetTaskSharesKey(taskID), token)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// RevokeShare deletes a share link of a task, or returns ErrShareNotFound if the task has no such link
+func (s *ShareService) RevokeShare(ctx context.Context, taskID string, token string) error {
+	link, err := s.GetShare(ctx, token)
+	if err != nil {
+		return err
+	}
+	if link.TaskID != taskID {
+		return ErrShareNotFound
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, rediskeys.GetShareKey(token), rediskeys.GetShareDownloadsKey(token))
+	pipe.SRem(ctx, rediskeys.GetTaskSharesKey(taskID), token)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke share link: %v", err)
+	}
+	return nil
+}
+
+// ClaimDownload counts a download of a share link. It returns false, counting nothing, once the
+// link's downloads are used up.
+func (s *ShareService) ClaimDownload(ctx context.Context, link *ShareLink) (bool, error) {
+	keys := []string{rediskeys.GetShareDownloadsKey(link.Token), rediskeys.GetShareKey(link.Token)}
+	claimed, err := claimDownloadScript.Run(ctx, s.redis, keys, link.MaxDownloads).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to count share download: %v", err)
+	}
+	return claimed == 1, nil
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestShareLinkPassword(t *testing.T) {
+	assert.True(t, (&ShareLink{}).CheckPassword(""))
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	link := &ShareLink{PasswordHash: string(hash)}
+	assert.True(t, link.HasPassword())
+	assert.True(t, link.CheckPassword("secret"))
+	assert.False(t, link.CheckPassword("wrong"))
+	assert.False(t, link.CheckPassword(""))
+}
+
+func TestShareLinkLimits(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	assert.False(t, (&ShareLink{}).Expired(now))
+	assert.False(t, (&ShareLink{ExpiresAt: &future}).Expired(now))
+	assert.True(t, (&ShareLink{ExpiresAt: &past}).Expired(now))
+
+	assert.False(t, (&ShareLink{Downloads: 100}).Exhausted())
+	assert.False(t, (&ShareLink{MaxDownloads: 2, Downloads: 1}).Exhausted())
+	assert.True(t, (&ShareLink{MaxDownloads: 2, Downloads: 2}).Exhausted())
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"spiropoulos94/youtube-downloader/internal/rediskeys"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrSubscriptionNotFound is returned when a subscription ID doesn't exist
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+// Subscription is a channel or playlist whose new uploads are downloaded automatically
+type Subscription struct {
+	ID        string              `json:"id"`
+	URL       string              `json:"url"`
+	Options   DownloadOptions     `json:"options"`
+	Filters   SubscriptionFilters `json:"filters"`
+	CreatedAt time.Time           `json:"created_at"`
+	APIKeyID  string              `json:"api_key_id,omitempty"` // API key that created the subscription, recorded on its download tasks
+	LastSync  *SubscriptionSync   `json:"last_sync,omitempty"`  // Read from its own key, never saved with the subscription
+}
+
+// SubscriptionSync is the result of a subscription's latest check for new uploads
+type SubscriptionSync struct {
+	At      time.Time `json:"at"`
+	TaskIDs []string  `json:"task_ids,omitempty"` // Download tasks enqueued for new uploads
+	Skipped []string  `json:"skipped,omitempty"`  // URLs of new uploads not downloaded because the API key used up its quota
+	Error   string    `json:"error,omitempty"`
+}
+
+// SubscriptionFilters select which new uploads of a subscription are downloaded.
+// Durations use Go's format, e.g. "168h" or "20m". Empty filters match everything.
+type SubscriptionFilters struct {
+	MaxAge      string `json:"max_age,omitempty"`      // Skip uploads older than this
+	TitleRegex  string `json:"title_regex,omitempty"`  // Only download uploads whose title matches
+	MaxDuration string `json:"max_duration,omitempty"` // Skip videos longer than this
+}
+
+// Validate checks that the filters can be compiled
+func (f SubscriptionFilters) Validate() error {
+	_, err := f.Matcher()
+	return err
+}
+
+// Matcher compiles the filters into a function reporting whether a playlist entry should be downloaded.
+// Entries whose upload date or duration is unknown are not filtered on it.
+func (f SubscriptionFilters) Matcher() (func(entry PlaylistEntry, now time.Time) bool, error) {
+	var maxAge, maxDuration time.Duration
+	var titleRegex *regexp.Regexp
+	var err error
+
+	if f.MaxAge != "" {
+		if maxAge, err = time.ParseDuration(f.MaxAge); err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("invalid max_age %q: use a positive duration like \"168h\"", f.MaxAge)
+		}
+	}
+	if f.MaxDuration != "" {
+		if maxDuration, err = time.ParseDuration(f.MaxDuration); err != nil || maxDuration <= 0 {
+			return nil, fmt.Errorf("invalid max_duration %q: use a positive duration like \"20m\"", f.MaxDuration)
+		}
+	}
+	if f.TitleRegex != "" {
+		if titleRegex, err = regexp.Compile(f.TitleRegex); err != nil {
+			return nil, fmt.Errorf("invalid title_regex: %v", err)
+		}
+	}
+
+	return func(entry PlaylistEntry, now time.Time) bool {
+		if maxAge > 0 && !entry.UploadedAt.IsZero() && now.Sub(entry.UploadedAt) > maxAge {
+			return false
+		}
+		if maxDuration > 0 && entry.Duration > maxDuration.Seconds() {
+			return false
+		}
+		if titleRegex != nil && !titleRegex.MatchString(entry.Title) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// SubscriptionService implements SubscriptionServiceInterface
+type SubscriptionService struct {
+	redis *redis.Client
+}
+
+// NewSubscriptionService creates a new SubscriptionService instance
+func NewSubscriptionService(redis *redis.Client) SubscriptionServiceInterface {
+	return &SubscriptionService{
+		redis: redis,
+	}
+}
+
+// CreateSubscription stores a new subscription, assigning its ID and creation time
+func (s *SubscriptionService) CreateSubscription(ctx context.Context, subscription *Subscription) error {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Errorf("failed to generate subscription ID: %v", err)
+	}
+	subscription.ID = hex.EncodeToString(id)
+	subscription.CreatedAt = time.Now().UTC()
+
+	data, err := marshalSubscription(subscription)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, rediskeys.GetSubscriptionKey(subscription.ID), data, 0)
+	pipe.SAdd(ctx, rediskeys.GetSubscriptionsKey(), subscription.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to create subscription: %v", err)
+	}
+	return nil
+}
+
+// GetSubscription returns a subscription along with its last sync, or ErrSubscriptionNotFound
+func (s *SubscriptionService) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	data, err := s.redis.Get(ctx, rediskeys.GetSubscriptionKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %v", err)
+	}
+
+	var subscription Subscription
+	if err := json.Unmarshal(data, &subscription); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal subscription: %v", err)
+	}
+
+	syncData, err := s.redis.Get(ctx, rediskeys.GetSubscriptionSyncKey(id)).Bytes()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get subscription sync: %v", err)
+	}
+	if err == nil {
+		var sync SubscriptionSync
+		if err := json.Unmarshal(syncData, &sync); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal subscription sync: %v", err)
+		}
+		subscription.LastSync = &sync
+	}
+
+	return &subscription, nil
+}
+
+// ListSubscriptions returns every subscription
+func (s *SubscriptionService) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	ids, err := s.redis.SMembers(ctx, rediskeys.GetSubscriptionsKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %v", err)
+	}
+
+	subscriptions := make([]*Subscription, 0, len(ids))
+	for _, id := range ids {
+		subscription, err := s.GetSubscription(ctx, id)
+		if err == ErrSubscriptionNotFound {
+			continue // Deleted while listing
+		}
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, nil
+}
+
+// UpdateSubscription replaces the definition of an existing subscription
+func (s *SubscriptionService) UpdateSubscription(ctx context.Context, subscription *Subscription) error {
+	data, err := marshalSubscription(subscription)
+	if err != nil {
+		return err
+	}
+
+	// Only overwrite subscriptions that still exist
+	ok, err := s.redis.SetXX(ctx, rediskeys.GetSubscriptionKey(subscription.ID), data, redis.KeepTTL).Result()
+	if err != nil {
+		return fmt.Errorf("failed to update subscription: %v", err)
+	}
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// DeleteSubscription removes a subscription along with its sync state and download archive
+func (s *SubscriptionService) DeleteSubscription(ctx context.Context, id string) error {
+	pipe := s.redis.TxPipeline()
+	removed := pipe.SRem(ctx, rediskeys.GetSubscriptionsKey(), id)
+	pipe.Del(ctx, rediskeys.GetSubscriptionKey(id), rediskeys.GetSubscriptionSyncKey(id), rediskeys.GetSubscriptionArchiveKey(id))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete subscription: %v", err)
+	}
+	if removed.Val() == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// SaveSubscriptionSync records the result of a subscription's latest sync
+func (s *SubscriptionService) SaveSubscriptionSync(ctx context.Context, id string, sync *SubscriptionSync) error {
+	data, err := json.Marshal(sync)
+	if err != nil {
+		return fmt.Errorf("failed to marshal subscription sync: %v", err)
+	}
+	if err := s.redis.Set(ctx, rediskeys.GetSubscriptionSyncKey(id), data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save subscription sync: %v", err)
+	}
+	return nil
+}
+
+// ArchiveVideo adds a video to the subscription's download archive.
+// It returns false if the video was already archived, meaning it must not be downloaded again.
+func (s *SubscriptionService) ArchiveVideo(ctx context.Context, id string, videoID string) (bool, error) {
+	added, err := s.redis.SAdd(ctx, rediskeys.GetSubscriptionArchiveKey(id), videoID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to archive video: %v", err)
+	}
+	return added == 1, nil
+}
+
+// UnarchiveVideo removes a video from the download archive, e.g. when enqueuing its download failed
+func (s *SubscriptionService) UnarchiveVideo(ctx context.Context, id string, videoID string) error {
+	if err := s.redis.SRem(ctx, rediskeys.GetSubscriptionArchiveKey(id), videoID).Err(); err != nil {
+		return fmt.Errorf("failed to unarchive video: %v", err)
+	}
+	return nil
+}
+
+// IsArchived reports whether a video is in the subscription's download archive
+func (s *SubscriptionService) IsArchived(ctx context.Context, id string, videoID string) (bool, error) {
+	archived, err := s.redis.SIsMember(ctx, rediskeys.GetSubscriptionArchiveKey(id), videoID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check download archive: %v", err)
+	}
+	return archived, nil
+}
+
+// marshalSubscription encodes a subscription's definition, leaving out its sync state
+func marshalSubscription(subscription *Subscription) ([]byte, error) {
+	definition := *subscription
+	definition.LastSync = nil
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal subscription: %v", err)
+	}
+	return data, nil
+}
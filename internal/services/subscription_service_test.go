@@ -0,0 +1,72 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionFiltersValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters SubscriptionFilters
+		wantErr bool
+	}{
+		{name: "no filters", filters: SubscriptionFilters{}},
+		{name: "all filters", filters: SubscriptionFilters{MaxAge: "168h", TitleRegex: "(?i)podcast", MaxDuration: "20m"}},
+		{name: "invalid max age", filters: SubscriptionFilters{MaxAge: "7d"}, wantErr: true},
+		{name: "negative max duration", filters: SubscriptionFilters{MaxDuration: "-5m"}, wantErr: true},
+		{name: "invalid regex", filters: SubscriptionFilters{TitleRegex: "("}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filters.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSubscriptionFiltersMatcher(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	filters := SubscriptionFilters{MaxAge: "72h", TitleRegex: "(?i)episode", MaxDuration: "30m"}
+
+	match, err := filters.Matcher()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		entry PlaylistEntry
+		want  bool
+	}{
+		{name: "matches", entry: PlaylistEntry{Title: "Episode 12", Duration: 600, UploadedAt: now.Add(-24 * time.Hour)}, want: true},
+		{name: "unknown date and duration", entry: PlaylistEntry{Title: "Episode 13"}, want: true},
+		{name: "too old", entry: PlaylistEntry{Title: "Episode 1", UploadedAt: now.Add(-96 * time.Hour)}, want: false},
+		{name: "too long", entry: PlaylistEntry{Title: "Episode 2", Duration: 3600}, want: false},
+		{name: "title does not match", entry: PlaylistEntry{Title: "Trailer"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, match(tt.entry, now))
+		})
+	}
+}
+
+func TestMarshalSubscriptionOmitsLastSync(t *testing.T) {
+	subscription := &Subscription{
+		ID:       "abc",
+		URL:      "https://www.youtube.com/@example/videos",
+		LastSync: &SubscriptionSync{Error: "boom"},
+	}
+
+	data, err := marshalSubscription(subscription)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "last_sync")
+	assert.NotNil(t, subscription.LastSync, "the original subscription must not be modified")
+}
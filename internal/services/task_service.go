@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"spiropoulos94/youtube-downloader/internal/rediskeys"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TaskService implements TaskServiceInterface
+type TaskService struct {
+	redis *redis.Client
+}
+
+// NewTaskService creates a new TaskService instance
+func NewTaskService(redis *redis.Client) TaskServiceInterface {
+	return &TaskService{
+		redis: redis,
+	}
+}
+
+// TaskEvent is a task state update published by a worker
+type TaskEvent struct {
+	TaskID string
+	Data   []byte // The task result as written by the worker
+}
+
+// TaskEventSubscription receives task events until it is closed
+type TaskEventSubscription struct {
+	pubsub *redis.PubSub
+	events chan TaskEvent
+}
+
+// Events returns the channel the subscribed task events are delivered on
+func (s *TaskEventSubscription) Events() <-chan TaskEvent {
+	return s.events
+}
+
+// Close unsubscribes and closes the events channel
+func (s *TaskEventSubscription) Close() error {
+	return s.pubsub.Close()
+}
+
+// PublishTaskEvent publishes a task state update to everyone watching the task
+func (s *TaskService) PublishTaskEvent(ctx context.Context, taskID string, data []byte) error {
+	if err := s.redis.Publish(ctx, rediskeys.GetTaskEventsChannel(taskID), data).Err(); err != nil {
+		return fmt.Errorf("failed to publish task event: %v", err)
+	}
+	return nil
+}
+
+// SaveFinalTaskState records the final state of a task that can't write its own result:
+// cancelled tasks are deleted from the queue or have their context cancelled, and asynq
+// refuses result writes once a task's context is done (e.g. after a timeout).
+func (s *TaskService) SaveFinalTaskState(ctx context.Context, taskID string, data []byte, retention time.Duration) error {
+	if err := s.redis.Set(ctx, rediskeys.GetTaskFinalStateKey(taskID), data, retention).Err(); err != nil {
+		return fmt.Errorf("failed to save final task state: %v", err)
+	}
+	return nil
+}
+
+// GetFinalTaskState returns the state recorded by SaveFinalTaskState, or nil if there is none
+func (s *TaskService) GetFinalTaskState(ctx context.Context, taskID string) ([]byte, error) {
+	data, err := s.redis.Get(ctx, rediskeys.GetTaskFinalStateKey(taskID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get final task state: %v", err)
+	}
+	return data, nil
+}
+
+// compareAndDeleteScript deletes a key only if it still holds the given value, so a claim or
+// lock that expired and was taken over by someone else isn't released by its previous owner
+var compareAndDeleteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// claimInFlightScript claims a video hash for task ARGV[1] for ARGV[2] milliseconds, unless
+// another task already claimed it. Claims hold the task ID and, after an "@", when they were
+// taken by the Redis clock. It returns the ID of the task holding the claim and its age in
+// milliseconds, -1 for claims recorded without the time.
+var claimInFlightScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+if redis.call("SET", KEYS[1], ARGV[1] .. "@" .. string.format("%d", now), "NX", "PX", ARGV[2]) then
+	return {ARGV[1], 0}
+end
+local claim = redis.call("GET", KEYS[1])
+local taskID, claimedAt = string.match(claim, "^(.*)@(%d+)$")
+if not taskID then
+	return {claim, -1}
+end
+return {taskID, now - tonumber(claimedAt)}
+`)
+
+// releaseInFlightScript releases the claim on a video hash if task ARGV[1] still holds it, so a
+// claim that expired and was taken over by another task isn't released by its previous holder
+var releaseInFlightScript = redis.NewScript(`
+local claim = redis.call("GET", KEYS[1])
+if claim and (string.match(claim, "^(.*)@%d+$") or claim) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// ClaimInFlightTask records taskID as the task downloading the video hash, unless another task
+// already claimed it. It returns the ID of the task holding the claim, which is taskID if the
+// claim succeeded, and how long ago that task claimed it, or -1 if that isn't known. The claim
+// expires after ttl in case it is never released.
+func (s *TaskService) ClaimInFlightTask(ctx context.Context, urlHash string, taskID string, ttl time.Duration) (string, time.Duration, error) {
+	result, err := claimInFlightScript.Run(ctx, s.redis, []string{rediskeys.GetInFlightTaskKey(urlHash)}, taskID, ttl.Milliseconds()).Slice()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to claim in-flight task: %v", err)
+	}
+	claimedID, _ := result[0].(string)
+	age, _ := result[1].(int64)
+	if age < 0 {
+		return claimedID, -1, nil
+	}
+	return claimedID, time.Duration(age) * time.Millisecond, nil
+}
+
+// ReleaseInFlightTask releases the claim of a task on a video hash, if it still holds it
+func (s *TaskService) ReleaseInFlightTask(ctx context.Context, urlHash string, taskID string) error {
+	if err := releaseInFlightScript.Run(ctx, s.redis, []string{rediskeys.GetInFlightTaskKey(urlHash)}, taskID).Err(); err != nil {
+		return fmt.Errorf("failed to release in-flight task: %v", err)
+	}
+	return nil
+}
+
+// AttachCaller records that an API key requested a task, by submitting it or attaching to it.
+// callerID is empty when authentication is disabled. The record expires after ttl.
+func (s *TaskService) AttachCaller(ctx context.Context, taskID string, callerID string, ttl time.Duration) error {
+	key := rediskeys.GetTaskCallersKey(taskID)
+	pipe := s.redis.TxPipeline()
+	pipe.HIncrBy(ctx, key, callerID, 1)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to attach caller: %v", err)
+	}
+	return nil
+}
+
+// detachCallerScript removes one request of a caller from a task and returns whether the caller
+// had requested it, along with the number of requests left
+var detachCallerScript = redis.NewScript(`
+local attached = 0
+if tonumber(redis.call("HGET", KEYS[1], ARGV[1]) or "0") > 0 then
+	attached = 1
+	if redis.call("HINCRBY", KEYS[1], ARGV[1], -1) <= 0 then
+		redis.call("HDEL", KEYS[1], ARGV[1])
+	end
+end
+
+local remaining = 0
+for _, count in ipairs(redis.call("HVALS", KEYS[1])) do
+	remaining = remaining + tonumber(count)
+end
+return {attached, remaining}
+`)
+
+// DetachCaller removes one request of a caller from a task. It returns whether the caller had
+// requested the task and how many requests, by any caller, are left.
+func (s *TaskService) DetachCaller(ctx context.Context, taskID string, callerID string) (bool, int64, error) {
+	result, err := detachCallerScript.Run(ctx, s.redis, []string{rediskeys.GetTaskCallersKey(taskID)}, callerID).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to detach caller: %v", err)
+	}
+	return result[0] == 1, result[1], nil
+}
+
+// IsCaller reports whether an API key requested a task and hasn't cancelled it since
+func (s *TaskService) IsCaller(ctx context.Context, taskID string, callerID string) (bool, error) {
+	isCaller, err := s.redis.HExists(ctx, rediskeys.GetTaskCallersKey(taskID), callerID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check task caller: %v", err)
+	}
+	return isCaller, nil
+}
+
+// SubscribeTaskEvents subscribes to the state updates of the given tasks.
+// The subscription is active when this returns, so state read afterwards won't miss an update.
+func (s *TaskService) SubscribeTaskEvents(ctx context.Context, taskIDs []string) (*TaskEventSubscription, error) {
+	channels := make([]string, len(taskIDs))
+	for i, taskID := range taskIDs {
+		channels[i] = rediskeys.GetTaskEventsChannel(taskID)
+	}
+
+	pubsub := s.redis.Subscribe(ctx, channels...)
+
+	// Wait for the subscription to be confirmed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to task events: %v", err)
+	}
+
+	subscription := &TaskEventSubscription{
+		pubsub: pubsub,
+		events: make(chan TaskEvent),
+	}
+
+	go func() {
+		defer close(subscription.events)
+		// The pubsub channel is closed when the subscription is closed
+		for msg := range pubsub.Channel() {
+			event := TaskEvent{
+				TaskID: rediskeys.GetTaskIDFromEventsChannel(msg.Channel),
+				Data:   []byte(msg.Payload),
+			}
+			select {
+			case subscription.events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return subscription, nil
+}
+
+// recordTransferScript extends the length of a file a client received from its start, if the
+// transfer continued from within what the client already had
+var recordTransferScript = redis.NewScript(`
+local received = tonumber(redis.call("GET", KEYS[1]) or "0")
+local start = tonumber(ARGV[1])
+local transferEnd = start + tonumber(ARGV[2])
+if start <= received and transferEnd > received then
+	received = transferEnd
+	redis.call("SET", KEYS[1], received, "PX", ARGV[3])
+end
+return received
+`)
+
+// RecordTransfer records that a client received length bytes of a task's file from offset start,
+// and returns how much of the file the client has received from its start, across all of its
+// transfers. Ranges that leave a gap, e.g. a seek past what was received, don't count.
+func (s *TaskService) RecordTransfer(ctx context.Context, taskID string, start int64, length int64, retention time.Duration) (int64, error) {
+	received, err := recordTransferScript.Run(ctx, s.redis, []string{rediskeys.GetTransferKey(taskID)}, start, length, retention.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record transfer: %v", err)
+	}
+	return received, nil
+}
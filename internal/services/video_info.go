@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"spiropoulos94/youtube-downloader/internal/rediskeys"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// VideoInfo describes a video before it is downloaded
+type VideoInfo struct {
+	ID              string        `json:"id"`
+	Title           string        `json:"title"`
+	Uploader        string        `json:"uploader,omitempty"`
+	Duration        string        `json:"duration,omitempty"` // m:ss
+	DurationSeconds float64       `json:"duration_seconds,omitempty"`
+	ThumbnailURL    string        `json:"thumbnail_url,omitempty"`
+	Formats         []VideoFormat `json:"formats"`
+	Cached          bool          `json:"cached"` // The default format is already downloaded
+}
+
+// VideoFormat is one of the formats a video is available in
+type VideoFormat struct {
+	FormatID   string  `json:"format_id"`
+	Ext        string  `json:"ext"`
+	Note       string  `json:"note,omitempty"` // e.g. "1080p" or "medium"
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	FPS        float64 `json:"fps,omitempty"`
+	VideoCodec string  `json:"video_codec,omitempty"` // Empty for audio only formats
+	AudioCodec string  `json:"audio_codec,omitempty"` // Empty for video only formats
+	Bitrate    float64 `json:"bitrate,omitempty"`     // Total bitrate in kbps
+	FileSize   int64   `json:"filesize,omitempty"`    // Bytes, estimated if FileSizeExact is false
+	// FileSizeExact reports whether FileSize is known rather than estimated from the bitrate
+	FileSizeExact bool `json:"filesize_exact"`
+}
+
+// GetVideoInfo returns the title, uploader, duration, thumbnail and available formats of a video.
+// The info is cached in Redis by video ID for a short time, since listing formats takes yt-dlp a few seconds.
+func (s *YouTubeService) GetVideoInfo(ctx context.Context, url string) (*VideoInfo, error) {
+	info, err := s.getCachedVideoInfo(ctx, url)
+	if err != nil {
+		log.Printf("Warning: Failed to read cached video info: %v", err)
+	}
+
+	if info == nil {
+		output, err := s.dumpVideoJSON(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		if info, err = parseVideoInfo(output); err != nil {
+			return nil, err
+		}
+		if err := s.cacheVideoInfo(ctx, url, info); err != nil {
+			log.Printf("Warning: Failed to cache video info: %v", err)
+		}
+	}
+
+	// Files come and go, so whether the video is downloaded is never cached
+	var opts DownloadOptions
+	if media := s.mediaURL(url); media != nil && media.AudioOnly {
+		opts.Mode = ModeAudio
+	}
+	filePath, err := s.FindDownloadedFile(ctx, url, opts)
+	if err != nil {
+		return nil, err
+	}
+	info.Cached = filePath != ""
+
+	return info, nil
+}
+
+// getCachedVideoInfo returns the cached info of a video, or nil if it isn't cached
+func (s *YouTubeService) getCachedVideoInfo(ctx context.Context, url string) (*VideoInfo, error) {
+	if s.redis == nil {
+		return nil, nil // The CLI runs without Redis
+	}
+
+	data, err := s.redis.Get(ctx, rediskeys.GetVideoInfoKey(s.canonicalVideoKey(url))).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get video info: %v", err)
+	}
+
+	var info VideoInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal video info: %v", err)
+	}
+	return &info, nil
+}
+
+// cacheVideoInfo caches the info of a video for InfoCacheTTL
+func (s *YouTubeService) cacheVideoInfo(ctx context.Context, url string, info *VideoInfo) error {
+	if s.redis == nil {
+		return nil // The CLI runs without Redis
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to marshal video info: %v", err)
+	}
+	if err := s.redis.Set(ctx, rediskeys.GetVideoInfoKey(s.canonicalVideoKey(url)), data, s.config.InfoCacheTTL).Err(); err != nil {
+		return fmt.Errorf("failed to cache video info: %v", err)
+	}
+	return nil
+}
+
+// parseVideoInfo extracts the video info from yt-dlp's JSON output
+func parseVideoInfo(output []byte) (*VideoInfo, error) {
+	metadata, err := parseVideoMetadata(output)
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		ID       string  `json:"id"`
+		Uploader string  `json:"uploader"`
+		Channel  string  `json:"channel"`
+		Duration float64 `json:"duration"`
+		Formats  []struct {
+			FormatID       string  `json:"format_id"`
+			Ext            string  `json:"ext"`
+			FormatNote     string  `json:"format_note"`
+			Width          int     `json:"width"`
+			Height         int     `json:"height"`
+			FPS            float64 `json:"fps"`
+			VCodec         string  `json:"vcodec"`
+			ACodec         string  `json:"acodec"`
+			TBR            float64 `json:"tbr"`
+			FileSize       int64   `json:"filesize"`
+			FileSizeApprox int64   `json:"filesize_approx"`
+		} `json:"formats"`
+	}
+	if err := json.Unmarshal(output, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse video info: %v", err)
+	}
+
+	info := &VideoInfo{
+		ID:              data.ID,
+		Title:           metadata.Title,
+		Uploader:        data.Uploader,
+		Duration:        metadata.Duration,
+		DurationSeconds: data.Duration,
+		ThumbnailURL:    metadata.ThumbnailURL,
+		Formats:         []VideoFormat{},
+	}
+	if info.Uploader == "" {
+		info.Uploader = data.Channel
+	}
+
+	for _, f := range data.Formats {
+		videoCodec := codecOrEmpty(f.VCodec)
+		audioCodec := codecOrEmpty(f.ACodec)
+		// Storyboards and other image formats have neither
+		if videoCodec == "" && audioCodec == "" {
+			continue
+		}
+
+		format := VideoFormat{
+			FormatID:   f.FormatID,
+			Ext:        f.Ext,
+			Note:       f.FormatNote,
+			Width:      f.Width,
+			Height:     f.Height,
+			FPS:        f.FPS,
+			VideoCodec: videoCodec,
+			AudioCodec: audioCodec,
+			Bitrate:    f.TBR,
+		}
+		switch {
+		case f.FileSize > 0:
+			format.FileSize = f.FileSize
+			format.FileSizeExact = true
+		case f.FileSizeApprox > 0:
+			format.FileSize = f.FileSizeApprox
+		case f.TBR > 0 && data.Duration > 0:
+			// kbps * 1000 * seconds / 8 = bytes
+			format.FileSize = int64(f.TBR * data.Duration * 1000 / 8)
+		}
+		info.Formats = append(info.Formats, format)
+	}
+
+	return info, nil
+}
+
+// codecOrEmpty returns the codec yt-dlp reported, or an empty string if the stream is missing
+func codecOrEmpty(codec string) string {
+	if codec == "none" {
+		return ""
+	}
+	return codec
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVideoInfo(t *testing.T) {
+	output := []byte(`{
+		"id": "dQw4w9WgXcQ",
+		"title": "Test Video",
+		"channel": "Test Channel",
+		"duration": 212,
+		"thumbnails": [{"url": "https://i.ytimg.com/vi/dQw4w9WgXcQ/default.jpg"}],
+		"formats": [
+			{"format_id": "sb0", "ext": "mhtml", "format_note": "storyboard", "vcodec": "none", "acodec": "none"},
+			{"format_id": "140", "ext": "m4a", "format_note": "medium", "vcodec": "none", "acodec": "mp4a.40.2", "tbr": 129.5, "filesize": 3433000},
+			{"format_id": "137", "ext": "mp4", "format_note": "1080p", "width": 1920, "height": 1080, "fps": 25, "vcodec": "avc1.640028", "acodec": "none", "tbr": 1500, "filesize_approx": 40000000},
+			{"format_id": "18", "ext": "mp4", "format_note": "360p", "width": 640, "height": 360, "vcodec": "avc1.42001E", "acodec": "mp4a.40.2", "tbr": 400}
+		]
+	}`)
+
+	info, err := parseVideoInfo(output)
+	require.NoError(t, err)
+
+	assert.Equal(t, "dQw4w9WgXcQ", info.ID)
+	assert.Equal(t, "Test Video", info.Title)
+	assert.Equal(t, "Test Channel", info.Uploader, "falls back to the channel name")
+	assert.Equal(t, "3:32", info.Duration)
+	assert.Equal(t, float64(212), info.DurationSeconds)
+	assert.Equal(t, "https://i.ytimg.com/vi/dQw4w9WgXcQ/default.jpg", info.ThumbnailURL)
+
+	require.Len(t, info.Formats, 3, "storyboards are left out")
+
+	audio := info.Formats[0]
+	assert.Equal(t, "140", audio.FormatID)
+	assert.Empty(t, audio.VideoCodec)
+	assert.Equal(t, "mp4a.40.2", audio.AudioCodec)
+	assert.Equal(t, int64(3433000), audio.FileSize)
+	assert.True(t, audio.FileSizeExact)
+
+	video := info.Formats[1]
+	assert.Equal(t, 1080, video.Height)
+	assert.Empty(t, video.AudioCodec)
+	assert.Equal(t, int64(40000000), video.FileSize)
+	assert.False(t, video.FileSizeExact)
+
+	// Without any size, the size is estimated from the bitrate: 400 kbps * 212 s / 8
+	combined := info.Formats[2]
+	assert.Equal(t, int64(10600000), combined.FileSize)
+	assert.False(t, combined.FileSizeExact)
+}
+
+func TestParseVideoInfoInvalidJSON(t *testing.T) {
+	_, err := parseVideoInfo([]byte(`not json`))
+	assert.Error(t, err)
+}
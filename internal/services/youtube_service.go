@@ -5,15 +5,19 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"spiropoulos94/youtube-downloader/internal/config"
 	"spiropoulos94/youtube-downloader/internal/rediskeys"
+	"spiropoulos94/youtube-downloader/internal/storage"
+	"spiropoulos94/youtube-downloader/internal/validators"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -21,21 +25,33 @@ import (
 
 // YouTubeService implements YouTubeServiceInterface
 type YouTubeService struct {
-	config *config.Config
-	redis  *redis.Client
+	config   *config.Config
+	redis    *redis.Client
+	sources  validators.URLValidatorInterface // Identifies videos and their site's yt-dlp options
+	store    storage.StoreInterface           // Keeps the finished downloads
+	index    MediaIndexInterface              // Finds the finished downloads, nil in the CLI which lists the store instead
+	leases   FileLeasesInterface              // Keeps the cleanup service from deleting files in use, nil in the CLI
+	outbound OutboundLimiterInterface         // Limits the downloads workers start together, nil in the CLI
 }
 
 // NewYouTubeService creates a new instance of YouTubeService
-func NewYouTubeService(config *config.Config, redis *redis.Client) YouTubeServiceInterface {
+func NewYouTubeService(config *config.Config, redis *redis.Client, store storage.StoreInterface, index MediaIndexInterface, leases FileLeasesInterface, outbound OutboundLimiterInterface) YouTubeServiceInterface {
 	return &YouTubeService{
-		config: config,
-		redis:  redis,
+		config:   config,
+		redis:    redis,
+		sources:  validators.NewSourceRegistry(config),
+		store:    store,
+		index:    index,
+		leases:   leases,
+		outbound: outbound,
 	}
 }
 
 // UpdateLastRequestTime updates the last request time for a file
-func (s *YouTubeService) UpdateLastRequestTime(filePath string) error {
-	ctx := context.Background()
+func (s *YouTubeService) UpdateLastRequestTime(ctx context.Context, filePath string) error {
+	if s.redis == nil {
+		return nil // The CLI runs without Redis
+	}
 	key := rediskeys.GetLastRequestKey(filePath)
 	now := time.Now().Format(time.RFC3339)
 
@@ -45,12 +61,63 @@ func (s *YouTubeService) UpdateLastRequestTime(filePath string) error {
 	return nil
 }
 
-// GetURLHash returns a hash of the URL that can be used to identify the video
-func (s *YouTubeService) GetURLHash(url string) string {
-	urlHash := sha256.Sum256([]byte(url))
+// GetURLHash returns a hash of the video and chosen format that can be used to identify the download.
+// The hash is based on the canonical video ID, so every URL form of a video (youtu.be links,
+// timestamps, mobile URLs, ...) shares the same file. Different formats of the same video get
+// different hashes, so they are cached as separate files.
+func (s *YouTubeService) GetURLHash(url string, opts DownloadOptions) string {
+	return hashCacheKey(s.canonicalVideoKey(url), opts)
+}
+
+// canonicalVideoKey returns the key of the video a URL points to, or the URL itself if it has no video ID
+func (s *YouTubeService) canonicalVideoKey(url string) string {
+	if media := s.mediaURL(url); media != nil && media.VideoID != "" {
+		return media.CacheKey()
+	}
+	return url
+}
+
+// sourceArgs returns the extra yt-dlp options of the site a URL belongs to
+func (s *YouTubeService) sourceArgs(url string) []string {
+	if media := s.mediaURL(url); media != nil {
+		return media.DownloadArgs
+	}
+	return nil
+}
+
+// mediaURL returns what a URL points to, or nil if it doesn't belong to an enabled source
+func (s *YouTubeService) mediaURL(url string) *validators.MediaURL {
+	if s.sources == nil {
+		return nil
+	}
+	media, err := s.sources.Validate(url)
+	if err != nil {
+		return nil
+	}
+	return media
+}
+
+// legacyURLHash returns the hash files were named with before hashes were based on video IDs.
+// It hashed the raw URL, so it is only used to migrate files downloaded from the exact same URL.
+func legacyURLHash(url string, opts DownloadOptions) string {
+	return hashCacheKey(url, opts)
+}
+
+// hashCacheKey hashes a video key and format into the short hash used in file names
+func hashCacheKey(key string, opts DownloadOptions) string {
+	if formatKey := opts.CacheKey(); formatKey != "" {
+		key += "#" + formatKey
+	}
+	urlHash := sha256.Sum256([]byte(key))
 	return hex.EncodeToString(urlHash[:8]) // Use first 8 chars of hash
 }
 
+// FindDownloadedFile returns the path of the finished download of a video in the given format,
+// or an empty path if it hasn't been downloaded
+func (s *YouTubeService) FindDownloadedFile(ctx context.Context, url string, opts DownloadOptions) (string, error) {
+	return s.findDownloadedFile(ctx, s.GetURLHash(url, opts), opts.Extension())
+}
+
 // VideoData contains both file path and metadata
 type VideoData struct {
 	FilePath     string
@@ -59,8 +126,10 @@ type VideoData struct {
 	Duration     string
 }
 
-// DownloadVideo downloads a video from YouTube and returns the file path and metadata in a single operation
-func (s *YouTubeService) DownloadVideo(url string) (*VideoData, error) {
+// DownloadVideo downloads a video (or only its audio track) from YouTube in the requested format and returns the file path and metadata in a single operation
+// onProgress, if not nil, is called with progress updates while yt-dlp runs.
+// Cancelling ctx kills yt-dlp and its children and removes the partially downloaded files.
+func (s *YouTubeService) DownloadVideo(ctx context.Context, url string, opts DownloadOptions, onProgress ProgressFunc) (*VideoData, error) {
 	// Create output directory if it doesn't exist
 	if err := os.MkdirAll(s.config.OutputDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create output directory: %v", err)
@@ -71,55 +140,54 @@ func (s *YouTubeService) DownloadVideo(url string) (*VideoData, error) {
 		return nil, fmt.Errorf("yt-dlp is not installed. Please install it first:\nOn macOS: brew install yt-dlp\nOn Linux: sudo apt install yt-dlp or sudo pip install yt-dlp")
 	}
 
-	// Get URL hash
-	urlHashStr := s.GetURLHash(url)
+	// Get URL hash and the extension the finished file will have
+	urlHashStr := s.GetURLHash(url, opts)
+	fileSuffix := urlHashStr + "." + opts.Extension()
+
+	// Files downloaded before hashes were based on video IDs are renamed on their first request
+	if err := s.migrateLegacyFile(ctx, url, opts); err != nil {
+		log.Printf("Warning: Failed to migrate legacy file: %v", err)
+	}
+
+	// Keep the cleanup service away from the files, whether they are found or downloaded, until
+	// they are recorded as requested and the task can report them
+	release, err := s.holdHash(ctx, urlHashStr)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	// Check if video already exists
-	existingFiles, err := os.ReadDir(s.config.OutputDir)
+	filePath, err := s.findDownloadedFile(ctx, urlHashStr, opts.Extension())
 	if err != nil {
-		return nil, fmt.Errorf("failed to read output directory: %v", err)
-	}
-
-	// Look for existing video with the same URL hash
-	for _, file := range existingFiles {
-		// check if the file name contains the url hash of the new video url
-		if strings.HasSuffix(file.Name(), urlHashStr+".mp4") {
-			filePath := filepath.Join(s.config.OutputDir, file.Name())
-			// Verify file exists and is readable
-			if _, err := os.Stat(filePath); err == nil {
-				// update last request time since the file already exists
-				if err := s.UpdateLastRequestTime(filePath); err != nil {
-					return nil, err
-				}
+		return nil, err
+	}
+	if filePath != "" {
+		return s.cachedVideoData(ctx, url, filePath)
+	}
 
-				// Check if we have metadata stored in Redis
-				metadata, err := s.GetStoredMetadata(filePath)
-				if err != nil {
-					// If no stored metadata, fetch it from youtube and store it
-					log.Printf("No stored metadata found for %s, fetching...", filePath)
-					metadata, err = s.fetchMetadata(url)
-					if err != nil {
-						log.Printf("Warning: Failed to fetch metadata for existing video: %v", err)
-						// Return the file even if metadata fetch fails
-						return &VideoData{
-							FilePath: filePath,
-						}, nil
-					}
-
-					// Store the fetched metadata in Redis for future use
-					if err := s.StoreMetadata(filePath, metadata); err != nil {
-						log.Printf("Warning: Failed to store metadata: %v", err)
-					}
-				}
+	// Check the outbound limits shared by every worker before taking the lock, so a download held
+	// back by them returns right away instead of keeping other workers waiting
+	bandwidth, done, err := s.acquireOutbound(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
 
-				return &VideoData{
-					FilePath:     filePath,
-					Title:        metadata.Title,
-					ThumbnailURL: metadata.ThumbnailURL,
-					Duration:     metadata.Duration,
-				}, nil
-			}
-		}
+	// Workers sharing the output directory download a video one at a time
+	ctx, unlock, err := s.lockDownload(ctx, urlHashStr)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// The video may have been downloaded by another worker while we waited for the lock
+	filePath, err = s.findDownloadedFile(ctx, urlHashStr, opts.Extension())
+	if err != nil {
+		return nil, err
+	}
+	if filePath != "" {
+		return s.cachedVideoData(ctx, url, filePath)
 	}
 
 	// If we need to download, get both metadata and download in one efficient operation
@@ -128,168 +196,540 @@ func (s *YouTubeService) DownloadVideo(url string) (*VideoData, error) {
 
 	// Combined process: first get metadata and then download
 	// This is the most efficient approach that requires just one yt-dlp process
-	cmd := exec.Command("yt-dlp",
+	args := []string{
 		"--dump-json",        // Print JSON metadata to stdout
 		"--no-simulate",      // Actually download the video
 		"-o", outputTemplate, // Set output template
-		"--merge-output-format", "mp4", // Force output to be MP4
-		"--windows-filenames", // Only restrict characters that are illegal in Windows
-		"--no-playlist",       // Don't download playlists
-		"--quiet",             // Don't print progress (we'll only get the JSON)
-		url)
-
-	// Capture stdout which will contain the JSON metadata
+		"--windows-filenames",            // Only restrict characters that are illegal in Windows
+		"--no-playlist",                  // Don't download playlists
+		"--quiet",                        // Don't print regular output (we'll only get the JSON and progress lines)
+		"--print", "after_move:filepath", // Print the path of the finished file
+	}
+	args = append(args, progressTemplateArgs...)      // Report machine readable progress
+	args = append(args, opts.formatArgs()...)         // Apply the requested mode, resolution, codec and size limits
+	args = append(args, s.sourceArgs(url)...)         // Options the video's site needs
+	args = append(args, s.outboundArgs(bandwidth)...) // Limit the bandwidth and space out requests
+	args = append(args, url)
+	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	configureProcessGroup(cmd)
+	// Don't wait forever for output pipes held open by processes that survived the kill
+	cmd.WaitDelay = 5 * time.Second
+
+	// Capture stdout which will contain the JSON metadata and our progress lines
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stdout pipe: %v", err)
 	}
 
+	// Capture stderr for error messages (and progress, depending on the yt-dlp version)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stderr pipe: %v", err)
+	}
+
 	// Start command
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("failed to start download: %v", err)
 	}
 
-	// Read JSON metadata from stdout
-	metadataBytes, err := io.ReadAll(stdout)
-	if err != nil {
+	// Progress can arrive on both stdout and stderr, so serialize the callbacks
+	var progressMu sync.Mutex
+	reportProgress := func(progress Progress) {
+		if onProgress == nil {
+			return
+		}
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		onProgress(progress)
+	}
+
+	// Keep the last error line so a failed download can say why it failed
+	var lastErrorLine string
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		if err := scanOutput(stderr, reportProgress, func(line string) { lastErrorLine = line }); err != nil {
+			log.Printf("Warning: Failed to read yt-dlp error output: %v", err)
+		}
+	}()
+
+	// Read JSON metadata, progress and the path of the finished file from stdout
+	var metadataBytes []byte
+	var downloadedPath string
+	if err := scanOutput(stdout, reportProgress, func(line string) {
+		if strings.HasPrefix(line, "{") {
+			metadataBytes = []byte(line)
+		} else if strings.HasSuffix(line, fileSuffix) {
+			downloadedPath = line
+		}
+	}); err != nil {
 		// If we fail to read metadata, don't fail the download
 		log.Printf("Warning: Failed to read metadata: %v", err)
 		// Let the download continue
 	}
+	<-stderrDone
 
 	// Parse metadata if we got it
 	var metadata VideoMetadata
 	if len(metadataBytes) > 0 {
-		var data map[string]interface{}
-		if err := json.Unmarshal(metadataBytes, &data); err != nil {
+		if parsed, err := parseVideoMetadata(metadataBytes); err != nil {
 			log.Printf("Warning: Failed to parse metadata: %v", err)
 		} else {
-			// Extract metadata fields
-			title, _ := data["title"].(string)
-
-			// Get thumbnail URL
-			var thumbnailURL string
-			if thumbnails, ok := data["thumbnails"].([]interface{}); ok && len(thumbnails) > 0 {
-				// Try to get a medium quality thumbnail, or use the last one as fallback
-				bestThumbnail := thumbnails[len(thumbnails)-1].(map[string]interface{})
-				for _, thumb := range thumbnails {
-					if t, ok := thumb.(map[string]interface{}); ok {
-						if res, ok := t["resolution"].(string); ok && res == "medium" {
-							bestThumbnail = t
-							break
-						}
-					}
-				}
-				thumbnailURL, _ = bestThumbnail["url"].(string)
-			}
-
-			// Get duration
-			var duration string
-			if durationSecs, ok := data["duration"].(float64); ok {
-				minutes := int(durationSecs) / 60
-				seconds := int(durationSecs) % 60
-				duration = fmt.Sprintf("%d:%02d", minutes, seconds)
-			}
-
-			metadata = VideoMetadata{
-				Title:        title,
-				ThumbnailURL: thumbnailURL,
-				Duration:     duration,
-			}
+			metadata = *parsed
 		}
 	}
 
 	// Wait for download to complete
 	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			// The download was cancelled, don't leave the partial files behind, unless
+			// they may belong to the worker that took over the expired lock
+			if context.Cause(ctx) != errDownloadLockLost {
+				s.removePartialFiles(urlHashStr, fileSuffix)
+			}
+			return nil, fmt.Errorf("download stopped: %w", context.Cause(ctx))
+		}
+		if isTooManyRequests(lastErrorLine) {
+			s.reportRateLimited(ctx)
+			return nil, fmt.Errorf("failed to download video: %w: %s", ErrUpstreamRateLimited, lastErrorLine)
+		}
+		if lastErrorLine != "" {
+			return nil, fmt.Errorf("failed to download video: %v: %s", err, lastErrorLine)
+		}
 		return nil, fmt.Errorf("failed to download video: %v", err)
 	}
 
 	// At this point, the video has been downloaded
-	// Find the newly downloaded file
-	files, err := os.ReadDir(s.config.OutputDir)
+	localPath := filepath.Join(s.config.OutputDir, filepath.Base(downloadedPath))
+	if downloadedPath == "" {
+		// yt-dlp versions without --print after_move don't report the path
+		if localPath, err = s.findLocalFile(fileSuffix); err != nil {
+			return nil, err
+		}
+		if localPath == "" {
+			return nil, fmt.Errorf("no downloaded file found with hash %s", urlHashStr)
+		}
+	}
+
+	// Index the file before it is moved into the store, which removes the local copy of uploaded files
+	entry, err := s.newMediaEntry(url, opts, localPath, &metadata)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read output directory: %v", err)
+		return nil, err
+	}
+	filePath = filepath.Join(s.config.OutputDir, storage.Key(localPath))
+	if err := s.store.Put(ctx, storage.Key(filePath), localPath); err != nil {
+		return nil, err
+	}
+	if s.index != nil {
+		if err := s.index.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	// Update last request time for the newly downloaded file
+	if err := s.UpdateLastRequestTime(ctx, filePath); err != nil {
+		return nil, err
 	}
 
-	// Find the file with our URL hash
+	return &VideoData{
+		FilePath:     filePath,
+		Title:        metadata.Title,
+		ThumbnailURL: metadata.ThumbnailURL,
+		Duration:     metadata.Duration,
+	}, nil
+}
+
+// acquireOutbound starts a download if the outbound limits allow it, and returns its bandwidth
+// in bytes per second, 0 for no limit, and the function to call once it is done. Otherwise it
+// returns an *OutboundWaitError telling when to try again.
+func (s *YouTubeService) acquireOutbound(ctx context.Context) (int64, func(), error) {
+	if s.outbound == nil {
+		return 0, func() {}, nil
+	}
+	return s.outbound.Acquire(ctx)
+}
+
+// reportRateLimited pauses every worker's downloads after the site rejected one for sending
+// too many requests
+func (s *YouTubeService) reportRateLimited(ctx context.Context) {
+	if s.outbound == nil {
+		return
+	}
+	pause, err := s.outbound.ReportRateLimited(context.WithoutCancel(ctx))
+	if err != nil {
+		log.Printf("Warning: Failed to pause downloads: %v", err)
+		return
+	}
+	log.Printf("Site answered with too many requests, downloads are paused for %s", pause)
+}
+
+// outboundArgs returns the yt-dlp options limiting a download to a bandwidth, in bytes per
+// second, and spacing out its requests as configured
+func (s *YouTubeService) outboundArgs(bandwidth int64) []string {
+	var args []string
+	if bandwidth > 0 {
+		args = append(args, "--limit-rate", strconv.FormatInt(bandwidth, 10))
+	}
+	if s.config.SleepInterval > 0 {
+		args = append(args,
+			"--sleep-interval", formatSeconds(s.config.SleepInterval),
+			"--max-sleep-interval", formatSeconds(2*s.config.SleepInterval),
+		)
+	}
+	if s.config.SleepRequests > 0 {
+		args = append(args, "--sleep-requests", formatSeconds(s.config.SleepRequests))
+	}
+	return args
+}
+
+// formatSeconds formats a duration as the seconds yt-dlp options take, e.g. "1.5"
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// HoldFile keeps the cleanup service from deleting a stored file until the returned release
+// function is called, e.g. while it is streamed to a client
+func (s *YouTubeService) HoldFile(ctx context.Context, filePath string) (func(), error) {
+	return s.holdHash(ctx, leaseHashFromPath(filePath))
+}
+
+// HoldFileFor keeps the cleanup service from deleting a stored file for a fixed time, e.g. while
+// a presigned URL to it is valid
+func (s *YouTubeService) HoldFileFor(ctx context.Context, filePath string, ttl time.Duration) error {
+	urlHash := leaseHashFromPath(filePath)
+	if s.leases == nil || urlHash == "" {
+		return nil
+	}
+	return s.leases.AcquireFor(ctx, urlHash, ttl)
+}
+
+// DeleteFile deletes a stored file along with its Redis keys, unless it is being served or
+// downloaded
+func (s *YouTubeService) DeleteFile(ctx context.Context, filePath string) error {
+	return purgeUnheldFile(ctx, s.store, s.redis, s.index, s.leases, filePath)
+}
+
+// holdHash holds the files of a video hash until the returned release function is called
+func (s *YouTubeService) holdHash(ctx context.Context, urlHash string) (func(), error) {
+	if s.leases == nil || urlHash == "" {
+		return func() {}, nil // The CLI never cleans up
+	}
+	return s.leases.Acquire(ctx, urlHash)
+}
+
+// findLocalFile returns the path of the file in the output directory whose name ends in fileSuffix,
+// or an empty path if there is none
+func (s *YouTubeService) findLocalFile(fileSuffix string) (string, error) {
+	files, err := os.ReadDir(s.config.OutputDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read output directory: %v", err)
+	}
 	for _, file := range files {
-		if strings.HasSuffix(file.Name(), urlHashStr+".mp4") {
-			filePath := filepath.Join(s.config.OutputDir, file.Name())
-			// Update last request time for the newly downloaded file
-			if err := s.UpdateLastRequestTime(filePath); err != nil {
-				return nil, err
-			}
+		if strings.HasSuffix(file.Name(), fileSuffix) {
+			return filepath.Join(s.config.OutputDir, file.Name()), nil
+		}
+	}
+	return "", nil
+}
 
-			// Store the metadata in Redis for future use
-			if err := s.StoreMetadata(filePath, &metadata); err != nil {
-				log.Printf("Warning: Failed to store metadata: %v", err)
-			}
+// newMediaEntry returns the index entry of a file downloaded for the video and format.
+// Without an index (in the CLI) the file isn't read and the entry is nil.
+func (s *YouTubeService) newMediaEntry(url string, opts DownloadOptions, localPath string, metadata *VideoMetadata) (*MediaEntry, error) {
+	if s.index == nil {
+		return nil, nil
+	}
 
+	file, err := os.Open(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open downloaded file: %v", err)
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %v", err)
+	}
+	sum, err := checksum(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MediaEntry{
+		URLHash:   s.GetURLHash(url, opts),
+		VideoKey:  s.canonicalVideoKey(url),
+		Format:    opts.CacheKey(),
+		FilePath:  filepath.Join(s.config.OutputDir, fileInfo.Name()),
+		Size:      fileInfo.Size(),
+		Checksum:  sum,
+		Metadata:  metadata,
+		IndexedAt: time.Now().UTC(),
+	}, nil
+}
+
+// cachedVideoData returns an already downloaded file along with its metadata
+func (s *YouTubeService) cachedVideoData(ctx context.Context, url string, filePath string) (*VideoData, error) {
+	// update last request time since the file already exists
+	if err := s.UpdateLastRequestTime(ctx, filePath); err != nil {
+		return nil, err
+	}
+
+	// Check if we have metadata stored in Redis
+	metadata, err := s.GetStoredMetadata(ctx, filePath)
+	if err != nil {
+		// If no stored metadata, fetch it from youtube and store it
+		log.Printf("No stored metadata found for %s, fetching...", filePath)
+		metadata, err = s.fetchMetadata(ctx, url)
+		if err != nil {
+			log.Printf("Warning: Failed to fetch metadata for existing video: %v", err)
+			// Return the file even if metadata fetch fails
 			return &VideoData{
-				FilePath:     filePath,
-				Title:        metadata.Title,
-				ThumbnailURL: metadata.ThumbnailURL,
-				Duration:     metadata.Duration,
+				FilePath: filePath,
 			}, nil
 		}
+
+		// Store the fetched metadata in Redis for future use
+		if err := s.StoreMetadata(ctx, filePath, metadata); err != nil {
+			log.Printf("Warning: Failed to store metadata: %v", err)
+		}
+	}
+
+	return &VideoData{
+		FilePath:     filePath,
+		Title:        metadata.Title,
+		ThumbnailURL: metadata.ThumbnailURL,
+		Duration:     metadata.Duration,
+	}, nil
+}
+
+// findDownloadedFile returns the path of the finished download of a video hash, or an empty path
+// if it hasn't been downloaded. ext is the extension of the file, used to find it without an index.
+func (s *YouTubeService) findDownloadedFile(ctx context.Context, urlHash string, ext string) (string, error) {
+	if s.index == nil {
+		return s.listDownloadedFile(ctx, urlHash+"."+ext)
 	}
 
-	return nil, fmt.Errorf("no downloaded file found with hash %s", urlHashStr)
+	entry, err := s.index.Get(ctx, urlHash)
+	if err != nil || entry == nil {
+		return "", err
+	}
+
+	// Drop entries of files removed behind the index's back
+	if _, err := s.store.Stat(ctx, storage.Key(entry.FilePath)); errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Removing index entry of missing file %s", entry.FilePath)
+		return "", s.index.Delete(ctx, urlHash)
+	} else if err != nil {
+		return "", err
+	}
+	return entry.FilePath, nil
 }
 
-// StoreMetadata stores video metadata in Redis
-func (s *YouTubeService) StoreMetadata(filePath string, metadata *VideoMetadata) error {
-	ctx := context.Background()
-	key := rediskeys.GetMetadataKey(filePath)
-	data, err := json.Marshal(metadata)
+// listDownloadedFile finds a finished download by listing every stored file
+func (s *YouTubeService) listDownloadedFile(ctx context.Context, fileSuffix string) (string, error) {
+	objects, err := s.store.List(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %v", err)
+		return "", err
 	}
 
-	if err := s.redis.Set(ctx, key, data, s.config.TaskRetention).Err(); err != nil {
-		return fmt.Errorf("failed to store metadata: %v", err)
+	for _, object := range objects {
+		if strings.HasSuffix(object.Key, fileSuffix) {
+			return filepath.Join(s.config.OutputDir, object.Key), nil
+		}
+	}
+	return "", nil
+}
+
+// migrateLegacyFile renames a file downloaded from this exact URL under the legacy raw URL hash
+// to its video ID based name, moving its Redis keys along with it
+func (s *YouTubeService) migrateLegacyFile(ctx context.Context, url string, opts DownloadOptions) error {
+	legacyHash := legacyURLHash(url, opts)
+	urlHash := s.GetURLHash(url, opts)
+	if legacyHash == urlHash {
+		return nil
+	}
+
+	ext := "." + opts.Extension()
+	legacyPath, err := s.findDownloadedFile(ctx, legacyHash, opts.Extension())
+	if err != nil || legacyPath == "" {
+		return err
+	}
+
+	newPath := strings.TrimSuffix(legacyPath, legacyHash+ext) + urlHash + ext
+	if existingPath, err := s.findDownloadedFile(ctx, urlHash, opts.Extension()); err == nil && existingPath != "" {
+		// The video was downloaded again from another URL, the legacy copy is a duplicate
+		log.Printf("Removing legacy duplicate %s of %s", legacyPath, existingPath)
+		if err := s.store.Delete(ctx, storage.Key(legacyPath)); err != nil {
+			return err
+		}
+		return s.deleteIndexEntry(ctx, legacyHash)
+	}
+
+	if err := s.store.Rename(ctx, storage.Key(legacyPath), storage.Key(newPath)); err != nil {
+		return fmt.Errorf("failed to rename %s: %v", legacyPath, err)
+	}
+	log.Printf("Migrated legacy file %s to %s", legacyPath, newPath)
+
+	if err := s.moveIndexEntry(ctx, legacyHash, url, opts, newPath); err != nil {
+		log.Printf("Warning: Failed to move index entry of %s: %v", legacyPath, err)
+	}
+
+	if s.redis == nil {
+		return nil // The CLI runs without Redis
+	}
+	keys := map[string]string{
+		rediskeys.GetLastRequestKey(legacyPath): rediskeys.GetLastRequestKey(newPath),
+		rediskeys.GetMetadataKey(legacyPath):    rediskeys.GetMetadataKey(newPath),
+	}
+	for oldKey, newKey := range keys {
+		if err := s.redis.Rename(ctx, oldKey, newKey).Err(); err != nil && !isNoSuchKeyError(err) {
+			log.Printf("Warning: Failed to move Redis key %s: %v", oldKey, err)
+		}
 	}
 	return nil
 }
 
-// GetStoredMetadata retrieves video metadata from Redis
-func (s *YouTubeService) GetStoredMetadata(filePath string) (*VideoMetadata, error) {
-	ctx := context.Background()
-	key := rediskeys.GetMetadataKey(filePath)
+// deleteIndexEntry removes a video hash from the media index, if there is one
+func (s *YouTubeService) deleteIndexEntry(ctx context.Context, urlHash string) error {
+	if s.index == nil {
+		return nil
+	}
+	return s.index.Delete(ctx, urlHash)
+}
+
+// moveIndexEntry re-indexes the entry of a legacy hash under the video and format it was downloaded for
+func (s *YouTubeService) moveIndexEntry(ctx context.Context, legacyHash string, url string, opts DownloadOptions, newPath string) error {
+	if s.index == nil {
+		return nil
+	}
+	entry, err := s.index.Get(ctx, legacyHash)
+	if err != nil || entry == nil {
+		return err
+	}
+
+	entry.URLHash = s.GetURLHash(url, opts)
+	entry.VideoKey = s.canonicalVideoKey(url)
+	entry.Format = opts.CacheKey()
+	entry.FilePath = newPath
+	if err := s.index.Put(ctx, entry); err != nil {
+		return err
+	}
+	return s.index.Delete(ctx, legacyHash)
+}
 
-	// Get metadata from Redis
-	data, err := s.redis.Get(ctx, key).Bytes()
+// isNoSuchKeyError reports whether a Redis RENAME failed because the key doesn't exist
+func isNoSuchKeyError(err error) bool {
+	return strings.Contains(err.Error(), "no such key")
+}
+
+// removePartialFiles deletes every file of a download except a finished one ending in fileSuffix:
+// .part/.frag/.ytdl files, separately downloaded formats and unfinished merges
+func (s *YouTubeService) removePartialFiles(urlHash string, fileSuffix string) {
+	files, err := os.ReadDir(s.config.OutputDir)
 	if err != nil {
-		if err == redis.Nil {
-			return nil, fmt.Errorf("no metadata found")
+		log.Printf("Warning: Failed to read output directory: %v", err)
+		return
+	}
+
+	for _, file := range files {
+		if !strings.Contains(file.Name(), urlHash) || strings.HasSuffix(file.Name(), fileSuffix) {
+			continue
+		}
+		filePath := filepath.Join(s.config.OutputDir, file.Name())
+		if err := os.Remove(filePath); err != nil {
+			log.Printf("Warning: Failed to remove partial file %s: %v", filePath, err)
+		} else {
+			log.Printf("Removed partial file: %s", filePath)
 		}
-		return nil, fmt.Errorf("failed to get metadata: %v", err)
 	}
+}
 
-	// Parse metadata
-	var metadata VideoMetadata
-	if err := json.Unmarshal(data, &metadata); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal metadata: %v", err)
+// StoreMetadata stores video metadata in the media index entry of a file
+func (s *YouTubeService) StoreMetadata(ctx context.Context, filePath string, metadata *VideoMetadata) error {
+	if s.index == nil {
+		return nil // The CLI runs without Redis
+	}
+	entry, err := s.index.Get(ctx, urlHashFromPath(filePath))
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return fmt.Errorf("%s: %w", filePath, ErrFileNotIndexed)
 	}
 
-	return &metadata, nil
+	entry.Metadata = metadata
+	return s.index.Put(ctx, entry)
+}
+
+// SetPinned exempts the file of a video hash from eviction and expiry, or makes it subject to
+// them again. The file is found through the media index, so it can be pinned long after the
+// task that downloaded it expired.
+func (s *YouTubeService) SetPinned(ctx context.Context, urlHash string, pinned bool) (*MediaEntry, error) {
+	if s.index == nil {
+		return nil, fmt.Errorf("%s: %w", urlHash, ErrFileNotIndexed) // The CLI has no index
+	}
+	entry, err := s.index.Get(ctx, urlHash)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%s: %w", urlHash, ErrFileNotIndexed)
+	}
+
+	entry.Pinned = pinned
+	if err := s.index.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetStoredMetadata retrieves video metadata from the media index entry of a file
+func (s *YouTubeService) GetStoredMetadata(ctx context.Context, filePath string) (*VideoMetadata, error) {
+	if s.index == nil {
+		return nil, fmt.Errorf("no metadata found")
+	}
+	entry, err := s.index.Get(ctx, urlHashFromPath(filePath))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil || entry.Metadata == nil {
+		return nil, fmt.Errorf("no metadata found")
+	}
+	return entry.Metadata, nil
 }
 
 // fetchMetadata is a helper method to get video metadata
-func (s *YouTubeService) fetchMetadata(url string) (*VideoMetadata, error) {
-	// Run yt-dlp to get video info
-	cmd := exec.Command("yt-dlp",
+func (s *YouTubeService) fetchMetadata(ctx context.Context, url string) (*VideoMetadata, error) {
+	output, err := s.dumpVideoJSON(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseVideoMetadata(output)
+}
+
+// dumpVideoJSON runs yt-dlp to get a video's full info JSON without downloading it
+func (s *YouTubeService) dumpVideoJSON(ctx context.Context, url string) ([]byte, error) {
+	args := []string{
 		"--dump-json",
 		"--no-playlist",
 		"--skip-download",
-		url)
+	}
+	args = append(args, s.sourceArgs(url)...)
+	args = append(args, url)
+	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	configureProcessGroup(cmd)
 
 	output, err := cmd.Output()
 	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("failed to fetch video metadata: %v: %s", err, lastLine(exitErr.Stderr))
+		}
 		return nil, fmt.Errorf("failed to fetch video metadata: %v", err)
 	}
+	return output, nil
+}
 
-	// Parse the JSON output
+// parseVideoMetadata extracts the metadata we keep from yt-dlp's JSON output
+func parseVideoMetadata(output []byte) (*VideoMetadata, error) {
 	var data map[string]interface{}
 	if err := json.Unmarshal(output, &data); err != nil {
 		return nil, fmt.Errorf("failed to parse video metadata: %v", err)
@@ -302,7 +742,7 @@ func (s *YouTubeService) fetchMetadata(url string) (*VideoMetadata, error) {
 	var thumbnailURL string
 	if thumbnails, ok := data["thumbnails"].([]interface{}); ok && len(thumbnails) > 0 {
 		// Try to get a medium quality thumbnail, or use the last one as fallback
-		bestThumbnail := thumbnails[len(thumbnails)-1].(map[string]interface{})
+		bestThumbnail, _ := thumbnails[len(thumbnails)-1].(map[string]interface{})
 		for _, thumb := range thumbnails {
 			if t, ok := thumb.(map[string]interface{}); ok {
 				if res, ok := t["resolution"].(string); ok && res == "medium" {
@@ -329,21 +769,22 @@ func (s *YouTubeService) fetchMetadata(url string) (*VideoMetadata, error) {
 	}, nil
 }
 
-// GetOriginalFilename extracts the original title from a downloaded video filename.
-// The format is expected to be "title_hash.mp4", and this function returns "title.mp4".
+// GetOriginalFilename extracts the original title from a downloaded media filename.
+// The format is expected to be "title_hash.ext", and this function returns "title.ext".
 // If escape is true, it also escapes special characters for use in Content-Disposition headers.
 func (s *YouTubeService) GetOriginalFilename(filePath string, escape bool) string {
 	fileName := filepath.Base(filePath)
+	ext := filepath.Ext(fileName)
+	if ext == "" {
+		ext = ".mp4"
+	}
 	// Remove the hash part to get just the title portion
-	lastUnderscore := strings.LastIndex(fileName, "_")
-	titlePart := fileName
-	if lastUnderscore != -1 {
-		titlePart = fileName[:lastUnderscore]
+	titlePart := strings.TrimSuffix(fileName, ext)
+	if lastUnderscore := strings.LastIndex(titlePart, "_"); lastUnderscore != -1 {
+		titlePart = titlePart[:lastUnderscore]
 	}
 	// Ensure the extension is preserved
-	if !strings.HasSuffix(titlePart, ".mp4") {
-		titlePart += ".mp4"
-	}
+	titlePart += ext
 
 	if escape {
 		// Escape double quotes for Content-Disposition header
@@ -353,6 +794,24 @@ func (s *YouTubeService) GetOriginalFilename(filePath string, escape bool) strin
 	return titlePart
 }
 
+// mediaContentTypes maps downloaded file extensions to their Content-Type
+var mediaContentTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".opus": "audio/ogg",
+}
+
+// GetContentType returns the Content-Type to serve a downloaded file with
+func (s *YouTubeService) GetContentType(filePath string) string {
+	if contentType, ok := mediaContentTypes[strings.ToLower(filepath.Ext(filePath))]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
 // VideoMetadata contains basic information about a YouTube video
 type VideoMetadata struct {
 	Title        string `json:"title"`
@@ -1,10 +1,15 @@
 package services
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/storage"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Test GetURLHash
@@ -36,7 +41,7 @@ func TestGetURLHash(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := service.GetURLHash(tt.url)
+			result := service.GetURLHash(tt.url, DownloadOptions{})
 
 			// Ensure we got a result
 			assert.NotEmpty(t, result)
@@ -45,15 +50,90 @@ func TestGetURLHash(t *testing.T) {
 			assert.Equal(t, 16, len(result))
 
 			// Call again to verify consistency
-			resultAgain := service.GetURLHash(tt.url)
+			resultAgain := service.GetURLHash(tt.url, DownloadOptions{})
 			assert.Equal(t, result, resultAgain)
 		})
 	}
 
 	// Extra test to ensure different URLs produce different hashes
-	hash1 := service.GetURLHash("https://www.youtube.com/watch?v=videoA")
-	hash2 := service.GetURLHash("https://www.youtube.com/watch?v=videoB")
+	hash1 := service.GetURLHash("https://www.youtube.com/watch?v=videoA", DownloadOptions{})
+	hash2 := service.GetURLHash("https://www.youtube.com/watch?v=videoB", DownloadOptions{})
 	assert.NotEqual(t, hash1, hash2)
+
+	// The same URL in different formats must not share a cache entry
+	hash480 := service.GetURLHash("https://www.youtube.com/watch?v=videoA", DownloadOptions{MaxHeight: 480})
+	hash1080 := service.GetURLHash("https://www.youtube.com/watch?v=videoA", DownloadOptions{MaxHeight: 1080})
+	assert.NotEqual(t, hash1, hash480)
+	assert.NotEqual(t, hash480, hash1080)
+}
+
+// Every URL form of a video must share the same hash
+func TestGetURLHashCanonicalVideoID(t *testing.T) {
+	service := NewYouTubeService(&config.Config{}, nil, nil, nil, nil, nil)
+
+	expected := service.GetURLHash("https://www.youtube.com/watch?v=dQw4w9WgXcQ", DownloadOptions{})
+	urls := []string{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=30s",
+		"https://youtu.be/dQw4w9WgXcQ",
+		"https://m.youtube.com/watch?v=dQw4w9WgXcQ",
+		"https://www.youtube.com/shorts/dQw4w9WgXcQ",
+	}
+	for _, url := range urls {
+		assert.Equal(t, expected, service.GetURLHash(url, DownloadOptions{}), url)
+	}
+
+	// Formats still get their own hash
+	assert.NotEqual(t, expected, service.GetURLHash("https://youtu.be/dQw4w9WgXcQ", DownloadOptions{Mode: ModeAudio}))
+
+	// Other sites are keyed by their own canonical IDs
+	vimeoHash := service.GetURLHash("https://vimeo.com/76979871", DownloadOptions{})
+	assert.Equal(t, vimeoHash, service.GetURLHash("https://player.vimeo.com/video/76979871", DownloadOptions{}))
+	assert.NotEqual(t, vimeoHash, service.GetURLHash("https://www.youtube.com/watch?v=76979871abc", DownloadOptions{}))
+}
+
+// Test that legacy files are renamed to their video ID based name
+func TestMigrateLegacyFile(t *testing.T) {
+	dir := t.TempDir()
+	service := NewYouTubeService(&config.Config{OutputDir: dir}, nil, storage.NewLocalStore(dir), nil, nil, nil).(*YouTubeService)
+
+	url := "https://youtu.be/dQw4w9WgXcQ?t=30"
+	opts := DownloadOptions{}
+	legacyPath := filepath.Join(dir, "Test Video_"+legacyURLHash(url, opts)+".mp4")
+	require.NoError(t, os.WriteFile(legacyPath, []byte("video"), 0644))
+
+	require.NoError(t, service.migrateLegacyFile(context.Background(), url, opts))
+
+	filePath, err := service.FindDownloadedFile(context.Background(), url, opts)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Test Video_"+service.GetURLHash(url, opts)+".mp4"), filePath)
+	assert.NoFileExists(t, legacyPath)
+
+	// Other URL forms of the same video find the migrated file
+	otherPath, err := service.FindDownloadedFile(context.Background(), "https://www.youtube.com/watch?v=dQw4w9WgXcQ", opts)
+	require.NoError(t, err)
+	assert.Equal(t, filePath, otherPath)
+
+	// Migrating again is a no-op
+	require.NoError(t, service.migrateLegacyFile(context.Background(), url, opts))
+	assert.FileExists(t, filePath)
+}
+
+// Test that a legacy copy of an already migrated video is removed
+func TestMigrateLegacyFileDuplicate(t *testing.T) {
+	dir := t.TempDir()
+	service := NewYouTubeService(&config.Config{OutputDir: dir}, nil, storage.NewLocalStore(dir), nil, nil, nil).(*YouTubeService)
+
+	url := "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=30s"
+	opts := DownloadOptions{}
+	legacyPath := filepath.Join(dir, "Test Video_"+legacyURLHash(url, opts)+".mp4")
+	currentPath := filepath.Join(dir, "Test Video_"+service.GetURLHash(url, opts)+".mp4")
+	require.NoError(t, os.WriteFile(legacyPath, []byte("video"), 0644))
+	require.NoError(t, os.WriteFile(currentPath, []byte("video"), 0644))
+
+	require.NoError(t, service.migrateLegacyFile(context.Background(), url, opts))
+
+	assert.NoFileExists(t, legacyPath)
+	assert.FileExists(t, currentPath)
 }
 
 // Test GetOriginalFilename
@@ -95,6 +175,18 @@ func TestGetOriginalFilename(t *testing.T) {
 			escape:   false,
 			expected: "Test_Video_Name.mp4",
 		},
+		{
+			name:     "Audio file keeps its extension",
+			filePath: "/tmp/videos/Test Podcast_abc123.mp3",
+			escape:   false,
+			expected: "Test Podcast.mp3",
+		},
+		{
+			name:     "Filename without extension",
+			filePath: "/tmp/videos/Test Video_abc123",
+			escape:   false,
+			expected: "Test Video.mp4",
+		},
 	}
 
 	for _, tt := range tests {
@@ -105,6 +197,17 @@ func TestGetOriginalFilename(t *testing.T) {
 	}
 }
 
+// Test GetContentType
+func TestGetContentType(t *testing.T) {
+	service := &YouTubeService{config: &config.Config{}}
+
+	assert.Equal(t, "video/mp4", service.GetContentType("/tmp/videos/Test Video_abc123.mp4"))
+	assert.Equal(t, "audio/mpeg", service.GetContentType("/tmp/videos/Test Podcast_abc123.mp3"))
+	assert.Equal(t, "audio/mp4", service.GetContentType("/tmp/videos/Test Podcast_abc123.M4A"))
+	assert.Equal(t, "audio/ogg", service.GetContentType("/tmp/videos/Test Podcast_abc123.opus"))
+	assert.Equal(t, "application/octet-stream", service.GetContentType("/tmp/videos/notes.txt"))
+}
+
 // Test VideoMetadata
 func TestVideoMetadata(t *testing.T) {
 	// Test that the struct can be created and fields accessed
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore implements StoreInterface by keeping the files in the output directory
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore creates a store keeping its files in dir
+func NewLocalStore(dir string) StoreInterface {
+	return &LocalStore{dir: dir}
+}
+
+// path returns where the file of a key is kept
+func (s *LocalStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.Base(key))
+}
+
+// Put moves the file into the directory, downloads written there already are in place
+func (s *LocalStore) Put(ctx context.Context, key string, localPath string) error {
+	path := s.path(key)
+	if filepath.Clean(localPath) == path {
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+	if err := os.Rename(localPath, path); err != nil {
+		return fmt.Errorf("failed to move %s into storage: %v", localPath, err)
+	}
+	return nil
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	file, err := os.Open(s.path(key))
+	if err != nil {
+		return nil, nil, localError(err)
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, &ObjectInfo{Key: key, Size: fileInfo.Size(), ModTime: fileInfo.ModTime()}, nil
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	fileInfo, err := os.Stat(s.path(key))
+	if err != nil {
+		return nil, localError(err)
+	}
+	return &ObjectInfo{Key: key, Size: fileInfo.Size(), ModTime: fileInfo.ModTime()}, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	return localError(os.Remove(s.path(key)))
+}
+
+func (s *LocalStore) Rename(ctx context.Context, oldKey string, newKey string) error {
+	return localError(os.Rename(s.path(oldKey), s.path(newKey)))
+}
+
+// List returns every regular file of the directory, including unfinished downloads
+func (s *LocalStore) List(ctx context.Context) ([]ObjectInfo, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read output directory: %v", err)
+	}
+
+	objects := make([]ObjectInfo, 0, len(files))
+	for _, file := range files {
+		if !file.Type().IsRegular() {
+			continue
+		}
+		fileInfo, err := file.Info()
+		if err != nil {
+			continue // Removed while listing
+		}
+		objects = append(objects, ObjectInfo{Key: file.Name(), Size: fileInfo.Size(), ModTime: fileInfo.ModTime()})
+	}
+	return objects, nil
+}
+
+// PresignedURL always fails, local files are served by the server
+func (s *LocalStore) PresignedURL(ctx context.Context, key string, contentDisposition string) (string, error) {
+	return "", ErrNoPresignedURL
+}
+
+// localError maps missing files to ErrNotFound
+func localError(err error) error {
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
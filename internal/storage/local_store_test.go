@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStoreContract runs the behaviour every backend must share against store.
+// Files are put from scratchDir, the local directory yt-dlp downloads to.
+func testStoreContract(t *testing.T, store StoreInterface, scratchDir string) {
+	ctx := context.Background()
+	key := "Test Video_0123456789abcdef.mp4"
+
+	localPath := filepath.Join(scratchDir, key)
+	require.NoError(t, os.WriteFile(localPath, []byte("test video content"), 0644))
+	require.NoError(t, store.Put(ctx, key, localPath))
+
+	info, err := store.Stat(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("test video content")), info.Size)
+
+	file, info, err := store.Open(ctx, key)
+	require.NoError(t, err)
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	assert.Equal(t, "test video content", string(content))
+	assert.Equal(t, int64(len(content)), info.Size)
+
+	objects, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, key, objects[0].Key)
+
+	newKey := "Test Video_fedcba9876543210.mp4"
+	require.NoError(t, store.Rename(ctx, key, newKey))
+	_, err = store.Stat(ctx, key)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.Stat(ctx, newKey)
+	assert.NoError(t, err)
+
+	require.NoError(t, store.Delete(ctx, newKey))
+	_, _, err = store.Open(ctx, newKey)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	testStoreContract(t, NewLocalStore(dir), dir)
+}
+
+// Files downloaded outside the directory are moved into it
+func TestLocalStorePutMovesFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "downloads")
+	localPath := filepath.Join(t.TempDir(), "video_0123456789abcdef.mp4")
+	require.NoError(t, os.WriteFile(localPath, []byte("video"), 0644))
+
+	store := NewLocalStore(dir)
+	require.NoError(t, store.Put(context.Background(), "video_0123456789abcdef.mp4", localPath))
+
+	assert.NoFileExists(t, localPath)
+	assert.FileExists(t, filepath.Join(dir, "video_0123456789abcdef.mp4"))
+}
+
+// A directory that doesn't exist yet has no files
+func TestLocalStoreListMissingDir(t *testing.T) {
+	store := NewLocalStore(filepath.Join(t.TempDir(), "missing"))
+	objects, err := store.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, objects)
+}
+
+func TestLocalStorePresignedURL(t *testing.T) {
+	_, err := NewLocalStore(t.TempDir()).PresignedURL(context.Background(), "video.mp4", "attachment")
+	assert.ErrorIs(t, err, ErrNoPresignedURL)
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, "Test Video_0123456789abcdef.mp4", Key("/app/downloads/Test Video_0123456789abcdef.mp4"))
+	assert.Equal(t, "video.mp3", Key("video.mp3"))
+}
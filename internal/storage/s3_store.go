@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Store implements StoreInterface on a bucket of an S3-compatible object store, e.g. MinIO
+type S3Store struct {
+	client        *minio.Client
+	bucket        string
+	presignExpiry time.Duration // How long presigned URLs are valid, 0 to stream files through the server
+}
+
+// NewS3Store connects to the bucket configured in S3_*, creating it if it doesn't exist
+func NewS3Store(ctx context.Context, config *config.Config) (StoreInterface, error) {
+	if config.S3Endpoint == "" || config.S3Bucket == "" {
+		return nil, fmt.Errorf("the s3 storage backend needs S3_ENDPOINT and S3_BUCKET")
+	}
+
+	client, err := minio.New(config.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.S3AccessKey, config.S3SecretKey, ""),
+		Secure: config.S3UseSSL,
+		Region: config.S3Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %v", err)
+	}
+
+	exists, err := client.BucketExists(ctx, config.S3Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s at %s: %v", config.S3Bucket, config.S3Endpoint, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, config.S3Bucket, minio.MakeBucketOptions{Region: config.S3Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %v", config.S3Bucket, err)
+		}
+		log.Printf("Created storage bucket %s", config.S3Bucket)
+	}
+
+	return &S3Store{
+		client:        client,
+		bucket:        config.S3Bucket,
+		presignExpiry: config.S3PresignExpiry,
+	}, nil
+}
+
+// Put uploads the file and removes the local copy
+func (s *S3Store) Put(ctx context.Context, key string, localPath string) error {
+	// The content type is detected from the file extension
+	if _, err := s.client.FPutObject(ctx, s.bucket, key, localPath, minio.PutObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to upload %s: %v", localPath, err)
+	}
+	if err := os.Remove(localPath); err != nil {
+		log.Printf("Warning: Failed to remove uploaded file %s: %v", localPath, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s3Error(err)
+	}
+
+	// GetObject doesn't send a request until the object is read or stat'ed
+	objectInfo, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, nil, s3Error(err)
+	}
+	return object, newObjectInfo(objectInfo), nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	objectInfo, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return newObjectInfo(objectInfo), nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	return s3Error(s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}))
+}
+
+// Rename copies the object to its new key and deletes the old one, S3 has no rename
+func (s *S3Store) Rename(ctx context.Context, oldKey string, newKey string) error {
+	// ComposeObject copies objects larger than the 5 GB limit of a single copy
+	_, err := s.client.ComposeObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: newKey},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: oldKey},
+	)
+	if err != nil {
+		return s3Error(err)
+	}
+	return s.Delete(ctx, oldKey)
+}
+
+func (s *S3Store) List(ctx context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list bucket %s: %v", s.bucket, object.Err)
+		}
+		objects = append(objects, *newObjectInfo(object))
+	}
+	return objects, nil
+}
+
+// PresignedURL returns a link valid for S3_PRESIGN_EXPIRY, if it is set
+func (s *S3Store) PresignedURL(ctx context.Context, key string, contentDisposition string) (string, error) {
+	if s.presignExpiry <= 0 {
+		return "", ErrNoPresignedURL
+	}
+
+	params := url.Values{}
+	params.Set("response-content-disposition", contentDisposition)
+	presignedURL, err := s.client.PresignedGetObject(ctx, s.bucket, key, s.presignExpiry, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign %s: %v", key, err)
+	}
+	return presignedURL.String(), nil
+}
+
+func newObjectInfo(object minio.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{Key: object.Key, Size: object.Size, ModTime: object.LastModified}
+}
+
+// s3Error maps missing objects to ErrNotFound
+func s3Error(err error) error {
+	if err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
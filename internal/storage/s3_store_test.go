@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestS3Store connects to the MinIO server at S3_TEST_ENDPOINT, e.g. one started with
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//
+// and creates a bucket for the test, which is removed afterwards
+func newTestS3Store(t *testing.T, presignExpiry time.Duration) *S3Store {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("Skipping S3 test. Set S3_TEST_ENDPOINT to the address of a MinIO server to run it.")
+	}
+
+	cfg := &config.Config{
+		S3Endpoint:      endpoint,
+		S3Bucket:        fmt.Sprintf("youtube-downloader-test-%d", time.Now().UnixNano()),
+		S3AccessKey:     getEnv("S3_TEST_ACCESS_KEY", "minioadmin"),
+		S3SecretKey:     getEnv("S3_TEST_SECRET_KEY", "minioadmin"),
+		S3PresignExpiry: presignExpiry,
+	}
+	store, err := NewS3Store(context.Background(), cfg)
+	require.NoError(t, err)
+
+	s3Store := store.(*S3Store)
+	t.Cleanup(func() {
+		ctx := context.Background()
+		objects, _ := s3Store.List(ctx)
+		for _, object := range objects {
+			s3Store.Delete(ctx, object.Key)
+		}
+		s3Store.client.RemoveBucket(ctx, s3Store.bucket)
+	})
+	return s3Store
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func TestS3Store(t *testing.T) {
+	testStoreContract(t, newTestS3Store(t, 0), t.TempDir())
+}
+
+// Uploaded files don't take up local disk space
+func TestS3StorePutRemovesLocalFile(t *testing.T) {
+	store := newTestS3Store(t, 0)
+	localPath := t.TempDir() + "/video_0123456789abcdef.mp4"
+	require.NoError(t, os.WriteFile(localPath, []byte("video"), 0644))
+
+	require.NoError(t, store.Put(context.Background(), "video_0123456789abcdef.mp4", localPath))
+	assert.NoFileExists(t, localPath)
+
+	objectInfo, err := store.client.StatObject(context.Background(), store.bucket, "video_0123456789abcdef.mp4", minio.StatObjectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "video/mp4", objectInfo.ContentType)
+}
+
+func TestS3StorePresignedURL(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := newTestS3Store(t, 0).PresignedURL(ctx, "video.mp4", "attachment")
+	assert.ErrorIs(t, err, ErrNoPresignedURL)
+
+	store := newTestS3Store(t, time.Minute)
+	localPath := t.TempDir() + "/video.mp4"
+	require.NoError(t, os.WriteFile(localPath, []byte("video"), 0644))
+	require.NoError(t, store.Put(ctx, "video.mp4", localPath))
+
+	presignedURL, err := store.PresignedURL(ctx, "video.mp4", `attachment; filename="Test Video.mp4"`)
+	require.NoError(t, err)
+
+	resp, err := http.Get(presignedURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `attachment; filename="Test Video.mp4"`, resp.Header.Get("Content-Disposition"))
+}
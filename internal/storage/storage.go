@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"time"
+)
+
+// Names of the storage backends, as used in the STORAGE_BACKEND setting
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+var (
+	// ErrNotFound is returned for keys the store has no file for
+	ErrNotFound = errors.New("file not found in storage")
+	// ErrNoPresignedURL is returned by stores that can't hand out direct links to their files,
+	// so the server has to stream them itself
+	ErrNoPresignedURL = errors.New("storage does not support presigned URLs")
+)
+
+// ObjectInfo describes a stored file
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// StoreInterface defines the contract for the place finished downloads are kept.
+// Files are stored under their file name (see Key), yt-dlp always writes them to the local
+// output directory first and Put moves them into the store.
+type StoreInterface interface {
+	// Put moves the finished file at localPath into the store under key
+	Put(ctx context.Context, key string, localPath string) error
+	// Open returns the content of a file, which must be closed after use
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	Rename(ctx context.Context, oldKey string, newKey string) error
+	List(ctx context.Context) ([]ObjectInfo, error)
+	// PresignedURL returns a temporary link downloading the file directly from the store,
+	// with the given Content-Disposition header
+	PresignedURL(ctx context.Context, key string, contentDisposition string) (string, error)
+}
+
+// Key returns the storage key of a file. The rest of the application refers to files by their
+// path in the output directory, so task results and Redis keys are the same for every backend.
+func Key(filePath string) string {
+	return filepath.Base(filePath)
+}
+
+// New creates the store selected by STORAGE_BACKEND
+func New(ctx context.Context, config *config.Config) (StoreInterface, error) {
+	switch config.StorageBackend {
+	case "", BackendLocal:
+		return NewLocalStore(config.OutputDir), nil
+	case BackendS3:
+		return NewS3Store(ctx, config)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (supported: %s, %s)", config.StorageBackend, BackendLocal, BackendS3)
+	}
+}
@@ -0,0 +1,157 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+const TypePlaylistDownload = "playlist:download"
+
+// PlaylistDownloadPayload is the state of a playlist task. The task itself only expands the
+// playlist: every video is downloaded by its own video:download child task listed in Items.
+type PlaylistDownloadPayload struct {
+	URL      string                   `json:"url"`
+	Options  services.DownloadOptions `json:"options"`
+	Timeout  string                   `json:"timeout,omitempty"` // Timeout of each video download
+	Status   TaskStatus               `json:"status"`            // Completed once every child task has been enqueued
+	Error    string                   `json:"error,omitempty"`
+	Title    string                   `json:"title,omitempty"`
+	Items    []PlaylistItem           `json:"items,omitempty"`
+	Skipped  []PlaylistItem           `json:"skipped,omitempty"`    // Videos not downloaded because the API key used up its daily quota
+	APIKeyID string                   `json:"api_key_id,omitempty"` // API key that submitted the task, recorded on every video task too
+}
+
+// PlaylistItem links a playlist entry to the task downloading it
+type PlaylistItem struct {
+	TaskID string `json:"task_id,omitempty"` // Empty for skipped videos
+	URL    string `json:"url"`
+	Title  string `json:"title,omitempty"`
+}
+
+// NewPlaylistDownloadTask creates a task that downloads every video of a playlist
+// in the given format, allowing each video to run for up to timeout.
+// apiKeyID records the API key that submitted it, if any.
+func NewPlaylistDownloadTask(url string, opts services.DownloadOptions, timeout time.Duration, apiKeyID string) (*asynq.Task, error) {
+	payload := PlaylistDownloadPayload{
+		URL:      url,
+		Options:  opts,
+		Timeout:  timeout.String(),
+		Status:   TaskStatusPending,
+		APIKeyID: apiKeyID,
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TypePlaylistDownload, data), nil
+}
+
+// PlaylistItemTaskID returns the ID of the child task downloading the entry at index.
+// The IDs are derived from the playlist task so a retried expansion doesn't enqueue duplicates.
+func PlaylistItemTaskID(playlistTaskID string, index int) string {
+	return fmt.Sprintf("%s-%d", playlistTaskID, index+1)
+}
+
+type PlaylistDownloadProcessor struct {
+	config         *config.Config
+	youtubeService services.YouTubeServiceInterface
+	enqueuer       *VideoEnqueuer
+}
+
+func NewPlaylistDownloadProcessor(config *config.Config, youtubeService services.YouTubeServiceInterface, enqueuer *VideoEnqueuer) *PlaylistDownloadProcessor {
+	return &PlaylistDownloadProcessor{
+		config:         config,
+		youtubeService: youtubeService,
+		enqueuer:       enqueuer,
+	}
+}
+
+func (processor *PlaylistDownloadProcessor) ProcessTask(ctx context.Context, t *asynq.Task) error {
+	var p PlaylistDownloadPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		log.Printf("Error unmarshaling playlist payload: %v", err)
+		return fmt.Errorf("failed to unmarshal payload: %v", err)
+	}
+	taskID := t.ResultWriter().TaskID()
+
+	p.Status = TaskStatusProcessing
+	processor.saveState(t, &p)
+
+	log.Printf("Listing playlist %s...", p.URL)
+	playlist, err := processor.youtubeService.ListPlaylist(ctx, p.URL, processor.config.MaxPlaylistItems)
+	if err != nil {
+		log.Printf("Error listing playlist: %v", err)
+		p.Status = TaskStatusFailed
+		p.Error = err.Error()
+		processor.saveState(t, &p)
+		return fmt.Errorf("failed to list playlist: %v", err)
+	}
+
+	timeout, err := time.ParseDuration(p.Timeout)
+	if err != nil {
+		timeout = processor.config.DownloadTimeout
+	}
+
+	// Every video counts against the daily download quota of the key that submitted the playlist
+	apiKey, err := processor.enqueuer.LoadAPIKey(ctx, p.APIKeyID)
+	if err != nil {
+		p.Status = TaskStatusFailed
+		p.Error = err.Error()
+		processor.saveState(t, &p)
+		return err
+	}
+
+	p.Title = playlist.Title
+	p.Items = make([]PlaylistItem, 0, len(playlist.Entries))
+	p.Skipped = nil
+	for i, entry := range playlist.Entries {
+		// Videos already being downloaded, e.g. requested on their own, are shared with their task
+		enqueued, err := processor.enqueuer.Enqueue(ctx, PlaylistItemTaskID(taskID, i), entry.URL, p.Options, timeout, apiKey)
+		var quotaErr *services.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			for _, skipped := range playlist.Entries[i:] {
+				p.Skipped = append(p.Skipped, PlaylistItem{URL: skipped.URL, Title: skipped.Title})
+			}
+			p.Error = fmt.Sprintf("%d videos skipped: API key %v", len(p.Skipped), quotaErr)
+			log.Printf("Playlist over quota: ID=%s, Skipped=%d, Error=%v", taskID, len(p.Skipped), quotaErr)
+			break
+		}
+		if err != nil {
+			// Already enqueued items keep their IDs, so the retry picks up where this attempt stopped
+			return err
+		}
+
+		p.Items = append(p.Items, PlaylistItem{
+			TaskID: enqueued.TaskID,
+			URL:    entry.URL,
+			Title:  entry.Title,
+		})
+	}
+
+	log.Printf("Playlist expanded: ID=%s, Title=%q, Videos=%d", taskID, p.Title, len(p.Items))
+	p.Status = TaskStatusCompleted
+	processor.saveState(t, &p)
+	return nil
+}
+
+// saveState writes the payload as the task result
+func (processor *PlaylistDownloadProcessor) saveState(t *asynq.Task, p *PlaylistDownloadPayload) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("Error marshaling playlist state: %v", err)
+		return
+	}
+	if _, err := t.ResultWriter().Write(data); err != nil {
+		log.Printf("Error writing playlist state: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package tasks
+
+import (
+	"encoding/json"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPlaylistDownloadTask(t *testing.T) {
+	testURL := "https://www.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf"
+	testOptions := services.DownloadOptions{Mode: services.ModeAudio}
+
+	task, err := NewPlaylistDownloadTask(testURL, testOptions, 20*time.Minute, "key")
+	require.NoError(t, err)
+	assert.Equal(t, TypePlaylistDownload, task.Type())
+
+	var payload PlaylistDownloadPayload
+	require.NoError(t, json.Unmarshal(task.Payload(), &payload))
+	assert.Equal(t, testURL, payload.URL)
+	assert.Equal(t, testOptions, payload.Options)
+	assert.Equal(t, "20m0s", payload.Timeout)
+	assert.Equal(t, "key", payload.APIKeyID)
+	assert.Equal(t, TaskStatusPending, payload.Status)
+	assert.Empty(t, payload.Items)
+}
+
+func TestPlaylistItemTaskID(t *testing.T) {
+	assert.Equal(t, "abc-1", PlaylistItemTaskID("abc", 0))
+	assert.Equal(t, "abc-12", PlaylistItemTaskID("abc", 11))
+}
+
+func TestNewPlaylistDownloadProcessor(t *testing.T) {
+	cfg := &config.Config{MaxPlaylistItems: 10}
+	mockService := &mockYouTubeService{}
+
+	processor := NewPlaylistDownloadProcessor(cfg, mockService, nil)
+
+	assert.NotNil(t, processor)
+	assert.Equal(t, cfg, processor.config)
+	assert.Equal(t, mockService, processor.youtubeService)
+}
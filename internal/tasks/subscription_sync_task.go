@@ -0,0 +1,228 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// TypeSubscriptionSyncAll is enqueued periodically by the scheduler and fans out one sync per subscription
+	TypeSubscriptionSyncAll = "subscription:sync_all"
+
+	// TypeSubscriptionSync checks a single subscription for new uploads
+	TypeSubscriptionSync = "subscription:sync"
+)
+
+type SubscriptionSyncPayload struct {
+	SubscriptionID string `json:"subscription_id"`
+}
+
+// NewSubscriptionSyncAllTask creates the periodic task syncing every subscription
+func NewSubscriptionSyncAllTask() *asynq.Task {
+	return asynq.NewTask(TypeSubscriptionSyncAll, nil)
+}
+
+// NewSubscriptionSyncTask creates a task checking a subscription for new uploads
+func NewSubscriptionSyncTask(subscriptionID string) (*asynq.Task, error) {
+	data, err := json.Marshal(SubscriptionSyncPayload{SubscriptionID: subscriptionID})
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask(TypeSubscriptionSync, data), nil
+}
+
+type SubscriptionSyncProcessor struct {
+	config              *config.Config
+	youtubeService      services.YouTubeServiceInterface
+	subscriptionService services.SubscriptionServiceInterface
+	client              *asynq.Client
+	enqueuer            *VideoEnqueuer
+}
+
+func NewSubscriptionSyncProcessor(
+	config *config.Config,
+	youtubeService services.YouTubeServiceInterface,
+	subscriptionService services.SubscriptionServiceInterface,
+	client *asynq.Client,
+	enqueuer *VideoEnqueuer,
+) *SubscriptionSyncProcessor {
+	return &SubscriptionSyncProcessor{
+		config:              config,
+		youtubeService:      youtubeService,
+		subscriptionService: subscriptionService,
+		client:              client,
+		enqueuer:            enqueuer,
+	}
+}
+
+// ProcessSyncAll enqueues a sync of every subscription
+func (processor *SubscriptionSyncProcessor) ProcessSyncAll(ctx context.Context, t *asynq.Task) error {
+	subscriptions, err := processor.subscriptionService.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		task, err := NewSubscriptionSyncTask(subscription.ID)
+		if err != nil {
+			return fmt.Errorf("failed to create sync task: %v", err)
+		}
+		// A subscription is synced at most once per interval, even if the previous sync is still queued
+		_, err = processor.client.EnqueueContext(ctx, task, asynq.Unique(processor.config.SubscriptionSync))
+		if err != nil && !errors.Is(err, asynq.ErrDuplicateTask) {
+			log.Printf("Error enqueuing subscription sync: ID=%s, Error=%v", subscription.ID, err)
+		}
+	}
+
+	log.Printf("Enqueued sync of %d subscriptions", len(subscriptions))
+	return nil
+}
+
+// ProcessSync lists a subscription's channel or playlist and enqueues a download of every
+// upload that matches its filters and isn't in its download archive yet
+func (processor *SubscriptionSyncProcessor) ProcessSync(ctx context.Context, t *asynq.Task) error {
+	var p SubscriptionSyncPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %v: %w", err, asynq.SkipRetry)
+	}
+
+	subscription, err := processor.subscriptionService.GetSubscription(ctx, p.SubscriptionID)
+	if err == services.ErrSubscriptionNotFound {
+		log.Printf("Skipping sync of deleted subscription: ID=%s", p.SubscriptionID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// The first sync only records what the channel or playlist already has, so subscribing doesn't
+	// download its whole back catalogue
+	firstSync := subscription.LastSync == nil
+
+	sync := &services.SubscriptionSync{At: time.Now().UTC()}
+	err = processor.enqueueNewUploads(ctx, subscription, firstSync, sync)
+	if err != nil {
+		sync.Error = err.Error()
+	}
+
+	// A first sync that failed before enqueuing anything isn't recorded, so the next one is a first sync again
+	if err == nil || !firstSync || len(sync.TaskIDs) > 0 {
+		if saveErr := processor.subscriptionService.SaveSubscriptionSync(ctx, subscription.ID, sync); saveErr != nil {
+			log.Printf("Error saving subscription sync: ID=%s, Error=%v", subscription.ID, saveErr)
+		}
+	}
+	if err != nil {
+		log.Printf("Error syncing subscription: ID=%s, Error=%v", subscription.ID, err)
+		return err
+	}
+
+	log.Printf("Subscription synced: ID=%s, URL=%s, New downloads=%d", subscription.ID, subscription.URL, len(sync.TaskIDs))
+	return nil
+}
+
+// enqueueNewUploads enqueues the downloads of a subscription's new uploads and records their task IDs
+// in sync. On the first sync, uploads from before the subscription was created are archived without
+// downloading. Once the subscription's API key used up its daily download quota, the remaining new
+// uploads are recorded as skipped and left for a later sync.
+func (processor *SubscriptionSyncProcessor) enqueueNewUploads(ctx context.Context, subscription *services.Subscription, firstSync bool, sync *services.SubscriptionSync) error {
+	match, err := subscription.Filters.Matcher()
+	if err != nil {
+		return err
+	}
+
+	apiKey, err := processor.enqueuer.LoadAPIKey(ctx, subscription.APIKeyID)
+	if err != nil {
+		return err
+	}
+
+	playlist, err := processor.youtubeService.ListPlaylist(ctx, subscription.URL, processor.config.MaxPlaylistItems)
+	if err != nil {
+		return err
+	}
+
+	if firstSync {
+		for _, entry := range playlist.Entries {
+			if !uploadedBefore(entry, subscription.CreatedAt) {
+				continue
+			}
+			if _, err := processor.subscriptionService.ArchiveVideo(ctx, subscription.ID, entry.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	now := time.Now()
+	var quotaErr *services.QuotaExceededError
+	for _, entry := range playlist.Entries {
+		if !match(entry, now) {
+			continue
+		}
+
+		if quotaErr != nil {
+			archived, err := processor.subscriptionService.IsArchived(ctx, subscription.ID, entry.ID)
+			if err != nil {
+				return err
+			}
+			if !archived {
+				sync.Skipped = append(sync.Skipped, entry.URL)
+			}
+			continue
+		}
+
+		// Archive before enqueuing, so concurrent syncs can't download the same video twice
+		isNew, err := processor.subscriptionService.ArchiveVideo(ctx, subscription.ID, entry.ID)
+		if err != nil {
+			return err
+		}
+		if !isNew {
+			continue
+		}
+
+		taskID, err := processor.enqueueDownload(ctx, subscription, apiKey, entry)
+		if err != nil {
+			// Forget the video so the next sync tries again
+			if err := processor.subscriptionService.UnarchiveVideo(ctx, subscription.ID, entry.ID); err != nil {
+				log.Printf("Error unarchiving video: ID=%s, Video=%s, Error=%v", subscription.ID, entry.ID, err)
+			}
+			if errors.As(err, &quotaErr) {
+				sync.Skipped = append(sync.Skipped, entry.URL)
+				continue
+			}
+			return err
+		}
+		sync.TaskIDs = append(sync.TaskIDs, taskID)
+	}
+
+	if quotaErr != nil {
+		log.Printf("Subscription over quota: ID=%s, Skipped=%d, Error=%v", subscription.ID, len(sync.Skipped), quotaErr)
+		sync.Error = fmt.Sprintf("%d uploads skipped: API key %v", len(sync.Skipped), quotaErr)
+	}
+	return nil
+}
+
+// uploadedBefore reports whether an entry was uploaded before the given time.
+// Entries without an upload date are assumed to be, since most of a listing is older uploads.
+func uploadedBefore(entry services.PlaylistEntry, t time.Time) bool {
+	return !entry.UploadedAt.After(t)
+}
+
+// enqueueDownload enqueues a normal download task for a subscription's upload, or attaches to the
+// task already downloading it
+func (processor *SubscriptionSyncProcessor) enqueueDownload(ctx context.Context, subscription *services.Subscription, apiKey *services.APIKey, entry services.PlaylistEntry) (string, error) {
+	enqueued, err := processor.enqueuer.Enqueue(ctx, uuid.NewString(), entry.URL, subscription.Options, processor.config.DownloadTimeout, apiKey)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("Subscription download enqueued: ID=%s, Subscription=%s, URL=%s, Attached=%t", enqueued.TaskID, subscription.ID, entry.URL, enqueued.Attached)
+	return enqueued.TaskID, nil
+}
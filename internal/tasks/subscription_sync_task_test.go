@@ -0,0 +1,49 @@
+package tasks
+
+import (
+	"encoding/json"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSubscriptionSyncTask(t *testing.T) {
+	task, err := NewSubscriptionSyncTask("abc123")
+	require.NoError(t, err)
+	assert.Equal(t, TypeSubscriptionSync, task.Type())
+
+	var payload SubscriptionSyncPayload
+	require.NoError(t, json.Unmarshal(task.Payload(), &payload))
+	assert.Equal(t, "abc123", payload.SubscriptionID)
+}
+
+func TestNewSubscriptionSyncAllTask(t *testing.T) {
+	task := NewSubscriptionSyncAllTask()
+	assert.Equal(t, TypeSubscriptionSyncAll, task.Type())
+	assert.Empty(t, task.Payload())
+}
+
+func TestUploadedBefore(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		uploadedAt time.Time
+		want       bool
+	}{
+		{"Older upload", createdAt.Add(-48 * time.Hour), true},
+		{"Uploaded at creation", createdAt, true},
+		{"Newer upload", createdAt.Add(time.Hour), false},
+		{"Unknown upload date", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := services.PlaylistEntry{ID: "dQw4w9WgXcQ", UploadedAt: tt.uploadedAt}
+			assert.Equal(t, tt.want, uploadedBefore(entry, createdAt))
+		})
+	}
+}
@@ -2,11 +2,33 @@ package tasks
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"time"
 
 	"github.com/hibiken/asynq"
 )
 
+// IsFailure reports whether a task error counts as a failure, used as the asynq server's
+// IsFailure. Downloads held back by the outbound limits didn't fail, so they are retried without
+// using up an attempt.
+func IsFailure(err error) bool {
+	var wait *services.OutboundWaitError
+	return !errors.As(err, &wait)
+}
+
+// RetryDelay returns how long a task waits before it is retried, used as the asynq server's
+// RetryDelayFunc. Downloads held back by the outbound limits are retried once the limits let them
+// start, other tasks after asynq's default backoff.
+func RetryDelay(n int, err error, task *asynq.Task) time.Duration {
+	var wait *services.OutboundWaitError
+	if errors.As(err, &wait) {
+		return wait.RetryAfter
+	}
+	return asynq.DefaultRetryDelayFunc(n, err, task)
+}
+
 // LogTaskInfo logs detailed information about a task including its payload and result
 func LogTaskInfo(info *asynq.TaskInfo) {
 	var payloadData, resultData map[string]interface{}
@@ -3,8 +3,11 @@ package tasks
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"spiropoulos94/youtube-downloader/internal/services"
 	"strings"
 	"testing"
 	"time"
@@ -78,3 +81,22 @@ func TestLogTaskInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestRetryOutboundWait(t *testing.T) {
+	wait := fmt.Errorf("download failed: %w", &services.OutboundWaitError{Reason: "downloads are paused", RetryAfter: 90 * time.Second})
+	other := errors.New("download failed")
+	task := asynq.NewTask(TypeVideoDownload, nil)
+
+	if IsFailure(wait) {
+		t.Error("IsFailure() = true for a download held back by the outbound limits")
+	}
+	if !IsFailure(other) {
+		t.Error("IsFailure() = false for a failed download")
+	}
+	if delay := RetryDelay(3, wait, task); delay != 90*time.Second {
+		t.Errorf("RetryDelay() = %s, want 1m30s", delay)
+	}
+	if delay := RetryDelay(3, other, task); delay <= 0 {
+		t.Errorf("RetryDelay() = %s, want asynq's backoff", delay)
+	}
+}
@@ -3,10 +3,12 @@ package tasks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"spiropoulos94/youtube-downloader/internal/config"
 	"spiropoulos94/youtube-downloader/internal/services"
 	"strings"
 	"time"
@@ -16,6 +18,9 @@ import (
 
 const TypeVideoDownload = "video:download"
 
+// progressWriteInterval limits how often download progress is written to the task result
+const progressWriteInterval = time.Second
+
 // TaskStatus represents the current state of a video download task
 type TaskStatus string
 
@@ -25,22 +30,37 @@ const (
 	TaskStatusProcessing TaskStatus = "processing" // Task is being processed
 	TaskStatusCompleted  TaskStatus = "completed"  // Task has been completed successfully
 	TaskStatusFailed     TaskStatus = "failed"     // Task failed to complete
+	TaskStatusCancelled  TaskStatus = "cancelled"  // Task was cancelled by a user
 )
 
+// IsTerminal reports whether the task will not change state anymore
+func (s TaskStatus) IsTerminal() bool {
+	return s == TaskStatusCompleted || s == TaskStatusFailed || s == TaskStatusCancelled
+}
+
 type VideoDownloadPayload struct {
-	URL          string     `json:"url"`
-	FilePath     string     `json:"file_path,omitempty"`
-	Status       TaskStatus `json:"status"`
-	Error        string     `json:"error,omitempty"`
-	Title        string     `json:"title,omitempty"`
-	ThumbnailURL string     `json:"thumbnail_url,omitempty"`
-	Duration     string     `json:"duration,omitempty"`
+	URL          string                   `json:"url"`
+	Options      services.DownloadOptions `json:"options"`
+	FilePath     string                   `json:"file_path,omitempty"`
+	Status       TaskStatus               `json:"status"`
+	Error        string                   `json:"error,omitempty"`
+	Title        string                   `json:"title,omitempty"`
+	ThumbnailURL string                   `json:"thumbnail_url,omitempty"`
+	Duration     string                   `json:"duration,omitempty"`
+	Progress     *services.Progress       `json:"progress,omitempty"`
+	Timeout      string                   `json:"timeout,omitempty"`    // How long the download may run, e.g. "1h0m0s"
+	APIKeyID     string                   `json:"api_key_id,omitempty"` // API key that submitted the task, if authentication is enabled
 }
 
-func NewVideoDownloadTask(url string) (*asynq.Task, error) {
+// NewVideoDownloadTask creates a download task that is killed if it runs longer than timeout.
+// apiKeyID records the API key that submitted it, if any.
+func NewVideoDownloadTask(url string, opts services.DownloadOptions, timeout time.Duration, apiKeyID string) (*asynq.Task, error) {
 	payload := VideoDownloadPayload{
-		URL:    url,
-		Status: TaskStatusPending,
+		URL:      url,
+		Options:  opts,
+		Status:   TaskStatusPending,
+		Timeout:  timeout.String(),
+		APIKeyID: apiKeyID,
 	}
 
 	data, err := json.Marshal(payload)
@@ -48,19 +68,62 @@ func NewVideoDownloadTask(url string) (*asynq.Task, error) {
 		return nil, err
 	}
 
-	task := asynq.NewTask(TypeVideoDownload, data)
+	task := asynq.NewTask(TypeVideoDownload, data, asynq.Timeout(timeout))
 
 	return task, nil
 }
 
 type VideoDownloadProcessor struct {
+	config         *config.Config
 	youtubeService services.YouTubeServiceInterface
+	taskService    services.TaskServiceInterface
 }
 
-func NewVideoDownloadProcessor(youtubeService services.YouTubeServiceInterface) *VideoDownloadProcessor {
+func NewVideoDownloadProcessor(config *config.Config, youtubeService services.YouTubeServiceInterface, taskService services.TaskServiceInterface) *VideoDownloadProcessor {
 	return &VideoDownloadProcessor{
+		config:         config,
 		youtubeService: youtubeService,
+		taskService:    taskService,
+	}
+}
+
+// isCancelled reports whether the task's context was cancelled through the API
+func (processor *VideoDownloadProcessor) isCancelled(ctx context.Context, t *asynq.Task) bool {
+	if ctx.Err() != context.Canceled {
+		return false
+	}
+	data, err := processor.taskService.GetFinalTaskState(context.WithoutCancel(ctx), t.ResultWriter().TaskID())
+	if err != nil {
+		log.Printf("Error checking cancelled state: %v", err)
+		return false
+	}
+
+	var p VideoDownloadPayload
+	return data != nil && json.Unmarshal(data, &p) == nil && p.Status == TaskStatusCancelled
+}
+
+// saveState writes the payload as the task result and publishes it to anyone streaming the task's events
+func (processor *VideoDownloadProcessor) saveState(ctx context.Context, t *asynq.Task, p *VideoDownloadPayload) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task state: %v", err)
+	}
+
+	if ctx.Err() != nil {
+		// asynq refuses result writes once the task context is done, so keep the state next to the task
+		err = processor.taskService.SaveFinalTaskState(context.WithoutCancel(ctx), t.ResultWriter().TaskID(), data, processor.config.TaskRetention)
+	} else {
+		_, err = t.ResultWriter().Write(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Publish even if the task context is done, so watchers still learn the final state
+	if err := processor.taskService.PublishTaskEvent(context.WithoutCancel(ctx), t.ResultWriter().TaskID(), data); err != nil {
+		log.Printf("Error publishing task event: %v", err)
 	}
+	return nil
 }
 
 // isTemporaryFile checks if a file is a temporary file created by yt-dlp
@@ -84,8 +147,9 @@ func isTemporaryFile(fileName string) bool {
 	return false
 }
 
-// waitForFileRename waits for temporary files to be processed and returns the final file path
-func waitForFileRename(ctx context.Context, tempFilePath string, urlHash string) (string, error) {
+// waitForFileRename waits for temporary files to be processed and returns the final file path.
+// ext is the extension (without the dot) the finished file is expected to have.
+func waitForFileRename(ctx context.Context, tempFilePath string, urlHash string, ext string) (string, error) {
 	dir := filepath.Dir(tempFilePath)
 	maxWaitTime := 5 * time.Minute
 	checkInterval := 500 * time.Millisecond
@@ -104,7 +168,7 @@ func waitForFileRename(ctx context.Context, tempFilePath string, urlHash string)
 				return "", fmt.Errorf("timeout waiting for file processing after %v", maxWaitTime)
 			}
 
-			// Look for both temporary files and the final MP4
+			// Look for both temporary files and the final file
 			files, err := os.ReadDir(dir)
 			if err != nil {
 				log.Printf("Error reading directory: %v", err)
@@ -118,7 +182,7 @@ func waitForFileRename(ctx context.Context, tempFilePath string, urlHash string)
 			for _, file := range files {
 				fileName := file.Name()
 				if strings.Contains(fileName, urlHash) {
-					if strings.HasSuffix(fileName, ".mp4") && !isTemporaryFile(fileName) {
+					if strings.HasSuffix(fileName, urlHash+"."+ext) {
 						finalFile = fileName
 						break
 					} else if isTemporaryFile(fileName) {
@@ -148,33 +212,72 @@ func waitForFileRename(ctx context.Context, tempFilePath string, urlHash string)
 	}
 }
 
-func (processor *VideoDownloadProcessor) ProcessTask(ctx context.Context, t *asynq.Task) error {
+func (processor *VideoDownloadProcessor) ProcessTask(ctx context.Context, t *asynq.Task) (err error) {
 	var p VideoDownloadPayload
 	if err := json.Unmarshal(t.Payload(), &p); err != nil {
 		log.Printf("Error unmarshaling payload: %v", err)
 		return fmt.Errorf("failed to unmarshal payload: %v", err)
 	}
 
+	// Once the task won't run again, new requests for the video must start a new download. Tasks
+	// held back by the outbound limits run again whatever their attempt.
+	defer func() {
+		if IsFailure(err) && (err == nil || errors.Is(err, asynq.SkipRetry) || isLastAttempt(ctx)) {
+			processor.releaseInFlight(ctx, t, &p)
+		}
+	}()
+
 	log.Printf("Processing task...")
 	log.Printf("Task payload: %s", string(t.Payload()))
 
 	// Update status to processing
 	p.Status = TaskStatusProcessing
-	data, _ := json.Marshal(p)
-	if _, err := t.ResultWriter().Write(data); err != nil {
+	if err := processor.saveState(ctx, t, &p); err != nil {
 		log.Printf("Error writing processing state: %v", err)
 	}
 
-	log.Printf("Downloading video from %s...", p.URL)
+	log.Printf("Downloading video from %s (format: %q)...", p.URL, p.Options.CacheKey())
+
+	// Write progress to the task result as yt-dlp reports it, throttled so Redis isn't flooded
+	var lastProgressWrite time.Time
+	onProgress := func(progress services.Progress) {
+		phaseChanged := p.Progress == nil || p.Progress.Phase != progress.Phase
+		p.Progress = &progress
+		if !phaseChanged && time.Since(lastProgressWrite) < progressWriteInterval {
+			return
+		}
+		lastProgressWrite = time.Now()
+		if err := processor.saveState(ctx, t, &p); err != nil {
+			log.Printf("Error writing progress: %v", err)
+		}
+	}
 
 	// Download video, which now also returns metadata
-	videoData, err := processor.youtubeService.DownloadVideo(p.URL)
+	videoData, err := processor.youtubeService.DownloadVideo(ctx, p.URL, p.Options, onProgress)
+	if err != nil && processor.isCancelled(ctx, t) {
+		// The API already recorded the cancelled state, and retrying would restart the download
+		log.Printf("Download cancelled: ID=%s", t.ResultWriter().TaskID())
+		return fmt.Errorf("download cancelled: %w", asynq.SkipRetry)
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return processor.timedOut(ctx, t, &p)
+	}
+	var wait *services.OutboundWaitError
+	if errors.As(err, &wait) {
+		// Back to the queue until the outbound limits let the download start, on a fresh deadline
+		log.Printf("Download held back by the outbound limits: ID=%s, Reason=%v", t.ResultWriter().TaskID(), wait)
+		p.Status = TaskStatusPending
+		p.Progress = nil
+		if err := processor.saveState(ctx, t, &p); err != nil {
+			log.Printf("Error writing pending state: %v", err)
+		}
+		return err
+	}
 	if err != nil {
 		log.Printf("Error downloading video: %v", err)
 		p.Status = TaskStatusFailed
 		p.Error = err.Error()
-		data, _ := json.Marshal(p)
-		if _, err := t.ResultWriter().Write(data); err != nil {
+		if err := processor.saveState(ctx, t, &p); err != nil {
 			log.Printf("Error writing failed state: %v", err)
 		}
 		return fmt.Errorf("failed to download video: %v", err)
@@ -187,16 +290,20 @@ func (processor *VideoDownloadProcessor) ProcessTask(ctx context.Context, t *asy
 
 	filePath := videoData.FilePath
 
-	// If the file is a temporary file, wait for it to be processed
-	if isTemporaryFile(filePath) {
-		urlHash := processor.youtubeService.GetURLHash(p.URL)
-		finalPath, err := waitForFileRename(ctx, filePath, urlHash)
+	// If the file is a temporary file, wait for it to be processed.
+	// Audio downloads can legitimately end in an extension that is temporary for videos (e.g. .m4a).
+	ext := p.Options.Extension()
+	if isTemporaryFile(filePath) && filepath.Ext(filePath) != "."+ext {
+		urlHash := processor.youtubeService.GetURLHash(p.URL, p.Options)
+		finalPath, err := waitForFileRename(ctx, filePath, urlHash, ext)
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			return processor.timedOut(ctx, t, &p)
+		}
 		if err != nil {
 			log.Printf("Error waiting for file processing: %v", err)
 			p.Status = TaskStatusFailed
 			p.Error = fmt.Sprintf("Failed to complete download: %v", err)
-			data, _ := json.Marshal(p)
-			if _, err := t.ResultWriter().Write(data); err != nil {
+			if err := processor.saveState(ctx, t, &p); err != nil {
 				log.Printf("Error writing failed state: %v", err)
 			}
 			return fmt.Errorf("failed to wait for file processing: %v", err)
@@ -207,11 +314,39 @@ func (processor *VideoDownloadProcessor) ProcessTask(ctx context.Context, t *asy
 	log.Printf("Successfully got video at %s", filePath)
 	p.Status = TaskStatusCompleted
 	p.FilePath = filePath
-	data, _ = json.Marshal(p)
-	if _, err := t.ResultWriter().Write(data); err != nil {
+	if err := processor.saveState(ctx, t, &p); err != nil {
 		log.Printf("Error writing completed state: %v", err)
 		return err
 	}
 
 	return nil
 }
+
+// isLastAttempt reports whether asynq will archive the task instead of retrying it if it fails
+func isLastAttempt(ctx context.Context) bool {
+	retried, ok := asynq.GetRetryCount(ctx)
+	maxRetry, maxOk := asynq.GetMaxRetry(ctx)
+	return ok && maxOk && retried >= maxRetry
+}
+
+// releaseInFlight releases the task's claim on its video, taken when the API enqueued it
+func (processor *VideoDownloadProcessor) releaseInFlight(ctx context.Context, t *asynq.Task, p *VideoDownloadPayload) {
+	urlHash := processor.youtubeService.GetURLHash(p.URL, p.Options)
+	if err := processor.taskService.ReleaseInFlightTask(context.WithoutCancel(ctx), urlHash, t.ResultWriter().TaskID()); err != nil {
+		log.Printf("Error releasing in-flight task: %v", err)
+	}
+}
+
+// timedOut marks the task as failed because it ran longer than its timeout.
+// yt-dlp has already been killed through the task context at this point.
+func (processor *VideoDownloadProcessor) timedOut(ctx context.Context, t *asynq.Task, p *VideoDownloadPayload) error {
+	log.Printf("Download timed out after %s: ID=%s, URL=%s", p.Timeout, t.ResultWriter().TaskID(), p.URL)
+	p.Status = TaskStatusFailed
+	p.Error = fmt.Sprintf("Download timed out after %s", p.Timeout)
+	p.Progress = nil
+	if err := processor.saveState(ctx, t, p); err != nil {
+		log.Printf("Error writing timed out state: %v", err)
+	}
+	// Retrying would most likely hang again, and would hide the timeout from the status
+	return fmt.Errorf("download timed out after %s: %w", p.Timeout, asynq.SkipRetry)
+}
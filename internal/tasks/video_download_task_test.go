@@ -1,9 +1,12 @@
 package tasks
 
 import (
+	"context"
 	"encoding/json"
+	"spiropoulos94/youtube-downloader/internal/config"
 	"spiropoulos94/youtube-downloader/internal/services"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -14,11 +17,18 @@ type mockYouTubeService struct {
 	services.YouTubeServiceInterface
 }
 
+// Create a mock implementation of TaskServiceInterface for testing
+type mockTaskService struct {
+	services.TaskServiceInterface
+}
+
 func TestNewVideoDownloadTask(t *testing.T) {
 	testURL := "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
 
+	testOptions := services.DownloadOptions{MaxHeight: 720, VideoCodec: services.VideoCodecH264}
+
 	// Create task
-	task, err := NewVideoDownloadTask(testURL)
+	task, err := NewVideoDownloadTask(testURL, testOptions, 30*time.Minute, "key")
 
 	// Assert no error occurred
 	require.NoError(t, err)
@@ -33,21 +43,29 @@ func TestNewVideoDownloadTask(t *testing.T) {
 
 	// Verify payload fields
 	assert.Equal(t, testURL, payload.URL)
+	assert.Equal(t, testOptions, payload.Options)
 	assert.Equal(t, TaskStatusPending, payload.Status)
+	assert.Equal(t, "30m0s", payload.Timeout)
+	assert.Equal(t, "key", payload.APIKeyID)
 	assert.Empty(t, payload.FilePath)
 	assert.Empty(t, payload.Error)
 }
 
 func TestNewVideoDownloadProcessor(t *testing.T) {
-	// Create a mock YouTube service
+	// Create mock services
 	mockService := &mockYouTubeService{}
+	mockTasks := &mockTaskService{}
+
+	cfg := &config.Config{TaskRetention: time.Hour}
 
 	// Create processor
-	processor := NewVideoDownloadProcessor(mockService)
+	processor := NewVideoDownloadProcessor(cfg, mockService, mockTasks)
 
 	// Assert processor is properly initialized
 	assert.NotNil(t, processor)
+	assert.Equal(t, cfg, processor.config)
 	assert.Equal(t, mockService, processor.youtubeService)
+	assert.Equal(t, mockTasks, processor.taskService)
 }
 
 func TestIsTemporaryFile(t *testing.T) {
@@ -137,6 +155,7 @@ func TestTaskStatusConstants(t *testing.T) {
 	assert.Equal(t, TaskStatus("processing"), TaskStatusProcessing)
 	assert.Equal(t, TaskStatus("completed"), TaskStatusCompleted)
 	assert.Equal(t, TaskStatus("failed"), TaskStatusFailed)
+	assert.Equal(t, TaskStatus("cancelled"), TaskStatusCancelled)
 
 	// Verify they are distinct
 	statuses := map[TaskStatus]bool{
@@ -144,8 +163,17 @@ func TestTaskStatusConstants(t *testing.T) {
 		TaskStatusProcessing: true,
 		TaskStatusCompleted:  true,
 		TaskStatusFailed:     true,
+		TaskStatusCancelled:  true,
 	}
-	assert.Len(t, statuses, 4, "All task statuses should be distinct")
+	assert.Len(t, statuses, 5, "All task statuses should be distinct")
+}
+
+func TestTaskStatusIsTerminal(t *testing.T) {
+	assert.False(t, TaskStatusPending.IsTerminal())
+	assert.False(t, TaskStatusProcessing.IsTerminal())
+	assert.True(t, TaskStatusCompleted.IsTerminal())
+	assert.True(t, TaskStatusFailed.IsTerminal())
+	assert.True(t, TaskStatusCancelled.IsTerminal())
 }
 
 func TestVideoDownloadPayloadStructure(t *testing.T) {
@@ -191,3 +219,8 @@ func TestVideoDownloadPayloadStructure(t *testing.T) {
 	assert.Contains(t, jsonMap, "thumbnail_url")
 	assert.Contains(t, jsonMap, "duration")
 }
+
+func TestIsLastAttempt(t *testing.T) {
+	// Outside of a worker there is no retry information, so the task is not on its last attempt
+	assert.False(t, isLastAttempt(context.Background()))
+}
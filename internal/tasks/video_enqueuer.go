@@ -0,0 +1,168 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"spiropoulos94/youtube-downloader/internal/services"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// enqueueGracePeriod is how long after claiming a video a task may take to show up in the queue
+const enqueueGracePeriod = 10 * time.Second
+
+// VideoEnqueuer enqueues video downloads for the API, playlists and subscriptions alike, so
+// requests for a video that is already being downloaded in the same format share its task
+type VideoEnqueuer struct {
+	config         *config.Config
+	youtubeService services.YouTubeServiceInterface
+	taskService    services.TaskServiceInterface
+	apiKeyService  services.APIKeyServiceInterface
+	client         *asynq.Client
+	inspector      *asynq.Inspector
+}
+
+// NewVideoEnqueuer creates a new VideoEnqueuer
+func NewVideoEnqueuer(
+	config *config.Config,
+	youtubeService services.YouTubeServiceInterface,
+	taskService services.TaskServiceInterface,
+	apiKeyService services.APIKeyServiceInterface,
+	client *asynq.Client,
+	inspector *asynq.Inspector,
+) *VideoEnqueuer {
+	return &VideoEnqueuer{
+		config:         config,
+		youtubeService: youtubeService,
+		taskService:    taskService,
+		apiKeyService:  apiKeyService,
+		client:         client,
+		inspector:      inspector,
+	}
+}
+
+// EnqueuedVideo is the task a video download was enqueued as, or attached to
+type EnqueuedVideo struct {
+	TaskID   string
+	Attached bool // The video was already being downloaded by the task
+}
+
+// Enqueue enqueues the download of a video as task taskID, unless the video is already being
+// downloaded in the same format, in which case the task downloading it is returned. Enqueuing
+// the same task ID again, e.g. when a playlist expansion is retried, returns the same task.
+// New tasks count against the daily download quota of apiKey, which is nil without authentication;
+// a *services.QuotaExceededError is returned once it is used up.
+func (e *VideoEnqueuer) Enqueue(ctx context.Context, taskID string, url string, opts services.DownloadOptions, timeout time.Duration, apiKey *services.APIKey) (*EnqueuedVideo, error) {
+	var apiKeyID string
+	if apiKey != nil {
+		apiKeyID = apiKey.ID
+	}
+
+	task, err := NewVideoDownloadTask(url, opts, timeout, apiKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create task for %s: %v", url, err)
+	}
+
+	urlHash := e.youtubeService.GetURLHash(url, opts)
+	for {
+		// Claim the video before enqueuing, so identical requests arriving at the same time share one task
+		claimedID, claimAge, err := e.taskService.ClaimInFlightTask(ctx, urlHash, taskID, timeout+e.config.TaskRetention)
+		if err != nil {
+			return nil, err
+		}
+
+		if claimedID != taskID {
+			if e.IsInFlight(ctx, claimedID, claimAge) {
+				if err := e.taskService.AttachCaller(ctx, claimedID, apiKeyID, timeout+e.config.TaskRetention); err != nil {
+					return nil, err
+				}
+				log.Printf("Attached to in-flight task: ID=%s, URL=%s, Format=%q", claimedID, url, opts.CacheKey())
+				return &EnqueuedVideo{TaskID: claimedID, Attached: true}, nil
+			}
+			// The task finished without releasing its claim, e.g. because its worker crashed
+			e.ReleaseInFlight(ctx, urlHash, claimedID)
+			continue
+		}
+
+		// Only downloads that are actually started are charged
+		if apiKey != nil {
+			if err := e.apiKeyService.ClaimDownload(ctx, apiKey); err != nil {
+				e.ReleaseInFlight(ctx, urlHash, taskID)
+				return nil, err
+			}
+		}
+
+		// keep task in queue using the configured retention time
+		_, err = e.client.EnqueueContext(ctx, task, asynq.TaskID(taskID), asynq.Retention(e.config.TaskRetention))
+		if errors.Is(err, asynq.ErrTaskIDConflict) {
+			// Enqueued, charged and recorded by an earlier attempt
+			e.refundDownload(ctx, apiKey)
+			return &EnqueuedVideo{TaskID: taskID}, nil
+		}
+		if err != nil {
+			e.refundDownload(ctx, apiKey)
+			e.ReleaseInFlight(ctx, urlHash, taskID)
+			return nil, fmt.Errorf("failed to enqueue %s: %v", url, err)
+		}
+		// Without the record, cancelling the task would stop it for the callers attaching later too
+		if err := e.taskService.AttachCaller(ctx, taskID, apiKeyID, timeout+e.config.TaskRetention); err != nil {
+			log.Printf("Failed to record task caller: ID=%s, Error=%v", taskID, err)
+		}
+
+		log.Printf("Task enqueued: ID=%s, URL=%s, Format=%q, Timeout: %s, Retention: %s", taskID, url, opts.CacheKey(), timeout, e.config.TaskRetention)
+		return &EnqueuedVideo{TaskID: taskID}, nil
+	}
+}
+
+// LoadAPIKey returns the API key that submitted a playlist or subscription, or nil if it was
+// created without authentication
+func (e *VideoEnqueuer) LoadAPIKey(ctx context.Context, id string) (*services.APIKey, error) {
+	if id == "" {
+		return nil, nil
+	}
+	apiKey, err := e.apiKeyService.GetAPIKey(ctx, id)
+	if errors.Is(err, services.ErrAPIKeyNotFound) {
+		return nil, fmt.Errorf("API key %s was revoked: %w", id, asynq.SkipRetry)
+	}
+	return apiKey, err
+}
+
+// refundDownload takes back the download counted against apiKey's quota by Enqueue
+func (e *VideoEnqueuer) refundDownload(ctx context.Context, apiKey *services.APIKey) {
+	if apiKey == nil {
+		return
+	}
+	if err := e.apiKeyService.RefundDownload(ctx, apiKey.ID); err != nil {
+		log.Printf("Failed to refund download: Key=%s, Error=%v", apiKey.ID, err)
+	}
+}
+
+// IsInFlight reports whether a task that claimed its video claimAge ago is still queued or
+// downloading. A task that can't be found may still be in the middle of being enqueued, for
+// enqueueGracePeriod after its claim; after that it was deleted or expired.
+func (e *VideoEnqueuer) IsInFlight(ctx context.Context, taskID string, claimAge time.Duration) bool {
+	if data, err := e.taskService.GetFinalTaskState(ctx, taskID); err != nil || data != nil {
+		// Cancelled and timed out tasks are over
+		return err != nil
+	}
+
+	info, err := e.inspector.GetTaskInfo("default", taskID)
+	if errors.Is(err, asynq.ErrTaskNotFound) {
+		return claimAge >= 0 && claimAge < enqueueGracePeriod
+	}
+	if err != nil {
+		return false
+	}
+	return info.State != asynq.TaskStateCompleted && info.State != asynq.TaskStateArchived
+}
+
+// ReleaseInFlight releases a task's claim on a video, so the next request for it starts a new download
+func (e *VideoEnqueuer) ReleaseInFlight(ctx context.Context, urlHash string, taskID string) {
+	if err := e.taskService.ReleaseInFlightTask(ctx, urlHash, taskID); err != nil {
+		log.Printf("Failed to release in-flight task: ID=%s, Error=%v", taskID, err)
+	}
+}
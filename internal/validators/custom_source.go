@@ -0,0 +1,53 @@
+package validators
+
+import (
+	"net/url"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"strings"
+)
+
+// hostSource is a custom source accepting any URL with a path on its hosts.
+// Its videos are identified by their host, path and query.
+type hostSource struct {
+	name  string
+	hosts map[string]bool
+	args  []string
+}
+
+// newHostSource creates the source of a site defined by the operator
+func newHostSource(custom config.CustomSource) *hostSource {
+	source := &hostSource{
+		name:  custom.Name,
+		hosts: make(map[string]bool, len(custom.Hosts)),
+		args:  custom.Args,
+	}
+	for _, host := range custom.Hosts {
+		source.hosts[strings.ToLower(host)] = true
+	}
+	return source
+}
+
+func (s *hostSource) Name() string {
+	return s.name
+}
+
+func (s *hostSource) Matches(parsedURL *url.URL) bool {
+	return s.hosts[strings.ToLower(parsedURL.Hostname())]
+}
+
+func (s *hostSource) Parse(parsedURL *url.URL) (*MediaURL, error) {
+	path := strings.Trim(parsedURL.Path, "/")
+	if path == "" {
+		return nil, newValidationError(ErrCodeMissingVideoID, "missing video ID")
+	}
+
+	videoID := strings.ToLower(parsedURL.Hostname()) + "/" + path
+	if parsedURL.RawQuery != "" {
+		videoID += "?" + parsedURL.RawQuery
+	}
+	return &MediaURL{VideoID: videoID}, nil
+}
+
+func (s *hostSource) DownloadArgs() []string {
+	return s.args
+}
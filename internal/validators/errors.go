@@ -0,0 +1,32 @@
+package validators
+
+import "fmt"
+
+// ErrorCode identifies why a URL was rejected, so API clients don't have to match messages
+type ErrorCode string
+
+// Validation error codes
+const (
+	ErrCodeEmptyURL          ErrorCode = "empty_url"           // No URL was given
+	ErrCodeInvalidURL        ErrorCode = "invalid_url"         // The URL can't be parsed or isn't http(s)
+	ErrCodeUnsupportedHost   ErrorCode = "unsupported_host"    // The host is not a YouTube host
+	ErrCodeUnsupportedPath   ErrorCode = "unsupported_path"    // A YouTube page that is not a video or playlist
+	ErrCodeMissingVideoID    ErrorCode = "missing_video_id"    // A video URL without a video ID
+	ErrCodeInvalidVideoID    ErrorCode = "invalid_video_id"    // The video ID is not 11 URL safe characters
+	ErrCodeMissingPlaylistID ErrorCode = "missing_playlist_id" // A playlist URL without a playlist ID
+)
+
+// ValidationError is returned for URLs that can't be downloaded
+type ValidationError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// newValidationError creates a ValidationError with a formatted message
+func newValidationError(code ErrorCode, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
@@ -2,5 +2,5 @@ package validators
 
 // URLValidatorInterface defines the contract for URL validation
 type URLValidatorInterface interface {
-	Validate(urlStr string) error
+	Validate(urlStr string) (*MediaURL, error)
 }
@@ -0,0 +1,50 @@
+package validators
+
+import (
+	"net/url"
+	"strings"
+)
+
+// soundCloudHosts are the hosts serving SoundCloud tracks
+var soundCloudHosts = map[string]bool{
+	"soundcloud.com":     true,
+	"www.soundcloud.com": true,
+	"m.soundcloud.com":   true,
+}
+
+// soundCloudReservedPaths are first path segments that are SoundCloud pages rather than users
+var soundCloudReservedPaths = map[string]bool{
+	"discover": true, "search": true, "stream": true, "upload": true, "you": true, "charts": true, "tags": true,
+}
+
+// soundCloudProfileTabs are second path segments that are tabs of a user's profile rather than tracks
+var soundCloudProfileTabs = map[string]bool{
+	"tracks": true, "albums": true, "sets": true, "reposts": true, "likes": true,
+	"popular-tracks": true, "followers": true, "following": true, "comments": true,
+}
+
+// soundCloudSource accepts soundcloud.com/USER/TRACK URLs. Tracks are audio only.
+type soundCloudSource struct{}
+
+func (soundCloudSource) Name() string {
+	return SourceSoundCloud
+}
+
+func (soundCloudSource) Matches(parsedURL *url.URL) bool {
+	return soundCloudHosts[strings.ToLower(parsedURL.Hostname())]
+}
+
+func (soundCloudSource) Parse(parsedURL *url.URL) (*MediaURL, error) {
+	segments := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	if len(segments) != 2 || segments[0] == "" || soundCloudReservedPaths[segments[0]] || soundCloudProfileTabs[segments[1]] {
+		return nil, newValidationError(ErrCodeUnsupportedPath, "not a SoundCloud track URL")
+	}
+
+	// SoundCloud has no public numeric IDs in its URLs, the user and track names identify a track
+	videoID := strings.ToLower(segments[0] + "/" + segments[1])
+	return &MediaURL{VideoID: videoID, AudioOnly: true}, nil
+}
+
+func (soundCloudSource) DownloadArgs() []string {
+	return nil
+}
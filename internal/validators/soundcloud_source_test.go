@@ -0,0 +1,53 @@
+package validators
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestSoundCloudSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		matches  bool
+		want     string
+		wantCode ErrorCode
+	}{
+		{name: "track", url: "https://soundcloud.com/Artist/Some-Track", matches: true, want: "artist/some-track"},
+		{name: "mobile track", url: "https://m.soundcloud.com/artist/some-track?in=artist/sets/album", matches: true, want: "artist/some-track"},
+		{name: "profile", url: "https://soundcloud.com/artist", matches: true, wantCode: ErrCodeUnsupportedPath},
+		{name: "profile tab", url: "https://soundcloud.com/artist/tracks", matches: true, wantCode: ErrCodeUnsupportedPath},
+		{name: "set", url: "https://soundcloud.com/artist/sets/album", matches: true, wantCode: ErrCodeUnsupportedPath},
+		{name: "site page", url: "https://soundcloud.com/discover/sets", matches: true, wantCode: ErrCodeUnsupportedPath},
+		{name: "other host", url: "https://api.soundcloud.com/tracks/123", matches: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsedURL, _ := url.Parse(tt.url)
+			source := soundCloudSource{}
+			if got := source.Matches(parsedURL); got != tt.matches {
+				t.Fatalf("Matches() = %v, want %v", got, tt.matches)
+			}
+			if !tt.matches {
+				return
+			}
+
+			media, err := source.Parse(parsedURL)
+			if tt.wantCode != "" {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) || validationErr.Code != tt.wantCode {
+					t.Errorf("Parse() error = %v, want code %v", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() unexpected error: %v", err)
+			}
+			if media.VideoID != tt.want || !media.AudioOnly {
+				t.Errorf("Parse() = %+v, want audio only track %q", media, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package validators
+
+import (
+	"log"
+	"net/url"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"strings"
+)
+
+// Names of the built-in sources, as used in the SOURCES setting
+const (
+	SourceYouTube    = "youtube"
+	SourceVimeo      = "vimeo"
+	SourceSoundCloud = "soundcloud"
+)
+
+// Source recognises the URLs of one site yt-dlp can download from
+type Source interface {
+	// Name identifies the source in config, cache keys and logs
+	Name() string
+	// Matches reports whether the URL belongs to the source's site
+	Matches(parsedURL *url.URL) bool
+	// Parse validates a URL of the site and returns what it points to
+	Parse(parsedURL *url.URL) (*MediaURL, error)
+	// DownloadArgs returns extra yt-dlp options the site's downloads need
+	DownloadArgs() []string
+}
+
+// MediaURL is what a valid URL points to: either a single video or a playlist
+type MediaURL struct {
+	Source       string   // Name of the source the URL belongs to
+	VideoID      string   // Canonical ID of the video or track, empty for playlists
+	PlaylistID   string   // Only set for playlist pages, watch URLs in a playlist download only the video
+	AudioOnly    bool     // The site only hosts audio, so it can only be downloaded in audio mode
+	DownloadArgs []string // Extra yt-dlp options of the source
+}
+
+// CacheKey returns the key identifying the video across all of its URL forms.
+// YouTube keys are the bare video ID, so files cached before other sites were supported stay valid.
+func (m *MediaURL) CacheKey() string {
+	if m.Source == SourceYouTube {
+		return m.VideoID
+	}
+	return m.Source + ":" + m.VideoID
+}
+
+// builtinSources are the sources that can be enabled by name, in the order URLs are matched
+var builtinSources = []Source{youtubeSource{}, vimeoSource{}, soundCloudSource{}}
+
+// SourceRegistry implements URLValidatorInterface by dispatching URLs to the enabled sources
+type SourceRegistry struct {
+	sources []Source
+}
+
+// NewSourceRegistry creates a registry of the sources enabled in the config. Every built-in
+// source is enabled if none is configured. Unknown names and invalid custom sources are
+// skipped with a warning.
+func NewSourceRegistry(config *config.Config) URLValidatorInterface {
+	registry := &SourceRegistry{}
+
+	if len(config.Sources) == 0 {
+		registry.sources = append(registry.sources, builtinSources...)
+	}
+	for _, name := range config.Sources {
+		source := builtinSource(name)
+		if source == nil {
+			log.Printf("Warning: Ignoring unknown source %q (supported: %s, %s, %s)", name, SourceYouTube, SourceVimeo, SourceSoundCloud)
+			continue
+		}
+		registry.sources = append(registry.sources, source)
+	}
+
+	for _, custom := range config.CustomSources {
+		if custom.Name == "" || len(custom.Hosts) == 0 || builtinSource(custom.Name) != nil {
+			log.Printf("Warning: Ignoring custom source %q: it needs a unique name and at least one host", custom.Name)
+			continue
+		}
+		registry.sources = append(registry.sources, newHostSource(custom))
+	}
+
+	return registry
+}
+
+// builtinSource returns the built-in source with the given name, or nil if there is none
+func builtinSource(name string) Source {
+	for _, source := range builtinSources {
+		if source.Name() == strings.ToLower(name) {
+			return source
+		}
+	}
+	return nil
+}
+
+// Validate checks that the URL belongs to an enabled source and returns what it points to.
+// Hosts are matched exactly and each source reads the ID from the URL forms its site uses.
+// Invalid URLs are reported with a *ValidationError.
+func (r *SourceRegistry) Validate(urlStr string) (*MediaURL, error) {
+	// Check if URL is empty
+	if urlStr == "" {
+		return nil, newValidationError(ErrCodeEmptyURL, "URL cannot be empty")
+	}
+
+	// Parse the URL
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, newValidationError(ErrCodeInvalidURL, "invalid URL format: %v", err)
+	}
+	if parsedURL.Scheme != "" && parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return nil, newValidationError(ErrCodeInvalidURL, "URL must use http or https")
+	}
+
+	for _, source := range r.sources {
+		if !source.Matches(parsedURL) {
+			continue
+		}
+		media, err := source.Parse(parsedURL)
+		if err != nil {
+			return nil, err
+		}
+		media.Source = source.Name()
+		media.DownloadArgs = source.DownloadArgs()
+		return media, nil
+	}
+
+	names := make([]string, len(r.sources))
+	for i, source := range r.sources {
+		names[i] = source.Name()
+	}
+	return nil, newValidationError(ErrCodeUnsupportedHost, "not a URL of a supported site (%s)", strings.Join(names, ", "))
+}
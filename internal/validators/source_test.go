@@ -0,0 +1,101 @@
+package validators
+
+import (
+	"errors"
+	"reflect"
+	"spiropoulos94/youtube-downloader/internal/config"
+	"testing"
+)
+
+func TestNewSourceRegistry(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *config.Config
+		want   []string
+	}{
+		{name: "all built-in sources by default", config: &config.Config{}, want: []string{SourceYouTube, SourceVimeo, SourceSoundCloud}},
+		{name: "configured sources", config: &config.Config{Sources: []string{"YouTube", "soundcloud"}}, want: []string{SourceYouTube, SourceSoundCloud}},
+		{name: "unknown source", config: &config.Config{Sources: []string{"youtube", "dailymotion"}}, want: []string{SourceYouTube}},
+		{
+			name: "custom sources",
+			config: &config.Config{
+				Sources: []string{"youtube"},
+				CustomSources: []config.CustomSource{
+					{Name: "conference", Hosts: []string{"recordings.example.com"}},
+					{Name: "vimeo", Hosts: []string{"vimeo.example.com"}}, // Clashes with a built-in source
+					{Name: "nohosts"},
+				},
+			},
+			want: []string{SourceYouTube, "conference"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewSourceRegistry(tt.config).(*SourceRegistry)
+			var names []string
+			for _, source := range registry.sources {
+				names = append(names, source.Name())
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("sources = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceRegistryValidate(t *testing.T) {
+	registry := NewSourceRegistry(&config.Config{
+		Sources: []string{SourceYouTube, SourceVimeo},
+		CustomSources: []config.CustomSource{
+			{Name: "conference", Hosts: []string{"recordings.example.com"}, Args: []string{"--cookies", "/etc/cookies.txt"}},
+		},
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		want     *MediaURL
+		wantCode ErrorCode
+	}{
+		{name: "youtube", url: "https://youtu.be/dQw4w9WgXcQ", want: &MediaURL{Source: SourceYouTube, VideoID: "dQw4w9WgXcQ"}},
+		{name: "vimeo", url: "https://vimeo.com/76979871", want: &MediaURL{Source: SourceVimeo, VideoID: "76979871"}},
+		{
+			name: "custom source",
+			url:  "https://Recordings.example.com/2024/keynote?lang=en",
+			want: &MediaURL{Source: "conference", VideoID: "recordings.example.com/2024/keynote?lang=en", DownloadArgs: []string{"--cookies", "/etc/cookies.txt"}},
+		},
+		{name: "custom source without path", url: "https://recordings.example.com/", wantCode: ErrCodeMissingVideoID},
+		{name: "disabled source", url: "https://soundcloud.com/artist/track", wantCode: ErrCodeUnsupportedHost},
+		{name: "empty", url: "", wantCode: ErrCodeEmptyURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := registry.Validate(tt.url)
+			if tt.wantCode != "" {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) || validationErr.Code != tt.wantCode {
+					t.Errorf("Validate() error = %v, want code %v", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaURLCacheKey(t *testing.T) {
+	// YouTube keys stay bare video IDs so existing downloads keep their hashes
+	if key := (&MediaURL{Source: SourceYouTube, VideoID: "dQw4w9WgXcQ"}).CacheKey(); key != "dQw4w9WgXcQ" {
+		t.Errorf("CacheKey() = %q, want %q", key, "dQw4w9WgXcQ")
+	}
+	if key := (&MediaURL{Source: SourceVimeo, VideoID: "76979871"}).CacheKey(); key != "vimeo:76979871" {
+		t.Errorf("CacheKey() = %q, want %q", key, "vimeo:76979871")
+	}
+}
@@ -0,0 +1,81 @@
+package validators
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// videoIDPattern matches the 11 character IDs YouTube gives its videos
+var videoIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// youtubeHosts are the hosts serving YouTube pages. Hosts are matched exactly, so look-alikes
+// such as youtube.com.example.org are rejected.
+var youtubeHosts = map[string]bool{
+	"youtube.com":       true,
+	"www.youtube.com":   true,
+	"m.youtube.com":     true,
+	"music.youtube.com": true,
+}
+
+// shortLinkHosts are the hosts of youtu.be/ID short links
+var shortLinkHosts = map[string]bool{
+	"youtu.be":     true,
+	"www.youtu.be": true,
+}
+
+// isYouTubeHost reports whether a URL's host serves YouTube pages
+func isYouTubeHost(parsedURL *url.URL) bool {
+	return youtubeHosts[strings.ToLower(parsedURL.Hostname())]
+}
+
+// ExtractVideoID returns the canonical ID of the video a YouTube URL points to.
+// It understands youtube.com/watch?v=ID (including the m. and music. hosts), youtu.be/ID
+// and the youtube.com/shorts/ID, /embed/ID, /live/ID and /v/ID paths.
+// Invalid URLs are reported with a *ValidationError.
+func ExtractVideoID(urlStr string) (string, error) {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return "", newValidationError(ErrCodeInvalidURL, "invalid URL format: %v", err)
+	}
+	return videoIDFromURL(parsedURL)
+}
+
+// videoIDFromURL returns the ID of the video a parsed YouTube URL points to
+func videoIDFromURL(parsedURL *url.URL) (string, error) {
+	segments := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+
+	var videoID string
+	switch {
+	case shortLinkHosts[strings.ToLower(parsedURL.Hostname())]:
+		videoID = segments[0]
+
+	case isYouTubeHost(parsedURL):
+		switch segments[0] {
+		case "watch":
+			videoID = parsedURL.Query().Get("v")
+		case "shorts", "embed", "live", "v":
+			if len(segments) > 1 {
+				videoID = segments[1]
+			}
+		default:
+			return "", newValidationError(ErrCodeUnsupportedPath, "not a YouTube watch or playlist URL")
+		}
+
+	default:
+		return "", newValidationError(ErrCodeUnsupportedHost, "not a YouTube URL")
+	}
+
+	if videoID == "" {
+		return "", newValidationError(ErrCodeMissingVideoID, "missing video ID")
+	}
+	// Basic video ID validation (YouTube video IDs are 11 characters)
+	if len(videoID) != 11 {
+		return "", newValidationError(ErrCodeInvalidVideoID, "invalid video ID length")
+	}
+	if !videoIDPattern.MatchString(videoID) {
+		return "", newValidationError(ErrCodeInvalidVideoID, "invalid video ID")
+	}
+
+	return videoID, nil
+}
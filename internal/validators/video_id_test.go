@@ -0,0 +1,53 @@
+package validators
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractVideoID(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr string
+	}{
+		{name: "watch URL", url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", want: "dQw4w9WgXcQ"},
+		{name: "watch URL with timestamp", url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=30s", want: "dQw4w9WgXcQ"},
+		{name: "watch URL in a playlist", url: "https://www.youtube.com/watch?list=PL123&v=dQw4w9WgXcQ", want: "dQw4w9WgXcQ"},
+		{name: "mobile URL", url: "https://m.youtube.com/watch?v=dQw4w9WgXcQ", want: "dQw4w9WgXcQ"},
+		{name: "music URL", url: "https://music.youtube.com/watch?v=dQw4w9WgXcQ", want: "dQw4w9WgXcQ"},
+		{name: "short link", url: "https://youtu.be/dQw4w9WgXcQ", want: "dQw4w9WgXcQ"},
+		{name: "short link with timestamp", url: "https://youtu.be/dQw4w9WgXcQ?t=30", want: "dQw4w9WgXcQ"},
+		{name: "shorts", url: "https://www.youtube.com/shorts/dQw4w9WgXcQ", want: "dQw4w9WgXcQ"},
+		{name: "embed", url: "https://www.youtube.com/embed/dQw4w9WgXcQ", want: "dQw4w9WgXcQ"},
+		{name: "live", url: "https://www.youtube.com/live/dQw4w9WgXcQ?feature=share", want: "dQw4w9WgXcQ"},
+		{name: "uppercase host", url: "https://WWW.YOUTUBE.COM/watch?v=dQw4w9WgXcQ", want: "dQw4w9WgXcQ"},
+		{name: "not YouTube", url: "https://vimeo.com/watch?v=dQw4w9WgXcQ", wantErr: "not a YouTube URL"},
+		{name: "look-alike host", url: "https://youtube.com.evil.example/watch?v=dQw4w9WgXcQ", wantErr: "not a YouTube URL"},
+		{name: "look-alike short link", url: "https://youtu.be.evil.example/dQw4w9WgXcQ", wantErr: "not a YouTube URL"},
+		{name: "channel", url: "https://www.youtube.com/@example", wantErr: "not a YouTube watch or playlist URL"},
+		{name: "missing ID", url: "https://youtu.be/", wantErr: "missing video ID"},
+		{name: "shorts without ID", url: "https://www.youtube.com/shorts/", wantErr: "missing video ID"},
+		{name: "wrong length", url: "https://youtu.be/tooShort", wantErr: "invalid video ID length"},
+		{name: "invalid characters", url: "https://www.youtube.com/watch?v=dQw4w9WgX!Q", wantErr: "invalid video ID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractVideoID(tt.url)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ExtractVideoID() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractVideoID() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExtractVideoID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package validators
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// vimeoIDPattern matches the numeric IDs Vimeo gives its videos
+var vimeoIDPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// vimeoHosts are the hosts serving Vimeo videos
+var vimeoHosts = map[string]bool{
+	"vimeo.com":        true,
+	"www.vimeo.com":    true,
+	"player.vimeo.com": true,
+}
+
+// vimeoSource accepts vimeo.com/ID (optionally followed by the hash of an unlisted video),
+// player.vimeo.com/video/ID and videos inside channels, groups and showcases
+type vimeoSource struct{}
+
+func (vimeoSource) Name() string {
+	return SourceVimeo
+}
+
+func (vimeoSource) Matches(parsedURL *url.URL) bool {
+	return vimeoHosts[strings.ToLower(parsedURL.Hostname())]
+}
+
+func (vimeoSource) Parse(parsedURL *url.URL) (*MediaURL, error) {
+	segments := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+
+	var videoID string
+	switch {
+	case segments[0] == "":
+		return nil, newValidationError(ErrCodeMissingVideoID, "missing video ID")
+	case vimeoIDPattern.MatchString(segments[0]):
+		// vimeo.com/ID or vimeo.com/ID/HASH for unlisted videos
+		videoID = segments[0]
+	default:
+		// The video is the last segment of e.g. channels/NAME/ID, groups/NAME/videos/ID,
+		// showcase/SHOWCASE/video/ID and player.vimeo.com/video/ID
+		last := segments[len(segments)-1]
+		if len(segments) < 2 || !vimeoIDPattern.MatchString(last) || (segments[0] == "showcase" && len(segments) < 4) {
+			return nil, newValidationError(ErrCodeUnsupportedPath, "not a Vimeo video URL")
+		}
+		videoID = last
+	}
+
+	return &MediaURL{VideoID: videoID}, nil
+}
+
+func (vimeoSource) DownloadArgs() []string {
+	return nil
+}
@@ -0,0 +1,56 @@
+package validators
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestVimeoSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		matches  bool
+		want     string
+		wantCode ErrorCode
+	}{
+		{name: "video", url: "https://vimeo.com/76979871", matches: true, want: "76979871"},
+		{name: "unlisted video", url: "https://vimeo.com/76979871/8a3b2c1d0e", matches: true, want: "76979871"},
+		{name: "player", url: "https://player.vimeo.com/video/76979871?h=abc", matches: true, want: "76979871"},
+		{name: "channel video", url: "https://vimeo.com/channels/staffpicks/76979871", matches: true, want: "76979871"},
+		{name: "group video", url: "https://vimeo.com/groups/shortfilms/videos/76979871", matches: true, want: "76979871"},
+		{name: "showcase video", url: "https://vimeo.com/showcase/9876543/video/76979871", matches: true, want: "76979871"},
+		{name: "showcase", url: "https://vimeo.com/showcase/9876543", matches: true, wantCode: ErrCodeUnsupportedPath},
+		{name: "channel", url: "https://vimeo.com/channels/staffpicks", matches: true, wantCode: ErrCodeUnsupportedPath},
+		{name: "home page", url: "https://vimeo.com/", matches: true, wantCode: ErrCodeMissingVideoID},
+		{name: "look-alike host", url: "https://vimeo.com.evil.example/76979871", matches: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsedURL, _ := url.Parse(tt.url)
+			source := vimeoSource{}
+			if got := source.Matches(parsedURL); got != tt.matches {
+				t.Fatalf("Matches() = %v, want %v", got, tt.matches)
+			}
+			if !tt.matches {
+				return
+			}
+
+			media, err := source.Parse(parsedURL)
+			if tt.wantCode != "" {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) || validationErr.Code != tt.wantCode {
+					t.Errorf("Parse() error = %v, want code %v", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() unexpected error: %v", err)
+			}
+			if media.VideoID != tt.want {
+				t.Errorf("Parse() video ID = %q, want %q", media.VideoID, tt.want)
+			}
+		})
+	}
+}
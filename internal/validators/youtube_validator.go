@@ -1,52 +1,92 @@
 package validators
 
 import (
-	"fmt"
 	"net/url"
 	"strings"
 )
 
-// YouTubeURLValidator implements URLValidatorInterface
-type YouTubeURLValidator struct{}
+// youtubeSource accepts YouTube playlists and every URL form YouTube shares videos with:
+// youtu.be links, watch URLs on the www, m. and music. hosts, shorts, embeds and live streams
+type youtubeSource struct{}
 
-// NewYouTubeURLValidator creates a new instance of YouTubeURLValidator
-func NewYouTubeURLValidator() URLValidatorInterface {
-	return &YouTubeURLValidator{}
+func (youtubeSource) Name() string {
+	return SourceYouTube
 }
 
-// Validate checks if the given URL is a valid YouTube URL
-func (v *YouTubeURLValidator) Validate(urlStr string) error {
-	// Check if URL is empty
-	if urlStr == "" {
-		return fmt.Errorf("URL cannot be empty")
+func (youtubeSource) Matches(parsedURL *url.URL) bool {
+	return isYouTubeHost(parsedURL) || shortLinkHosts[strings.ToLower(parsedURL.Hostname())]
+}
+
+func (youtubeSource) Parse(parsedURL *url.URL) (*MediaURL, error) {
+	// Playlists only need a playlist ID
+	if isYouTubeHost(parsedURL) && parsedURL.Path == "/playlist" {
+		playlistID := parsedURL.Query().Get("list")
+		if playlistID == "" {
+			return nil, newValidationError(ErrCodeMissingPlaylistID, "missing playlist ID")
+		}
+		return &MediaURL{PlaylistID: playlistID}, nil
 	}
 
-	// Parse the URL
-	parsedURL, err := url.Parse(urlStr)
+	// Otherwise it must point to a single video
+	videoID, err := videoIDFromURL(parsedURL)
 	if err != nil {
-		return fmt.Errorf("invalid URL format: %w", err)
+		return nil, err
 	}
+	return &MediaURL{VideoID: videoID}, nil
+}
 
-	// Check if it's a YouTube URL
-	if !strings.Contains(parsedURL.Host, "youtube.com") {
-		return fmt.Errorf("not a YouTube URL")
+func (youtubeSource) DownloadArgs() []string {
+	return nil
+}
+
+// IsPlaylistURL reports whether the URL points to a YouTube playlist rather than a single video.
+// Watch URLs that are part of a playlist (watch?v=...&list=...) download only the video.
+func IsPlaylistURL(urlStr string) bool {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return false
 	}
+	return isYouTubeHost(parsedURL) && parsedURL.Path == "/playlist" && parsedURL.Query().Get("list") != ""
+}
+
+// IsChannelURL reports whether the URL points to a YouTube channel, e.g. youtube.com/@name,
+// youtube.com/channel/UC..., youtube.com/c/name or youtube.com/user/name, optionally followed by a tab
+func IsChannelURL(urlStr string) bool {
+	_, ok := channelPath(urlStr)
+	return ok
+}
 
-	// Check if it's a watch URL
-	if parsedURL.Path != "/watch" {
-		return fmt.Errorf("not a YouTube watch URL")
+// ChannelUploadsURL returns the URL listing a channel's uploads.
+// Channel home pages list their tabs instead of their videos, so the videos tab is added if no tab was given.
+func ChannelUploadsURL(urlStr string) string {
+	segments, ok := channelPath(urlStr)
+	if !ok {
+		return urlStr
 	}
 
-	// Check for video ID
-	videoID := parsedURL.Query().Get("v")
-	if videoID == "" {
-		return fmt.Errorf("missing video ID")
+	channelSegments := 2
+	if strings.HasPrefix(segments[0], "@") {
+		channelSegments = 1
+	}
+	if len(segments) > channelSegments {
+		return urlStr // A tab was chosen
 	}
+	return strings.TrimSuffix(urlStr, "/") + "/videos"
+}
 
-	// Basic video ID validation (YouTube video IDs are typically 11 characters)
-	if len(videoID) != 11 {
-		return fmt.Errorf("invalid video ID length")
+// channelPath returns the path segments of a channel URL, and false if the URL is not a channel URL
+func channelPath(urlStr string) ([]string, bool) {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil || !isYouTubeHost(parsedURL) {
+		return nil, false
 	}
 
-	return nil
+	segments := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	switch {
+	case strings.HasPrefix(segments[0], "@") && len(segments[0]) > 1:
+		return segments, len(segments) <= 2
+	case segments[0] == "channel" || segments[0] == "c" || segments[0] == "user":
+		return segments, len(segments) >= 2 && segments[1] != "" && len(segments) <= 3
+	}
+	return nil, false
 }
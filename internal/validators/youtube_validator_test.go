@@ -1,92 +1,122 @@
 package validators
 
 import (
+	"errors"
+	"spiropoulos94/youtube-downloader/internal/config"
 	"strings"
 	"testing"
 )
 
-func TestYouTubeURLValidator_Validate(t *testing.T) {
+func TestYouTubeSource(t *testing.T) {
 	tests := []struct {
-		name    string
-		url     string
-		wantErr bool
-		errMsg  string
+		name     string
+		url      string
+		want     MediaURL
+		wantCode ErrorCode
+		errMsg   string
 	}{
-		{
-			name:    "Valid YouTube URL",
-			url:     "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
-			wantErr: false,
-		},
-		{
-			name:    "Empty URL",
-			url:     "",
-			wantErr: true,
-			errMsg:  "URL cannot be empty",
-		},
-		{
-			name:    "Malformed URL",
-			url:     "http://[::1]:namedport",
-			wantErr: true,
-			errMsg:  "invalid URL format",
-		},
-		{
-			name:    "Non-YouTube domain",
-			url:     "not-a-url",
-			wantErr: true,
-			errMsg:  "not a YouTube URL",
-		},
-		{
-			name:    "Non-YouTube URL",
-			url:     "https://vimeo.com/watch?v=12345",
-			wantErr: true,
-			errMsg:  "not a YouTube URL",
-		},
-		{
-			name:    "YouTube URL without watch path",
-			url:     "https://www.youtube.com/channel/UC-lHJZR3Gqxm24_Vd_AJ5Yw",
-			wantErr: true,
-			errMsg:  "not a YouTube watch URL",
-		},
-		{
-			name:    "YouTube URL without video ID",
-			url:     "https://www.youtube.com/watch",
-			wantErr: true,
-			errMsg:  "missing video ID",
-		},
-		{
-			name:    "YouTube URL with invalid video ID length",
-			url:     "https://www.youtube.com/watch?v=tooShort",
-			wantErr: true,
-			errMsg:  "invalid video ID length",
-		},
-		{
-			name:    "YouTube URL with too long video ID",
-			url:     "https://www.youtube.com/watch?v=tooLongVideoID123",
-			wantErr: true,
-			errMsg:  "invalid video ID length",
-		},
-		{
-			name:    "YouTube URL with other query parameters",
-			url:     "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=10s",
-			wantErr: false,
-		},
+		{name: "Valid YouTube URL", url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", want: MediaURL{VideoID: "dQw4w9WgXcQ"}},
+		{name: "Empty URL", url: "", wantCode: ErrCodeEmptyURL, errMsg: "URL cannot be empty"},
+		{name: "Malformed URL", url: "http://[::1]:namedport", wantCode: ErrCodeInvalidURL, errMsg: "invalid URL format"},
+		{name: "Unsupported scheme", url: "ftp://www.youtube.com/watch?v=dQw4w9WgXcQ", wantCode: ErrCodeInvalidURL, errMsg: "URL must use http or https"},
+		{name: "Non-YouTube domain", url: "not-a-url", wantCode: ErrCodeUnsupportedHost, errMsg: "not a URL of a supported site (youtube)"},
+		{name: "Non-YouTube URL", url: "https://vimeo.com/watch?v=12345", wantCode: ErrCodeUnsupportedHost, errMsg: "not a URL of a supported site (youtube)"},
+		{name: "Look-alike host", url: "https://youtube.com.evil.example/watch?v=dQw4w9WgXcQ", wantCode: ErrCodeUnsupportedHost, errMsg: "not a URL of a supported site (youtube)"},
+		{name: "Host with YouTube prefix", url: "https://notyoutube.com/watch?v=dQw4w9WgXcQ", wantCode: ErrCodeUnsupportedHost, errMsg: "not a URL of a supported site (youtube)"},
+		{name: "YouTube in user info", url: "https://www.youtube.com@evil.example/watch?v=dQw4w9WgXcQ", wantCode: ErrCodeUnsupportedHost, errMsg: "not a URL of a supported site (youtube)"},
+		{name: "YouTube URL without watch path", url: "https://www.youtube.com/channel/UC-lHJZR3Gqxm24_Vd_AJ5Yw", wantCode: ErrCodeUnsupportedPath, errMsg: "not a YouTube watch or playlist URL"},
+		{name: "YouTube URL without video ID", url: "https://www.youtube.com/watch", wantCode: ErrCodeMissingVideoID, errMsg: "missing video ID"},
+		{name: "YouTube URL with invalid video ID length", url: "https://www.youtube.com/watch?v=tooShort", wantCode: ErrCodeInvalidVideoID, errMsg: "invalid video ID length"},
+		{name: "YouTube URL with too long video ID", url: "https://www.youtube.com/watch?v=tooLongVideoID123", wantCode: ErrCodeInvalidVideoID, errMsg: "invalid video ID length"},
+		{name: "YouTube URL with other query parameters", url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=10s", want: MediaURL{VideoID: "dQw4w9WgXcQ"}},
+		{name: "Short link", url: "https://youtu.be/dQw4w9WgXcQ", want: MediaURL{VideoID: "dQw4w9WgXcQ"}},
+		{name: "Mobile URL", url: "https://m.youtube.com/watch?v=dQw4w9WgXcQ", want: MediaURL{VideoID: "dQw4w9WgXcQ"}},
+		{name: "Music URL", url: "https://music.youtube.com/watch?v=dQw4w9WgXcQ", want: MediaURL{VideoID: "dQw4w9WgXcQ"}},
+		{name: "Shorts", url: "https://www.youtube.com/shorts/dQw4w9WgXcQ", want: MediaURL{VideoID: "dQw4w9WgXcQ"}},
+		{name: "Embed", url: "https://www.youtube.com/embed/dQw4w9WgXcQ", want: MediaURL{VideoID: "dQw4w9WgXcQ"}},
+		{name: "Live", url: "https://www.youtube.com/live/dQw4w9WgXcQ", want: MediaURL{VideoID: "dQw4w9WgXcQ"}},
+		{name: "Host with port", url: "https://www.youtube.com:443/watch?v=dQw4w9WgXcQ", want: MediaURL{VideoID: "dQw4w9WgXcQ"}},
+		{name: "YouTube playlist URL", url: "https://www.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", want: MediaURL{PlaylistID: "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf"}},
+		{name: "YouTube playlist URL without playlist ID", url: "https://www.youtube.com/playlist", wantCode: ErrCodeMissingPlaylistID, errMsg: "missing playlist ID"},
+		{name: "Look-alike playlist host", url: "https://youtube.com.evil.example/playlist?list=PL123", wantCode: ErrCodeUnsupportedHost, errMsg: "not a URL of a supported site (youtube)"},
 	}
 
-	validator := NewYouTubeURLValidator()
+	validator := NewSourceRegistry(&config.Config{Sources: []string{SourceYouTube}})
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validator.Validate(tt.url)
+			got, err := validator.Validate(tt.url)
 
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Validate() unexpected error: %v", err)
+				}
+				if got.Source != SourceYouTube || got.VideoID != tt.want.VideoID || got.PlaylistID != tt.want.PlaylistID {
+					t.Errorf("Validate() = %+v, want %+v", *got, tt.want)
+				}
 				return
 			}
 
-			if tt.wantErr && err != nil && tt.errMsg != "" {
-				if !strings.Contains(err.Error(), tt.errMsg) {
-					t.Errorf("Validate() error message = %v, want to contain %v", err.Error(), tt.errMsg)
-				}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() error = %v, want a *ValidationError", err)
+			}
+			if validationErr.Code != tt.wantCode {
+				t.Errorf("Validate() error code = %v, want %v", validationErr.Code, tt.wantCode)
+			}
+			if !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Validate() error message = %v, want to contain %v", err.Error(), tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestIsPlaylistURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "https://www.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", want: true},
+		{url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", want: false},
+		{url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", want: false},
+		{url: "https://www.youtube.com/playlist", want: false},
+		{url: "https://vimeo.com/playlist?list=123", want: false},
+		{url: "https://youtube.com.evil.example/playlist?list=123", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := IsPlaylistURL(tt.url); got != tt.want {
+				t.Errorf("IsPlaylistURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelURLs(t *testing.T) {
+	tests := []struct {
+		url        string
+		isChannel  bool
+		uploadsURL string
+	}{
+		{url: "https://www.youtube.com/@example", isChannel: true, uploadsURL: "https://www.youtube.com/@example/videos"},
+		{url: "https://www.youtube.com/@example/", isChannel: true, uploadsURL: "https://www.youtube.com/@example/videos"},
+		{url: "https://www.youtube.com/@example/streams", isChannel: true, uploadsURL: "https://www.youtube.com/@example/streams"},
+		{url: "https://www.youtube.com/channel/UC-lHJZR3Gqxm24_Vd_AJ5Yw", isChannel: true, uploadsURL: "https://www.youtube.com/channel/UC-lHJZR3Gqxm24_Vd_AJ5Yw/videos"},
+		{url: "https://www.youtube.com/user/example/videos", isChannel: true, uploadsURL: "https://www.youtube.com/user/example/videos"},
+		{url: "https://www.youtube.com/channel/", isChannel: false, uploadsURL: "https://www.youtube.com/channel/"},
+		{url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", isChannel: false, uploadsURL: "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{url: "https://vimeo.com/@example", isChannel: false, uploadsURL: "https://vimeo.com/@example"},
+		{url: "https://youtube.com.evil.example/@example", isChannel: false, uploadsURL: "https://youtube.com.evil.example/@example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := IsChannelURL(tt.url); got != tt.isChannel {
+				t.Errorf("IsChannelURL() = %v, want %v", got, tt.isChannel)
+			}
+			if got := ChannelUploadsURL(tt.url); got != tt.uploadsURL {
+				t.Errorf("ChannelUploadsURL() = %v, want %v", got, tt.uploadsURL)
 			}
 		})
 	}
@@ -1,6 +1,7 @@
 package workers
 
 import (
+	"fmt"
 	"log"
 	"spiropoulos94/youtube-downloader/internal/config"
 	"spiropoulos94/youtube-downloader/internal/services"
@@ -13,16 +14,26 @@ import (
 
 // Manager handles the Asynq worker server and task processing
 type Manager struct {
-	config         *config.Config
-	client         *asynq.Client
-	server         *asynq.Server
-	inspector      *asynq.Inspector
-	youtubeService services.YouTubeServiceInterface
-	redis          *redis.Client
+	config              *config.Config
+	client              *asynq.Client
+	server              *asynq.Server
+	inspector           *asynq.Inspector
+	scheduler           *asynq.Scheduler
+	youtubeService      services.YouTubeServiceInterface
+	taskService         services.TaskServiceInterface
+	subscriptionService services.SubscriptionServiceInterface
+	apiKeyService       services.APIKeyServiceInterface
+	redis               *redis.Client
 }
 
 // NewManager creates a new worker manager
-func NewManager(config *config.Config, youtubeService services.YouTubeServiceInterface) *Manager {
+func NewManager(
+	config *config.Config,
+	youtubeService services.YouTubeServiceInterface,
+	taskService services.TaskServiceInterface,
+	subscriptionService services.SubscriptionServiceInterface,
+	apiKeyService services.APIKeyServiceInterface,
+) *Manager {
 	redis := redis.NewClient(&redis.Options{
 		Addr: config.RedisAddr,
 	})
@@ -33,22 +44,30 @@ func NewManager(config *config.Config, youtubeService services.YouTubeServiceInt
 
 	// Create an Asynq server with configuration options
 	serverOpts := asynq.Config{
-		Concurrency:         10,
+		Concurrency:         config.WorkerConcurrency,
 		HealthCheckInterval: 5 * time.Second,
+		// Downloads held back by the outbound limits wait in the retry queue rather than in a worker
+		IsFailure:      tasks.IsFailure,
+		RetryDelayFunc: tasks.RetryDelay,
 		// Can add other asynq server configurations here
 	}
 
 	client := asynq.NewClient(redisOpt)
 	server := asynq.NewServer(redisOpt, serverOpts)
 	inspector := asynq.NewInspector(redisOpt)
+	scheduler := asynq.NewScheduler(redisOpt, nil)
 
 	return &Manager{
-		config:         config,
-		client:         client,
-		server:         server,
-		inspector:      inspector,
-		youtubeService: youtubeService,
-		redis:          redis,
+		config:              config,
+		client:              client,
+		server:              server,
+		inspector:           inspector,
+		scheduler:           scheduler,
+		youtubeService:      youtubeService,
+		taskService:         taskService,
+		subscriptionService: subscriptionService,
+		apiKeyService:       apiKeyService,
+		redis:               redis,
 	}
 }
 
@@ -57,13 +76,29 @@ func (m *Manager) Start() error {
 	log.Println("Starting worker server...")
 
 	// Initialize processors
-	downloadProcessor := tasks.NewVideoDownloadProcessor(m.youtubeService)
+	enqueuer := tasks.NewVideoEnqueuer(m.config, m.youtubeService, m.taskService, m.apiKeyService, m.client, m.inspector)
+	downloadProcessor := tasks.NewVideoDownloadProcessor(m.config, m.youtubeService, m.taskService)
+	playlistProcessor := tasks.NewPlaylistDownloadProcessor(m.config, m.youtubeService, enqueuer)
+	subscriptionProcessor := tasks.NewSubscriptionSyncProcessor(m.config, m.youtubeService, m.subscriptionService, m.client, enqueuer)
 
 	// Initialize mux
 	mux := asynq.NewServeMux()
 
 	// Register processors
 	mux.HandleFunc(tasks.TypeVideoDownload, downloadProcessor.ProcessTask)
+	mux.HandleFunc(tasks.TypePlaylistDownload, playlistProcessor.ProcessTask)
+	mux.HandleFunc(tasks.TypeSubscriptionSyncAll, subscriptionProcessor.ProcessSyncAll)
+	mux.HandleFunc(tasks.TypeSubscriptionSync, subscriptionProcessor.ProcessSync)
+
+	// Periodically check subscriptions for new uploads
+	cronspec := "@every " + m.config.SubscriptionSync.String()
+	if _, err := m.scheduler.Register(cronspec, tasks.NewSubscriptionSyncAllTask(), asynq.Unique(m.config.SubscriptionSync)); err != nil {
+		return fmt.Errorf("failed to schedule subscription sync: %v", err)
+	}
+	if err := m.scheduler.Start(); err != nil {
+		return fmt.Errorf("failed to start scheduler: %v", err)
+	}
+	log.Printf("Subscription sync scheduled every %s", m.config.SubscriptionSync)
 
 	log.Println("Worker server initialized, starting...")
 	return m.server.Run(mux)
@@ -72,6 +107,7 @@ func (m *Manager) Start() error {
 // Stop gracefully stops the worker server
 func (m *Manager) Stop() {
 	log.Println("Stopping worker server...")
+	m.scheduler.Shutdown()
 	m.server.Stop()
 	m.client.Close()
 	m.inspector.Close()